@@ -0,0 +1,367 @@
+package business_service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-platform-service/platform_service"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Access review fields
+const (
+	FLD_REVIEW_ID          = "review_id"
+	FLD_REVIEW_NAME        = "review_name"
+	FLD_REVIEW_STATUS      = "review_status"
+	FLD_REVIEW_ITEMS       = "review_items"
+	FLD_REVIEW_REPORT      = "review_report"
+	FLD_REVIEW_STARTED_AT  = "started_at"
+	FLD_REVIEW_CLOSED_AT   = "closed_at"
+	FLD_REVIEW_CLOSED_BY   = "closed_by"
+	FLD_REVIEW_DECISION    = "decision"
+	FLD_REVIEW_REVIEWER_ID = "reviewer_id"
+	FLD_REVIEW_DECIDED_AT  = "decided_at"
+	FLD_REVIEW_COMMENT     = "comment"
+	FLD_REVIEW_GRANT       = "grant"
+
+	FLD_REVIEW_KEPT      = "kept"
+	FLD_REVIEW_REVOKED   = "revoked"
+	FLD_REVIEW_UNDECIDED = "undecided"
+)
+
+// Access review status and decision values
+const (
+	REVIEW_STATUS_OPEN   = "open"
+	REVIEW_STATUS_CLOSED = "closed"
+
+	REVIEW_DECISION_KEEP   = "keep"
+	REVIEW_DECISION_REVOKE = "revoke"
+)
+
+// AccessReviewService - Access Review (certification campaign) Service structure
+type AccessReviewService interface {
+	// List - List All campaigns
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	// Get - Get the campaign
+	Get(reviewId string) (utils.Map, error)
+	// StartCampaign - Start a campaign with a snapshot of every active grant of the business
+	StartCampaign(indata utils.Map) (utils.Map, error)
+	// RecordDecision - Record keep or revoke for a grant of the campaign
+	RecordDecision(reviewId string, accessId string, indata utils.Map) (utils.Map, error)
+	// CloseCampaign - Apply the revocations and store the final report
+	CloseCampaign(reviewId string, reviewerId string) (utils.Map, error)
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// accessReviewBaseService - Access Review Service structure
+type accessReviewBaseService struct {
+	db_utils.DatabaseService
+	dbRegion       db_utils.DatabaseService
+	daoReview      collectionDao
+	daoAccess      business_repository.AccessDao
+	daoBusiness    platform_repository.BusinessDao
+	child          AccessReviewService
+	businessID     string
+	businessStatus string
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewAccessReviewService(props utils.Map) (AccessReviewService, error) {
+	funcode := business_common.GetServiceModuleCode() + "M" + "01"
+	log.Printf("AccessReviewService :: Start")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, business_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := accessReviewBaseService{}
+	// Open Database Service
+	err = p.OpenDatabaseService(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open RegionDB Service
+	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	if err != nil {
+		p.CloseDatabaseService()
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessID = businessId
+
+	// Initialize other Service
+	p.initializeService()
+
+	// Verify the given businessId is exist
+	dataBusiness, err := p.daoBusiness.Get(businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business_id",
+			ErrorDetail: "Given business_id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, err
+}
+
+func (p *accessReviewBaseService) EndService() {
+	log.Printf("EndAccessReviewService ")
+	p.CloseDatabaseService()
+	p.dbRegion.CloseDatabaseService()
+}
+
+func (p *accessReviewBaseService) initializeService() {
+	log.Printf("AccessReviewService:: GetBusinessDao ")
+	p.daoReview = newAccessReviewDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+
+	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+}
+
+func (p *accessReviewBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "07"
+}
+
+// List - List All records
+func (p *accessReviewBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+
+	log.Println("AccessReviewService::FindAll - Begin")
+
+	response, err := p.daoReview.List(filter, sort, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AccessReviewService::FindAll - End ")
+	return response, nil
+}
+
+// Get - Find By Code
+func (p *accessReviewBaseService) Get(reviewId string) (utils.Map, error) {
+	log.Printf("AccessReviewService::Get::  Begin %v", reviewId)
+
+	data, err := p.daoReview.Get(reviewId)
+	log.Println("AccessReviewService::Get:: End ", err)
+	return data, err
+}
+
+// StartCampaign - Start a campaign with a snapshot of every active grant of the business
+func (p *accessReviewBaseService) StartCampaign(indata utils.Map) (utils.Map, error) {
+
+	log.Println("AccessReviewService::StartCampaign - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	reviewId, err := utils.GetMemberDataStr(indata, FLD_REVIEW_ID)
+	if err != nil {
+		reviewId = utils.GenerateUniqueId("acrv")
+	}
+
+	// Snapshot every grant of the business in force now
+	response, err := p.daoAccess.List("", activeGrantFilter("", time.Now()), "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []utils.Map{}
+	for _, dataGrant := range getListResult(response) {
+		accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+		items = append(items, utils.Map{
+			business_common.FLD_APP_ACCESS_ID: accessId,
+			FLD_REVIEW_GRANT:                  dataGrant,
+			FLD_REVIEW_DECISION:               "",
+		})
+	}
+
+	indata[FLD_REVIEW_ID] = reviewId
+	indata[business_common.FLD_BUSINESS_ID] = p.businessID
+	indata[FLD_REVIEW_STATUS] = REVIEW_STATUS_OPEN
+	indata[FLD_REVIEW_STARTED_AT] = formatDateTime(time.Now())
+	indata[FLD_REVIEW_ITEMS] = items
+
+	data, err := p.daoReview.Create(indata)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AccessReviewService::StartCampaign - End ", reviewId, len(items))
+	return data, nil
+}
+
+// RecordDecision - Record keep or revoke for a grant of the campaign
+func (p *accessReviewBaseService) RecordDecision(reviewId string, accessId string, indata utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	log.Println("AccessReviewService::RecordDecision - Begin", reviewId, accessId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataReview, items, err := p.getOpenCampaign(reviewId)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, _ := utils.GetMemberDataStr(indata, FLD_REVIEW_DECISION)
+	if decision != REVIEW_DECISION_KEEP && decision != REVIEW_DECISION_REVOKE {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid decision",
+			ErrorDetail: fmt.Sprintf("Decision should be %s or %s", REVIEW_DECISION_KEEP, REVIEW_DECISION_REVOKE)}
+		return nil, err
+	}
+
+	reviewerId, err := utils.GetMemberDataStr(indata, FLD_REVIEW_REVIEWER_ID)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Missing reviewer", ErrorDetail: "Reviewer id is required"}
+		return nil, err
+	}
+	comment, _ := utils.GetMemberDataStr(indata, FLD_REVIEW_COMMENT)
+
+	var dataItem utils.Map
+	for _, item := range items {
+		if itemAccessId, _ := utils.GetMemberDataStr(item, business_common.FLD_APP_ACCESS_ID); itemAccessId == accessId {
+			dataItem = item
+			break
+		}
+	}
+	if dataItem == nil {
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Grant not in campaign", ErrorDetail: "Given access_id is not part of the campaign"}
+		return nil, err
+	}
+
+	dataDecision := utils.Map{
+		FLD_REVIEW_DECISION:    decision,
+		FLD_REVIEW_REVIEWER_ID: reviewerId,
+		FLD_REVIEW_COMMENT:     comment,
+		FLD_REVIEW_DECIDED_AT:  formatDateTime(time.Now()),
+	}
+
+	// Only this item is changed, decisions recorded meanwhile on the other items are kept
+	_, err = p.daoReview.UpdateItem(reviewId, FLD_REVIEW_ITEMS, business_common.FLD_APP_ACCESS_ID, accessId, dataDecision)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AccessReviewService::RecordDecision - End ", dataReview[FLD_REVIEW_ID])
+	return utils.MergeMap(dataItem, dataDecision, true), nil
+}
+
+// CloseCampaign - Apply the revocations and store the final report
+func (p *accessReviewBaseService) CloseCampaign(reviewId string, reviewerId string) (utils.Map, error) {
+
+	log.Println("AccessReviewService::CloseCampaign - Begin", reviewId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	_, items, err := p.getOpenCampaign(reviewId)
+	if err != nil {
+		return nil, err
+	}
+
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+
+	kept := []string{}
+	revoked := []string{}
+	undecided := []string{}
+	failed := []utils.Map{}
+
+	for _, item := range items {
+		accessId, _ := utils.GetMemberDataStr(item, business_common.FLD_APP_ACCESS_ID)
+		decision, _ := utils.GetMemberDataStr(item, FLD_REVIEW_DECISION)
+
+		switch decision {
+		case REVIEW_DECISION_KEEP:
+			kept = append(kept, accessId)
+		case REVIEW_DECISION_REVOKE:
+			err := accessService.RevokePermission(accessId)
+			if err != nil {
+				log.Println("CloseCampaign: Revoke failed ", accessId, err)
+				failed = append(failed, utils.Map{business_common.FLD_APP_ACCESS_ID: accessId, "error": err.Error()})
+				continue
+			}
+			revoked = append(revoked, accessId)
+		default:
+			undecided = append(undecided, accessId)
+		}
+	}
+
+	closedAt := formatDateTime(time.Now())
+	report := utils.Map{
+		FLD_REVIEW_ID:        reviewId,
+		FLD_REVIEW_CLOSED_AT: closedAt,
+		FLD_REVIEW_CLOSED_BY: reviewerId,
+		FLD_REVIEW_KEPT:      kept,
+		FLD_REVIEW_REVOKED:   revoked,
+		FLD_REVIEW_UNDECIDED: undecided,
+		FLD_FAILED:           failed,
+	}
+
+	_, err = p.daoReview.Update(reviewId, utils.Map{
+		FLD_REVIEW_STATUS:    REVIEW_STATUS_CLOSED,
+		FLD_REVIEW_CLOSED_AT: closedAt,
+		FLD_REVIEW_CLOSED_BY: reviewerId,
+		FLD_REVIEW_REPORT:    report,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AccessReviewService::CloseCampaign - End ", len(revoked), len(failed))
+	return report, nil
+}
+
+// getOpenCampaign - Get the campaign and its items, closed campaigns are immutable
+func (p *accessReviewBaseService) getOpenCampaign(reviewId string) (utils.Map, []utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	dataReview, err := p.daoReview.Get(reviewId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid review_id", ErrorDetail: "Given review_id is not exist"}
+		return nil, nil, err
+	}
+
+	if status, _ := utils.GetMemberDataStr(dataReview, FLD_REVIEW_STATUS); status != REVIEW_STATUS_OPEN {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Campaign closed", ErrorDetail: "Closed campaigns cannot be changed"}
+		return nil, nil, err
+	}
+
+	return dataReview, getMemberDataMapArray(dataReview, FLD_REVIEW_ITEMS), nil
+}
+
+func (p *accessReviewBaseService) errorReturn(err error) (AccessReviewService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
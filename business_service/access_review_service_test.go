@@ -0,0 +1,67 @@
+package business_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testReviewService - AccessReviewService of an open campaign over the given grants
+func testReviewService(accessIds ...string) (*accessReviewBaseService, *fakeCollectionDao) {
+	items := []utils.Map{}
+	for _, accessId := range accessIds {
+		items = append(items, utils.Map{business_common.FLD_APP_ACCESS_ID: accessId, FLD_REVIEW_DECISION: ""})
+	}
+	daoReview := &fakeCollectionDao{idField: FLD_REVIEW_ID, records: []utils.Map{
+		{FLD_REVIEW_ID: "review1", FLD_REVIEW_STATUS: REVIEW_STATUS_OPEN, FLD_REVIEW_ITEMS: items},
+	}}
+	p := &accessReviewBaseService{daoReview: daoReview, daoBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE), businessID: "biz1"}
+	return p, daoReview
+}
+
+func TestRecordDecision(t *testing.T) {
+	p, daoReview := testReviewService("aces1", "aces2")
+
+	// The fake Update panics, the decision must not rewrite the whole campaign
+	decisions := map[string]string{"aces1": REVIEW_DECISION_KEEP, "aces2": REVIEW_DECISION_REVOKE}
+	for accessId, decision := range decisions {
+		dataItem, err := p.RecordDecision("review1", accessId, utils.Map{FLD_REVIEW_DECISION: decision, FLD_REVIEW_REVIEWER_ID: "user1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dataItem[FLD_REVIEW_DECISION] != decision || dataItem[business_common.FLD_APP_ACCESS_ID] != accessId {
+			t.Errorf("RecordDecision(%s) = %v, want %s", accessId, dataItem, decision)
+		}
+	}
+
+	for _, item := range getMemberDataMapArray(daoReview.records[0], FLD_REVIEW_ITEMS) {
+		accessId, _ := utils.GetMemberDataStr(item, business_common.FLD_APP_ACCESS_ID)
+		if item[FLD_REVIEW_DECISION] != decisions[accessId] || item[FLD_REVIEW_REVIEWER_ID] != "user1" {
+			t.Errorf("stored item %v, want decision %s by user1", item, decisions[accessId])
+		}
+	}
+}
+
+func TestRecordDecisionInvalid(t *testing.T) {
+	p, _ := testReviewService("aces1")
+
+	tests := []struct {
+		name     string
+		accessId string
+		indata   utils.Map
+	}{
+		{"invalid decision", "aces1", utils.Map{FLD_REVIEW_DECISION: "maybe", FLD_REVIEW_REVIEWER_ID: "user1"}},
+		{"missing reviewer", "aces1", utils.Map{FLD_REVIEW_DECISION: REVIEW_DECISION_KEEP}},
+		{"grant not in campaign", "aces9", utils.Map{FLD_REVIEW_DECISION: REVIEW_DECISION_KEEP, FLD_REVIEW_REVIEWER_ID: "user1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var appErr *utils.AppError
+			if _, err := p.RecordDecision("review1", tt.accessId, tt.indata); !errors.As(err, &appErr) {
+				t.Errorf("RecordDecision = %v, want an AppError", err)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package business_service
 import (
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-business-repository/business_repository"
 	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
 	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
@@ -19,6 +22,13 @@ type AccessService interface {
 
 	GrantPermission(indata utils.Map) (utils.Map, error)
 	RevokePermission(access_id string) error
+	SweepExpiredGrants(now time.Time) (utils.Map, error)
+
+	CheckPermission(userId string, siteId string, permission string) (bool, error)
+	CheckPermissionOnUser(userId string, targetUserId string, siteId string, permission string) (bool, error)
+	CheckPermissionInBusiness(userId string, businessId string, permission string) (bool, error)
+	ListVisibleBusinesses(userId string, permission string) (utils.Map, error)
+	EffectivePermissions(userId string, siteId string) (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -35,12 +45,16 @@ type accessBaseService struct {
 	daoUser   business_repository.UserDao
 	daoRole   business_repository.RoleDao
 	daoSite   business_repository.SiteDao
-
-	daoSysUser  platform_repository.SysUserDao
-	daoSysRole  platform_repository.SysRoleDao
-	daoBusiness platform_repository.BusinessDao
-	child       AccessService
-	businessID  string
+	daoGroup  collectionDao
+
+	daoSysUser     platform_repository.SysUserDao
+	daoSysRole     platform_repository.SysRoleDao
+	daoBusiness    platform_repository.BusinessDao
+	child          AccessService
+	businessID     string
+	businessStatus string
+	// Shared with a service which verified the business is writable for the operation
+	shared bool
 }
 
 func init() {
@@ -78,7 +92,7 @@ func NewAccessService(props utils.Map) (AccessService, error) {
 	p.initializeService()
 
 	// Verify the given businessId is exist
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -87,11 +101,27 @@ func NewAccessService(props utils.Map) (AccessService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
 }
 
+// newSharedAccessService - AccessService on the open databases of another service, so its changes
+// are part of that service's transactions. The databases stay with the caller, do not call EndService.
+// The caller verifies the business is writable before its operation, the shared service does not read it again.
+func newSharedAccessService(db db_utils.DatabaseService, dbRegion db_utils.DatabaseService, businessId string, businessStatus string) AccessService {
+	p := accessBaseService{DatabaseService: db, dbRegion: dbRegion, businessID: businessId, businessStatus: businessStatus, shared: true}
+	p.initializeService()
+	p.child = &p
+	return &p
+}
+
 func (p *accessBaseService) EndService() {
 	log.Printf("EndAccessService ")
 	p.CloseDatabaseService()
@@ -104,12 +134,21 @@ func (p *accessBaseService) initializeService() {
 	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoRole = business_repository.NewRoleDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoGroup = newGroupDao(p.dbRegion.GetClient(), p.businessID)
 
 	p.daoSysUser = platform_repository.NewSysUserDao(p.GetClient())
 	p.daoSysRole = platform_repository.NewSysRoleDao(p.GetClient())
 	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
 }
 
+// verifyWritable - Verify the business is writable, unless the service is shared with a caller which did
+func (p *accessBaseService) verifyWritable() error {
+	if p.shared {
+		return nil
+	}
+	return verifyBusinessWritable(p.daoBusiness, p.businessID)
+}
+
 func (p *accessBaseService) getServiceModuleCode() string {
 	return business_common.GetServiceModuleCode() + "05"
 }
@@ -119,6 +158,9 @@ func (p *accessBaseService) List(sys_filter string, filter string, sort string,
 
 	log.Println("AccessService::FindAll - Begin")
 
+	// Ignore the grants which are expired or not yet valid
+	filter = activeGrantFilter(filter, time.Now())
+
 	daoAccess := p.daoAccess
 	response, err := daoAccess.List(sys_filter, filter, sort, skip, limit)
 	if err != nil {
@@ -133,7 +175,13 @@ func (p *accessBaseService) List(sys_filter string, filter string, sort string,
 func (p *accessBaseService) Get(access_id string) (utils.Map, error) {
 	log.Printf("AccessService::FindByCode::  Begin %v", access_id)
 
+	funcode := p.getServiceModuleCode() + "02"
+
 	data, err := p.daoAccess.Get(access_id)
+	if err == nil && !isGrantActive(data, time.Now()) {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Access not found", ErrorDetail: "Given access is expired or not yet valid"}
+		return nil, err
+	}
 	log.Println("AccessService::FindByCode:: End ", err)
 	return data, err
 }
@@ -153,8 +201,24 @@ func (p *accessBaseService) GrantPermission(indata utils.Map) (utils.Map, error)
 
 	log.Println("AccessService::Update - Begin")
 
-	access_key := ""
-	if valUserId, okUserId := indata[business_common.FLD_USER_ID]; !okUserId {
+	if err := p.verifyWritable(); err != nil {
+		return nil, err
+	}
+
+	// A grant targets either a user or a group
+	userId, siteId := "", ""
+	valUserId, okUserId := indata[business_common.FLD_USER_ID]
+	if valGroupId, okGroupId := indata[FLD_GROUP_ID]; okGroupId && okUserId {
+		err := &utils.AppError{ErrorCode: funcode + "07", ErrorMsg: "Invalid grant", ErrorDetail: "Grant should target either user_id or group_id"}
+		return indata, err
+	} else if okGroupId {
+		if _, err := p.daoGroup.Get(valGroupId.(string)); err != nil {
+			log.Println("GrantPermission: GroupId not found  ", valGroupId)
+			err := &utils.AppError{ErrorCode: funcode + "08", ErrorMsg: "GroupId not found ", ErrorDetail: "GroupId not found "}
+			return indata, err
+		}
+		userId = GROUP_ACCESS_PREFIX + valGroupId.(string)
+	} else if !okUserId {
 		log.Println("GrantPermission: UserId not found  ", valUserId)
 		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "UserId not found ", ErrorDetail: "UserId not found "}
 		return indata, err
@@ -163,11 +227,11 @@ func (p *accessBaseService) GrantPermission(indata utils.Map) (utils.Map, error)
 		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "UserId not found ", ErrorDetail: "UserId not found "}
 		return indata, err
 	} else {
-		access_key += valUserId.(string)
+		userId = valUserId.(string)
 	}
 
 	valRoleId, okRoleId := indata[business_common.FLD_ROLE_ID]
-	valSysRoleId, okSysRoleId := indata["app_role_id"]
+	valSysRoleId, okSysRoleId := indata[FLD_APP_ROLE_ID]
 
 	if !okRoleId && !okSysRoleId {
 		log.Println("GrantPermission: Missing RoleId ")
@@ -195,24 +259,57 @@ func (p *accessBaseService) GrantPermission(indata utils.Map) (utils.Map, error)
 
 	if valSiteId, okSiteId := indata[business_common.FLD_APP_SITE_ID]; !okSiteId {
 		// Ignore Site Id Field
-		access_key = "-" + access_key
 	} else if _, err := p.daoSite.Get(valSiteId.(string)); err != nil {
 		log.Println("GrantPermission: RoleId not found  ", valSiteId)
 		err := &utils.AppError{ErrorCode: funcode + "04", ErrorMsg: "UserId not found ", ErrorDetail: "UserId not found "}
 		return indata, err
 	} else {
-		access_key += valSiteId.(string)
+		siteId = valSiteId.(string)
 	}
 
-	access_id := utils.GenerateChecksumId("aces", access_key)
-	dataAccess, err := p.daoAccess.Get(access_id)
+	scope, _ := utils.GetMemberDataStr(indata, FLD_GRANT_SCOPE)
+	if scope != GRANT_SCOPE_SELF && scope != GRANT_SCOPE_REPORTS {
+		err := &utils.AppError{ErrorCode: funcode + "06", ErrorMsg: "Invalid scope", ErrorDetail: "Grant scope should be empty or " + GRANT_SCOPE_REPORTS}
+		return indata, err
+	}
+
+	// Subsidiaries have their own sites, so only business-wide grants can extend to them
+	if include, err := utils.GetMemberDataBool(indata, FLD_INCLUDE_SUBSIDIARIES); err == nil && include && len(siteId) > 0 {
+		err := &utils.AppError{ErrorCode: funcode + "10", ErrorMsg: "Invalid grant", ErrorDetail: "Only business-wide grants can include subsidiaries"}
+		return indata, err
+	}
+
+	err := normaliseGrantValidity(indata)
 	if err != nil {
-		return dataAccess, err
+		err := &utils.AppError{ErrorCode: funcode + "05", ErrorMsg: "Invalid validity period", ErrorDetail: err.Error()}
+		return indata, err
+	}
+
+	// For group grants the userId holds the prefixed group id
+	access_id := generateAccessId(userId, siteId, scope)
+
+	// Auto-grants of the user type are kept apart from the manual grants
+	switch source, _ := utils.GetMemberDataStr(indata, FLD_GRANT_SOURCE); source {
+	case GRANT_SOURCE_MANUAL:
+	case GRANT_SOURCE_USERTYPE:
+		if !okRoleId || okSysRoleId || strings.HasPrefix(userId, GROUP_ACCESS_PREFIX) || scope != GRANT_SCOPE_SELF {
+			err := &utils.AppError{ErrorCode: funcode + "09", ErrorMsg: "Invalid grant source", ErrorDetail: "User type grants should give a role_id to a user"}
+			return indata, err
+		}
+		access_id = generateAutoAccessId(userId, siteId, valRoleId.(string))
+	default:
+		err := &utils.AppError{ErrorCode: funcode + "09", ErrorMsg: "Invalid grant source", ErrorDetail: "Grant source should be empty or " + GRANT_SOURCE_USERTYPE}
+		return indata, err
+	}
+	// A new grant is created, an existing one is replaced
+	_, err = p.daoAccess.Get(access_id)
+	if _, err := recordExists(err); err != nil {
+		return indata, err
 	}
 
 	indata[business_common.FLD_APP_ACCESS_ID] = access_id
 
-	dataAccess, err = p.daoAccess.GrantPermission(indata)
+	dataAccess, err := p.daoAccess.GrantPermission(indata)
 	log.Println("AccessService::Update - End ")
 	return dataAccess, err
 }
@@ -222,6 +319,18 @@ func (p *accessBaseService) RevokePermission(access_id string) error {
 
 	log.Println("AccessService::RevokePermission - Begin", access_id)
 
+	if err := p.verifyWritable(); err != nil {
+		return err
+	}
+
+	err := p.revokePermission(access_id)
+
+	log.Println("AccessService::RevokePermission - End", err)
+	return err
+}
+
+// revokePermission - Revoke the grant, the business is verified writable by the caller
+func (p *accessBaseService) revokePermission(access_id string) error {
 	daoUser := p.daoAccess
 	result, err := daoUser.RevokePermission(access_id)
 	if err != nil {
@@ -232,6 +341,386 @@ func (p *accessBaseService) RevokePermission(access_id string) error {
 	return nil
 }
 
+// SweepExpiredGrants - Revoke all the grants which expired at the given time and report them
+func (p *accessBaseService) SweepExpiredGrants(now time.Time) (utils.Map, error) {
+
+	log.Println("AccessService::SweepExpiredGrants - Begin", now)
+
+	if err := p.verifyWritable(); err != nil {
+		return nil, err
+	}
+
+	filter := buildFilter(utils.Map{FLD_VALID_UNTIL: utils.Map{"$lte": formatDateTime(now)}})
+	response, err := p.daoAccess.List("", filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	swept := []utils.Map{}
+	failed := []utils.Map{}
+	for _, dataGrant := range getListResult(response) {
+		accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+		err := p.revokePermission(accessId)
+		if err != nil {
+			log.Println("SweepExpiredGrants: Revoke failed ", accessId, err)
+			failed = append(failed, utils.Map{business_common.FLD_APP_ACCESS_ID: accessId, "error": err.Error()})
+			continue
+		}
+		swept = append(swept, dataGrant)
+	}
+
+	report := utils.Map{
+		FLD_SWEPT_AT:    formatDateTime(now),
+		FLD_SWEPT_COUNT: len(swept),
+		FLD_SWEPT:       swept,
+		FLD_FAILED:      failed,
+	}
+
+	log.Println("AccessService::SweepExpiredGrants - End", len(swept), len(failed))
+	return report, nil
+}
+
+// CheckPermission - Check whether the user may perform the permission on the given site
+func (p *accessBaseService) CheckPermission(userId string, siteId string, permission string) (bool, error) {
+
+	log.Println("AccessService::CheckPermission - Begin", userId, siteId, permission)
+
+	dataPermissions, err := p.EffectivePermissions(userId, siteId)
+	if err != nil {
+		return false, err
+	}
+
+	allowed := matchPermission(getMemberDataStrArray(dataPermissions, FLD_PERMISSIONS), permission)
+
+	log.Println("AccessService::CheckPermission - End", allowed)
+	return allowed, nil
+}
+
+// EffectivePermissions - Resolve the permissions of all the grants of the user for the given site.
+// Business-wide grants apply to every site, site grants apply only to their own site.
+// Grants given to the groups of the user count as the user's own grants.
+func (p *accessBaseService) EffectivePermissions(userId string, siteId string) (utils.Map, error) {
+
+	log.Println("AccessService::EffectivePermissions - Begin", userId, siteId)
+
+	response, err := p.resolvePermissions(userId, siteId, GRANT_SCOPE_SELF, false)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("AccessService::EffectivePermissions - End", response)
+	return response, nil
+}
+
+// CheckPermissionOnUser - Check whether the user may perform the permission on the target user.
+// Besides the own grants of the user, "reports" scoped grants apply when the target reports to the user.
+func (p *accessBaseService) CheckPermissionOnUser(userId string, targetUserId string, siteId string, permission string) (bool, error) {
+
+	log.Println("AccessService::CheckPermissionOnUser - Begin", userId, targetUserId, siteId, permission)
+
+	allowed, err := p.CheckPermission(userId, siteId, permission)
+	if err != nil || allowed {
+		return allowed, err
+	}
+
+	reportIds, err := getReportingTreeIds(p.daoUser, userId)
+	if err != nil {
+		return false, err
+	}
+
+	isReport := false
+	for _, reportId := range reportIds {
+		if reportId == targetUserId {
+			isReport = true
+			break
+		}
+	}
+
+	if isReport {
+		dataPermissions, err := p.resolvePermissions(userId, siteId, GRANT_SCOPE_REPORTS, false)
+		if err != nil {
+			return false, err
+		}
+		allowed = matchPermission(getMemberDataStrArray(dataPermissions, FLD_PERMISSIONS), permission)
+	}
+
+	log.Println("AccessService::CheckPermissionOnUser - End", allowed)
+	return allowed, nil
+}
+
+// CheckPermissionInBusiness - Check whether the user of this business may perform the permission in the given
+// business. In this business it is CheckPermission for the business-wide grants, in a subsidiary only the grants
+// made with include_subsidiaries count.
+func (p *accessBaseService) CheckPermissionInBusiness(userId string, businessId string, permission string) (bool, error) {
+
+	log.Println("AccessService::CheckPermissionInBusiness - Begin", userId, businessId, permission)
+
+	if businessId == p.businessID {
+		return p.CheckPermission(userId, "", permission)
+	}
+
+	ancestorIds, err := getBusinessAncestorIds(p.daoBusiness, businessId)
+	if err != nil {
+		return false, err
+	}
+	if !containsString(ancestorIds, p.businessID) {
+		log.Println("AccessService::CheckPermissionInBusiness - End, not a subsidiary")
+		return false, nil
+	}
+
+	dataPermissions, err := p.resolvePermissions(userId, "", GRANT_SCOPE_SELF, true)
+	if err != nil {
+		return false, err
+	}
+	allowed := matchPermission(getMemberDataStrArray(dataPermissions, FLD_PERMISSIONS), permission)
+
+	log.Println("AccessService::CheckPermissionInBusiness - End", allowed)
+	return allowed, nil
+}
+
+// ListVisibleBusinesses - List the ids of this business and its subsidiaries where the user may perform the permission,
+// for consolidated views across the group of companies
+func (p *accessBaseService) ListVisibleBusinesses(userId string, permission string) (utils.Map, error) {
+
+	log.Println("AccessService::ListVisibleBusinesses - Begin", userId, permission)
+
+	businessIds := []string{}
+
+	allowed, err := p.CheckPermission(userId, "", permission)
+	if err != nil {
+		return nil, err
+	}
+	if allowed {
+		businessIds = append(businessIds, p.businessID)
+	}
+
+	dataPermissions, err := p.resolvePermissions(userId, "", GRANT_SCOPE_SELF, true)
+	if err != nil {
+		return nil, err
+	}
+	if matchPermission(getMemberDataStrArray(dataPermissions, FLD_PERMISSIONS), permission) {
+		descendantIds, err := getBusinessDescendantIds(p.daoBusiness, p.businessID)
+		if err != nil {
+			return nil, err
+		}
+		businessIds = append(businessIds, descendantIds...)
+	}
+
+	response := utils.Map{
+		business_common.FLD_USER_ID: userId,
+		FLD_PERMISSION:              permission,
+		FLD_BUSINESS_IDS:            businessIds,
+	}
+
+	log.Println("AccessService::ListVisibleBusinesses - End", businessIds)
+	return response, nil
+}
+
+// resolvePermissions - Resolve the permissions of the user's grants with the given scope for the site
+// With subsidiaries only the grants which extend to the subsidiary businesses are resolved.
+func (p *accessBaseService) resolvePermissions(userId string, siteId string, scope string, subsidiaries bool) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	dataUser, err := p.daoUser.Get(userId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "UserId not found ", ErrorDetail: "Given user_id is not exist"}
+		return nil, err
+	}
+
+	permissions := map[string]bool{}
+	roleIds := map[string]bool{}
+	appRoleIds := map[string]bool{}
+	accessIds := []string{}
+	groupIds := []string{}
+
+	// Only active users have permissions
+	userStatus := getUserStatus(dataUser)
+	if userStatus == USER_STATUS_ACTIVE {
+		groupIds, err = getUserGroupIds(p.daoGroup, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		dataGrants, err := p.getUserGrants(userId, groupIds, siteId, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dataGrant := range dataGrants {
+			if include, _ := utils.GetMemberDataBool(dataGrant, FLD_INCLUDE_SUBSIDIARIES); subsidiaries && !include {
+				continue
+			}
+			accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+			accessIds = append(accessIds, accessId)
+
+			if roleId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_ROLE_ID); len(roleId) > 0 && !roleIds[roleId] {
+				rolePermissions, _, _, err := resolveRolePermissions(p.daoRole, roleId)
+				if err != nil {
+					log.Println("EffectivePermissions: RoleId not found ", roleId, err)
+				}
+				for _, permission := range rolePermissions {
+					permissions[permission] = true
+				}
+				roleIds[roleId] = true
+			}
+
+			if appRoleId, _ := utils.GetMemberDataStr(dataGrant, FLD_APP_ROLE_ID); len(appRoleId) > 0 && !appRoleIds[appRoleId] {
+				appRolePermissions, err := p.getAppRolePermissions(appRoleId)
+				if err != nil {
+					log.Println("EffectivePermissions: App RoleId not found ", appRoleId, err)
+				}
+				for _, permission := range appRolePermissions {
+					permissions[permission] = true
+				}
+				appRoleIds[appRoleId] = true
+			}
+		}
+	}
+
+	response := utils.Map{
+		business_common.FLD_USER_ID:     userId,
+		business_common.FLD_APP_SITE_ID: siteId,
+		FLD_USER_STATUS:                 userStatus,
+		FLD_GRANT_SCOPE:                 scope,
+		FLD_PERMISSIONS:                 sortedKeys(permissions),
+		FLD_ROLES:                       sortedKeys(roleIds),
+		FLD_APP_ROLES:                   sortedKeys(appRoleIds),
+		FLD_GRANTS:                      accessIds,
+		FLD_GROUPS:                      groupIds,
+	}
+	return response, nil
+}
+
+// getUserGrants - Get the business-wide grants of the user and the grants for the given site with the given scope.
+// The grants of the groups the user is a member of are included.
+func (p *accessBaseService) getUserGrants(userId string, groupIds []string, siteId string, scope string) ([]utils.Map, error) {
+
+	filter := buildFilter(utils.Map{"$or": []utils.Map{
+		{business_common.FLD_USER_ID: userId},
+		{FLD_GROUP_ID: utils.Map{"$in": groupIds}},
+	}})
+	response, err := p.daoAccess.List("", filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dataGrants := []utils.Map{}
+	for _, dataGrant := range getListResult(response) {
+		if !isGrantActive(dataGrant, now) {
+			continue
+		}
+		if grantScope, _ := utils.GetMemberDataStr(dataGrant, FLD_GRANT_SCOPE); grantScope != scope {
+			continue
+		}
+		grantSiteId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_SITE_ID)
+		if len(grantSiteId) == 0 || grantSiteId == siteId {
+			dataGrants = append(dataGrants, dataGrant)
+		}
+	}
+	return dataGrants, nil
+}
+
+// getAppRolePermissions - Get the credentials of the platform role
+func (p *accessBaseService) getAppRolePermissions(appRoleId string) ([]string, error) {
+
+	dataRole, err := p.daoSysRole.Get(appRoleId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Admin role is allowed to do everything
+	if isAdmin, _ := utils.GetMemberDataBool(dataRole, platform_common.FLD_APP_ROLE_ISADMIN); isAdmin {
+		return []string{PERMISSION_ALL}, nil
+	}
+
+	dataCreds, err := p.daoSysRole.GetCredentials(appRoleId)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := []string{}
+	if listCreds, ok := dataCreds["credentials"].([]utils.Map); ok {
+		for _, dataCred := range listCreds {
+			if credential, _ := utils.GetMemberDataStr(dataCred, platform_common.FLD_APP_ROLE_CREDENTIAL); len(credential) > 0 {
+				permissions = append(permissions, credential)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// generateAccessId - Generate the access id of the grant, business-wide grants are keyed with "-" prefix
+// and scoped grants with the scope suffix, so they never replace the plain grant of the same user and site
+func generateAccessId(userId string, siteId string, scope string) string {
+	access_key := userId
+	if len(siteId) == 0 {
+		access_key = "-" + access_key
+	} else {
+		access_key += siteId
+	}
+	if len(scope) > 0 {
+		access_key += ":" + scope
+	}
+	return utils.GenerateChecksumId("aces", access_key)
+}
+
+// normaliseGrantValidity - Validate the optional validity period and store it in the comparable format
+func normaliseGrantValidity(indata utils.Map) error {
+	var validFrom, validUntil time.Time
+
+	if dataVal, dataOk := indata[FLD_VALID_FROM]; dataOk && dataVal != nil {
+		parsed, err := parseDateTime(dataVal)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", FLD_VALID_FROM, dataVal)
+		}
+		validFrom = parsed
+		indata[FLD_VALID_FROM] = formatDateTime(validFrom)
+	}
+
+	if dataVal, dataOk := indata[FLD_VALID_UNTIL]; dataOk && dataVal != nil {
+		parsed, err := parseDateTime(dataVal)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", FLD_VALID_UNTIL, dataVal)
+		}
+		validUntil = parsed
+		indata[FLD_VALID_UNTIL] = formatDateTime(validUntil)
+	}
+
+	if !validFrom.IsZero() && !validUntil.IsZero() && !validUntil.After(validFrom) {
+		return fmt.Errorf("%s must be after %s", FLD_VALID_UNTIL, FLD_VALID_FROM)
+	}
+	return nil
+}
+
+// isGrantActive - Check whether the grant is valid at the given time
+func isGrantActive(dataGrant utils.Map, now time.Time) bool {
+	if dataVal, dataOk := dataGrant[FLD_VALID_FROM]; dataOk && dataVal != nil {
+		if validFrom, err := parseDateTime(dataVal); err == nil && now.Before(validFrom) {
+			return false
+		}
+	}
+	if dataVal, dataOk := dataGrant[FLD_VALID_UNTIL]; dataOk && dataVal != nil {
+		if validUntil, err := parseDateTime(dataVal); err == nil && !now.Before(validUntil) {
+			return false
+		}
+	}
+	return true
+}
+
+// activeGrantFilter - Restrict the given filter to the grants which are valid at the given time
+func activeGrantFilter(filter string, now time.Time) string {
+	nowStr := formatDateTime(now)
+
+	activeFilter := buildFilter(utils.Map{"$and": []utils.Map{
+		{"$or": []utils.Map{{FLD_VALID_FROM: nil}, {FLD_VALID_FROM: utils.Map{"$lte": nowStr}}}},
+		{"$or": []utils.Map{{FLD_VALID_UNTIL: nil}, {FLD_VALID_UNTIL: utils.Map{"$gt": nowStr}}}},
+	}})
+
+	return combineFilters(activeFilter, filter)
+}
+
 func (p *accessBaseService) errorReturn(err error) (AccessService, error) {
 	// Close the Database Connection
 	p.EndService()
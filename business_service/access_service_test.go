@@ -0,0 +1,208 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestMatchPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		granted    []string
+		permission string
+		want       bool
+	}{
+		{"exact", []string{"contact.view"}, "contact.view", true},
+		{"other action", []string{"contact.view"}, "contact.update", false},
+		{"everything", []string{PERMISSION_ALL}, "payment.delete", true},
+		{"module wildcard", []string{"contact.*"}, "contact.delete", true},
+		{"wildcard of other module", []string{"contact.*"}, "payment.view", false},
+		{"wildcard of module prefix", []string{"user.*"}, "usertype.view", false},
+		{"any of several", []string{"site.view", "contact.*"}, "contact.create", true},
+		{"nothing granted", nil, "contact.view", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchPermission(tt.granted, tt.permission); got != tt.want {
+				t.Errorf("matchPermission(%v, %s) = %v, want %v", tt.granted, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePermissions(t *testing.T) {
+	grants := []utils.Map{
+		{business_common.FLD_APP_ACCESS_ID: "aces_wide", business_common.FLD_ROLE_ID: "viewer"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_site", business_common.FLD_ROLE_ID: "editor", business_common.FLD_APP_SITE_ID: "site_1"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_group", business_common.FLD_ROLE_ID: "self", FLD_GROUP_ID: "grp_1",
+			FLD_INCLUDE_SUBSIDIARIES: true},
+		{business_common.FLD_APP_ACCESS_ID: "aces_reports", business_common.FLD_ROLE_ID: "cycle_a", FLD_GRANT_SCOPE: GRANT_SCOPE_REPORTS},
+		{business_common.FLD_APP_ACCESS_ID: "aces_expired", business_common.FLD_ROLE_ID: "orphan", FLD_VALID_UNTIL: "2020-01-01T00:00:00Z"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_missing", business_common.FLD_ROLE_ID: "deleted"},
+	}
+	service := &accessBaseService{
+		daoUser: &fakeUserDao{users: map[string]utils.Map{
+			"active":    {business_common.FLD_USER_ID: "active"},
+			"suspended": {business_common.FLD_USER_ID: "suspended", FLD_USER_STATUS: USER_STATUS_SUSPENDED},
+		}},
+		daoAccess: &fakeAccessDao{grants: grants},
+		daoRole:   testRoles(),
+		daoGroup:  &fakeCollectionDao{records: []utils.Map{{FLD_GROUP_ID: "grp_1"}}},
+	}
+
+	tests := []struct {
+		name            string
+		userId          string
+		siteId          string
+		scope           string
+		subsidiaries    bool
+		wantPermissions []string
+		wantGrants      []string
+	}{
+		{"business wide", "active", "", GRANT_SCOPE_SELF, false,
+			[]string{"contact.view", "user.view"}, []string{"aces_wide", "aces_group", "aces_missing"}},
+		{"site", "active", "site_1", GRANT_SCOPE_SELF, false,
+			[]string{"contact.update", "contact.view", "user.view"}, []string{"aces_wide", "aces_site", "aces_group", "aces_missing"}},
+		{"other site", "active", "site_2", GRANT_SCOPE_SELF, false,
+			[]string{"contact.view", "user.view"}, []string{"aces_wide", "aces_group", "aces_missing"}},
+		{"reports scope", "active", "", GRANT_SCOPE_REPORTS, false,
+			[]string{"contact.update", "contact.view", "site.update", "site.view"}, []string{"aces_reports"}},
+		{"subsidiaries", "active", "", GRANT_SCOPE_SELF, true, []string{"user.view"}, []string{"aces_group"}},
+		{"suspended user", "suspended", "site_1", GRANT_SCOPE_SELF, false, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := service.resolvePermissions(tt.userId, tt.siteId, tt.scope, tt.subsidiaries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := getMemberDataStrArray(response, FLD_PERMISSIONS); !reflect.DeepEqual(got, tt.wantPermissions) {
+				t.Errorf("permissions = %v, want %v", got, tt.wantPermissions)
+			}
+			if got := getMemberDataStrArray(response, FLD_GRANTS); !reflect.DeepEqual(got, tt.wantGrants) {
+				t.Errorf("grants = %v, want %v", got, tt.wantGrants)
+			}
+		})
+	}
+}
+
+func TestResolvePermissionsUnknownUser(t *testing.T) {
+	service := &accessBaseService{daoUser: &fakeUserDao{users: map[string]utils.Map{}}}
+	if _, err := service.resolvePermissions("unknown", "", GRANT_SCOPE_SELF, false); err == nil {
+		t.Error("resolvePermissions succeeded for an unknown user, want an error")
+	}
+}
+
+func TestNormaliseGrantValidity(t *testing.T) {
+	tests := []struct {
+		name      string
+		indata    utils.Map
+		wantFrom  any
+		wantUntil any
+		wantErr   bool
+	}{
+		{"not limited", utils.Map{}, nil, nil, false},
+		{"RFC3339 to UTC", utils.Map{FLD_VALID_FROM: "2026-10-12T10:00:00+02:00"}, "2026-10-12T08:00:00Z", nil, false},
+		{"date time is UTC", utils.Map{FLD_VALID_UNTIL: "2026-10-12 10:00:00"}, nil, "2026-10-12T10:00:00Z", false},
+		{"time value", utils.Map{FLD_VALID_FROM: time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)}, "2026-10-12T10:00:00Z", nil, false},
+		{"period", utils.Map{FLD_VALID_FROM: "2026-10-12T00:00:00Z", FLD_VALID_UNTIL: "2026-10-13T00:00:00Z"},
+			"2026-10-12T00:00:00Z", "2026-10-13T00:00:00Z", false},
+		{"invalid from", utils.Map{FLD_VALID_FROM: "tomorrow"}, nil, nil, true},
+		{"invalid until", utils.Map{FLD_VALID_UNTIL: 42}, nil, nil, true},
+		{"ends when it starts", utils.Map{FLD_VALID_FROM: "2026-10-12T00:00:00Z", FLD_VALID_UNTIL: "2026-10-12T00:00:00Z"}, nil, nil, true},
+		{"ends before it starts", utils.Map{FLD_VALID_FROM: "2026-10-13T00:00:00Z", FLD_VALID_UNTIL: "2026-10-12T00:00:00Z"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := normaliseGrantValidity(tt.indata)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normaliseGrantValidity error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := tt.indata[FLD_VALID_FROM]; got != tt.wantFrom {
+				t.Errorf("%s = %v, want %v", FLD_VALID_FROM, got, tt.wantFrom)
+			}
+			if got := tt.indata[FLD_VALID_UNTIL]; got != tt.wantUntil {
+				t.Errorf("%s = %v, want %v", FLD_VALID_UNTIL, got, tt.wantUntil)
+			}
+		})
+	}
+}
+
+func TestIsGrantActive(t *testing.T) {
+	now := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		grant utils.Map
+		want  bool
+	}{
+		{"not limited", utils.Map{}, true},
+		{"null limits", utils.Map{FLD_VALID_FROM: nil, FLD_VALID_UNTIL: nil}, true},
+		{"started", utils.Map{FLD_VALID_FROM: "2026-10-12T10:00:00Z"}, true},
+		{"not started", utils.Map{FLD_VALID_FROM: "2026-10-12T10:00:01Z"}, false},
+		{"not ended", utils.Map{FLD_VALID_UNTIL: "2026-10-12T10:00:01Z"}, true},
+		{"ended", utils.Map{FLD_VALID_UNTIL: "2026-10-12T10:00:00Z"}, false},
+		{"in period", utils.Map{FLD_VALID_FROM: "2026-10-01T00:00:00Z", FLD_VALID_UNTIL: "2026-11-01T00:00:00Z"}, true},
+		{"other offset", utils.Map{FLD_VALID_UNTIL: "2026-10-12T11:00:00+02:00"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGrantActive(tt.grant, now); got != tt.want {
+				t.Errorf("isGrantActive(%v) = %v, want %v", tt.grant, got, tt.want)
+			}
+		})
+	}
+}
+
+// testGrantService - AccessService of an active business with one user and the test roles
+func testGrantService(daoAccess *fakeAccessDao) *accessBaseService {
+	return &accessBaseService{
+		daoAccess:   daoAccess,
+		daoUser:     &fakeUserDao{users: map[string]utils.Map{"user1": {business_common.FLD_USER_ID: "user1"}}},
+		daoRole:     testRoles(),
+		daoBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE),
+		businessID:  "biz1",
+	}
+}
+
+func TestGrantPermission(t *testing.T) {
+	daoAccess := &fakeAccessDao{}
+	p := testGrantService(daoAccess)
+	accessId := generateAccessId("user1", "", GRANT_SCOPE_SELF)
+
+	// New grant
+	if _, err := p.GrantPermission(utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer"}); err != nil {
+		t.Fatalf("new grant: %v", err)
+	}
+	if len(daoAccess.grants) != 1 || daoAccess.grants[0][business_common.FLD_APP_ACCESS_ID] != accessId {
+		t.Fatalf("grants = %v, want one grant %s", daoAccess.grants, accessId)
+	}
+
+	// Re-grant replaces the role of the same grant
+	if _, err := p.GrantPermission(utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "editor"}); err != nil {
+		t.Fatalf("re-grant: %v", err)
+	}
+	if len(daoAccess.grants) != 1 || daoAccess.grants[0][business_common.FLD_ROLE_ID] != "editor" {
+		t.Errorf("grants = %v, want the one grant with role editor", daoAccess.grants)
+	}
+}
+
+func TestGrantPermissionLookupFailure(t *testing.T) {
+	daoAccess := &fakeAccessDao{getErr: errors.New("connection lost")}
+	p := testGrantService(daoAccess)
+
+	_, err := p.GrantPermission(utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer"})
+	if err == nil || err.Error() != "connection lost" {
+		t.Errorf("GrantPermission = %v, want the lookup error", err)
+	}
+	if len(daoAccess.grants) > 0 {
+		t.Errorf("granted %v after the lookup failed", daoAccess.grants)
+	}
+}
@@ -0,0 +1,521 @@
+package business_service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Archive fields
+const (
+	FLD_ARCHIVE_FORMAT      = "format"
+	FLD_ARCHIVE_VERSION     = "version"
+	FLD_ARCHIVE_SOURCE_ID   = "source_business_id"
+	FLD_ARCHIVE_EXPORTED_AT = "exported_at"
+	FLD_ARCHIVE_BUSINESS    = "business"
+	FLD_ARCHIVE_COLLECTIONS = "collections"
+
+	// Old id to new id of every imported record, by collection
+	FLD_ID_MAP = "id_map"
+
+	// State of the import in the platform business record
+	FLD_ARCHIVE_IMPORT     = "archive_import"
+	FLD_IMPORT_STATE       = "state"
+	FLD_IMPORT_STARTED_AT  = "started_at"
+	FLD_IMPORT_FINISHED_AT = "finished_at"
+
+	ARCHIVE_FORMAT  = "business-archive"
+	ARCHIVE_VERSION = 1
+
+	// Records imported and committed at a time
+	ARCHIVE_IMPORT_BATCH_SIZE = 100
+)
+
+// Archive import states
+const (
+	IMPORT_STATE_IMPORTING = "importing"
+	IMPORT_STATE_DONE      = "done"
+)
+
+// Business record fields which are not taken from an archive, the plan and the state of the business
+// are its own. Settings are validated, they are written through UpdateSettings.
+var archiveExcludedFields = []string{
+	FLD_FEATURES,
+	FLD_QUOTAS,
+	FLD_SETTINGS,
+	FLD_BUSINESS_STATUS,
+	FLD_PARENT_BUSINESS_ID,
+	FLD_TEARDOWN,
+	FLD_MIGRATION,
+	FLD_ARCHIVE_IMPORT,
+}
+
+// archiveCollections - The collections of an archive, all but the business record which is archived on its own
+func archiveCollections() []businessCollection {
+	collections := []businessCollection{}
+	for _, entity := range businessCollections() {
+		if entity.collection != COLLECTION_BUSINESS {
+			collections = append(collections, entity)
+		}
+	}
+	return collections
+}
+
+// Export - Export everything of the business as a versioned archive
+func (p *businessBaseService) Export() (utils.Map, error) {
+
+	log.Println("BusinessService::Export - Begin", p.businessID)
+
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := p.exportCollections(nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := utils.Map{
+		FLD_ARCHIVE_FORMAT:      ARCHIVE_FORMAT,
+		FLD_ARCHIVE_VERSION:     ARCHIVE_VERSION,
+		FLD_ARCHIVE_SOURCE_ID:   p.businessID,
+		FLD_ARCHIVE_EXPORTED_AT: formatDateTime(time.Now()),
+		FLD_ARCHIVE_BUSINESS:    cleanArchiveRecord(dataBusiness),
+		FLD_ARCHIVE_COLLECTIONS: collections,
+	}
+
+	log.Println("BusinessService::Export - End")
+	return archive, nil
+}
+
+// Import - Import the archive into this business, which has to be new or empty.
+// All ids are rewritten with checksum ids of the new business, so importing the same
+// archive into another business gives the same ids there. Returns the id mapping.
+// Each collection is imported in batches, each batch committed on its own. The progress is kept in
+// the platform business record, so after an interruption importing the same archive again resumes:
+// the id mapping is the same and only the records not yet imported are created.
+func (p *businessBaseService) Import(archive utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("BusinessService::Import - Begin", p.businessID)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	format, _ := utils.GetMemberDataStr(archive, FLD_ARCHIVE_FORMAT)
+	version, _ := utils.GetMemberDataInt(archive, FLD_ARCHIVE_VERSION, true)
+	if format != ARCHIVE_FORMAT || version < 1 || version > ARCHIVE_VERSION {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid archive",
+			ErrorDetail: fmt.Sprintf("Supported archive is %s version 1 to %d", ARCHIVE_FORMAT, ARCHIVE_VERSION)}
+		return nil, err
+	}
+
+	dataPlatform, err := p.daoPlatformBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceId, _ := utils.GetMemberDataStr(archive, FLD_ARCHIVE_SOURCE_ID)
+	exportedAt, _ := utils.GetMemberDataStr(archive, FLD_ARCHIVE_EXPORTED_AT)
+
+	state, ok := getMemberDataMap(dataPlatform, FLD_ARCHIVE_IMPORT)
+	if stateName, _ := utils.GetMemberDataStr(state, FLD_IMPORT_STATE); ok && stateName == IMPORT_STATE_IMPORTING {
+		stateSource, _ := utils.GetMemberDataStr(state, FLD_ARCHIVE_SOURCE_ID)
+		stateExportedAt, _ := utils.GetMemberDataStr(state, FLD_ARCHIVE_EXPORTED_AT)
+		if stateSource != sourceId || stateExportedAt != exportedAt {
+			err := &utils.AppError{ErrorCode: funcode + "04", ErrorMsg: "Import in progress",
+				ErrorDetail: fmt.Sprintf("Import of the archive of %s exported at %s is not finished, import it again to resume", stateSource, stateExportedAt)}
+			return nil, err
+		}
+	} else {
+		err := p.verifyEmpty(funcode)
+		if err != nil {
+			return nil, err
+		}
+
+		state = utils.Map{
+			FLD_ARCHIVE_SOURCE_ID:   sourceId,
+			FLD_ARCHIVE_EXPORTED_AT: exportedAt,
+			FLD_IMPORT_STATE:        IMPORT_STATE_IMPORTING,
+			FLD_IMPORT_STARTED_AT:   formatDateTime(time.Now()),
+		}
+		_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_ARCHIVE_IMPORT: state})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.dbRegion.BeginTransaction()
+	err = p.importBusinessRecord(archive)
+	if err != nil {
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
+	p.dbRegion.CommitTransaction()
+
+	collections, _ := getMemberDataMap(archive, FLD_ARCHIVE_COLLECTIONS)
+	idMap, _, err := p.importCollections(funcode, collections, false)
+	if err != nil {
+		// Stays in importing, so the next run resumes
+		return nil, err
+	}
+
+	state[FLD_IMPORT_STATE] = IMPORT_STATE_DONE
+	state[FLD_IMPORT_FINISHED_AT] = formatDateTime(time.Now())
+	_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_ARCHIVE_IMPORT: state})
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		business_common.FLD_BUSINESS_ID: p.businessID,
+		FLD_ARCHIVE_SOURCE_ID:           sourceId,
+		FLD_ID_MAP:                      idMap,
+	}
+
+	log.Println("BusinessService::Import - End")
+	return response, nil
+}
+
+// exportCollections - Export the records of the given collections, all of them when nil.
+// With withDeleted the records are exported as stored, deleted ones and their deleted flag included.
+func (p *businessBaseService) exportCollections(kinds map[string]bool, withDeleted bool) (utils.Map, error) {
+	collections := utils.Map{}
+	for _, entity := range archiveCollections() {
+		if kinds != nil && !kinds[entity.collection] {
+			continue
+		}
+
+		records, err := exportRecords(entity.dao(p.dbRegion.GetClient(), p.businessID), withDeleted)
+		if err != nil {
+			return nil, err
+		}
+		collections[entity.collection] = records
+	}
+	return collections, nil
+}
+
+// exportRecords - The records of the collection without their database and business ids
+func exportRecords(dao collectionDao, withDeleted bool) ([]utils.Map, error) {
+	var records []utils.Map
+	if withDeleted {
+		stored, err := dao.ListAll()
+		if err != nil {
+			return nil, err
+		}
+		records = stored
+	} else {
+		response, err := dao.List("", "", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		records = getListResult(response)
+	}
+
+	exported := []utils.Map{}
+	for _, record := range records {
+		exported = append(exported, cleanArchiveRecord(record))
+	}
+	return exported, nil
+}
+
+// importCollections - Create the records in this business with rewritten ids and references, in batches
+// of ARCHIVE_IMPORT_BATCH_SIZE records each committed on its own. Records already existing under their
+// new id, deleted ones included, are skipped, so an interrupted copy can be repeated.
+// With strict, references to records which are not copied are dropped and grants of users who are
+// not in this business are skipped. Returns the old to new id mapping and the skipped ids by collection.
+func (p *businessBaseService) importCollections(funcode string, collections utils.Map, strict bool) (utils.Map, utils.Map, error) {
+	entities := archiveCollections()
+
+	// All new ids first, so that references in any direction can be rewritten
+	idMap := map[string]map[string]string{}
+	for _, entity := range entities {
+		ids := map[string]string{}
+		for _, record := range getMemberDataMapArray(collections, entity.collection) {
+			oldId, _ := utils.GetMemberDataStr(record, entity.idField)
+			if len(oldId) == 0 || entity.rekey {
+				continue
+			}
+			ids[oldId] = oldId
+			if len(entity.idPrefix) > 0 {
+				ids[oldId] = utils.GenerateChecksumId(entity.idPrefix, p.businessID+"_"+oldId)
+			}
+		}
+		idMap[entity.collection] = ids
+	}
+
+	skipped := utils.Map{}
+	for _, entity := range entities {
+		dao := entity.dao(p.dbRegion.GetClient(), p.businessID)
+		records := getMemberDataMapArray(collections, entity.collection)
+
+		existing, err := existingIds(entity, dao)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		skippedIds := []string{}
+		for start := 0; start < len(records); start += ARCHIVE_IMPORT_BATCH_SIZE {
+			end := start + ARCHIVE_IMPORT_BATCH_SIZE
+			if end > len(records) {
+				end = len(records)
+			}
+
+			// Platform and region databases are committed together
+			p.BeginTransaction()
+			p.dbRegion.BeginTransaction()
+
+			batchSkipped, err := p.importBatch(funcode, entity, dao, records[start:end], idMap, existing, strict)
+			if err != nil {
+				p.dbRegion.RollbackTransaction()
+				p.RollbackTransaction()
+				return nil, nil, err
+			}
+
+			p.dbRegion.CommitTransaction()
+			p.CommitTransaction()
+			skippedIds = append(skippedIds, batchSkipped...)
+		}
+		if len(skippedIds) > 0 {
+			skipped[entity.collection] = skippedIds
+		}
+	}
+
+	response := utils.Map{}
+	for collection, ids := range idMap {
+		if len(ids) > 0 {
+			response[collection] = ids
+		}
+	}
+	return response, skipped, nil
+}
+
+// importBatch - Create the records of the batch which do not exist yet, deleted records stay deleted.
+// Returns the ids of the records skipped with strict.
+func (p *businessBaseService) importBatch(funcode string, entity businessCollection, dao collectionDao, records []utils.Map,
+	idMap map[string]map[string]string, existing map[string]bool, strict bool) ([]string, error) {
+
+	skippedIds := []string{}
+	for _, record := range records {
+		data := utils.CopyMap(record)
+		data[business_common.FLD_BUSINESS_ID] = p.businessID
+
+		oldId, _ := utils.GetMemberDataStr(data, entity.idField)
+
+		// A grant losing its role, site or group would change its meaning
+		if strict && entity.rekey && (!hasAllReferences(data, entity.refs, idMap) || !p.isGrantTargetPresent(data)) {
+			skippedIds = append(skippedIds, oldId)
+			continue
+		}
+
+		for field, collection := range entity.refs {
+			rewriteReference(data, field, idMap[collection], strict)
+		}
+		if entity.rekey {
+			idMap[entity.collection][oldId] = grantAccessId(data)
+		}
+		newId := idMap[entity.collection][oldId]
+		data[entity.idField] = newId
+
+		if existing[newId] {
+			// Copied by an earlier run
+			continue
+		}
+
+		// Records exported without their deleted flag are live ones
+		deleted, err := utils.GetMemberDataBool(data, db_common.FLD_IS_DELETED)
+		if err != nil {
+			data = db_common.AmendFldsforCreate(data)
+		}
+
+		if len(entity.quota) > 0 && !deleted {
+			if err := checkQuota(p.dbRegion.GetClient(), p.businessID, entity.quota, 1); err != nil {
+				return nil, err
+			}
+		}
+
+		err = dao.Insert(data)
+		if err == nil && entity.collection == COLLECTION_USER && !deleted {
+			err = p.addArchivedMember(newId)
+		}
+		if err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Import failed",
+				ErrorDetail: fmt.Sprintf("%s %s: %v", entity.collection, oldId, err)}
+			return nil, err
+		}
+		existing[newId] = true
+	}
+	return skippedIds, nil
+}
+
+// existingIds - Ids of the records of the collection in this business, deleted ones included
+func existingIds(entity businessCollection, dao collectionDao) (map[string]bool, error) {
+	records, err := dao.ListAll()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	for _, record := range records {
+		id, _ := utils.GetMemberDataStr(record, entity.idField)
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// isGrantTargetPresent - Whether the user or the group the grant is given to exists in this business
+func (p *businessBaseService) isGrantTargetPresent(data utils.Map) bool {
+	if _, err := utils.GetMemberDataStr(data, FLD_GROUP_ID); err == nil {
+		// Copied along with the grant, see hasAllReferences
+		return true
+	}
+	userId, _ := utils.GetMemberDataStr(data, business_common.FLD_USER_ID)
+	_, err := p.daoUser.Get(userId)
+	return err == nil
+}
+
+// importBusinessRecord - Create or update the business record from the archive
+func (p *businessBaseService) importBusinessRecord(archive utils.Map) error {
+	dataBusiness, ok := getMemberDataMap(archive, FLD_ARCHIVE_BUSINESS)
+	if !ok {
+		dataBusiness = utils.Map{}
+	}
+	dataBusiness = utils.CopyMap(dataBusiness)
+	for _, field := range archiveExcludedFields {
+		delete(dataBusiness, field)
+	}
+
+	if _, err := p.daoBusiness.Get(p.businessID); err == nil {
+		delete(dataBusiness, business_common.FLD_BUSINESS_ID)
+		_, err := p.daoBusiness.Update(dataBusiness)
+		return err
+	}
+
+	dataBusiness[business_common.FLD_BUSINESS_ID] = p.businessID
+	_, err := p.daoBusiness.Create(dataBusiness)
+	return err
+}
+
+// addArchivedMember - Link the AppUser of an imported business user to the business when not yet linked
+func (p *businessBaseService) addArchivedMember(userId string) error {
+	accessId := utils.GetMD5Hash(p.businessID + "_" + userId)
+	if _, err := p.daoPlatformBusiness.GetAccessDetails(accessId); err == nil {
+		return nil
+	}
+
+	_, err := p.daoPlatformBusiness.AddUser(utils.Map{
+		platform_common.FLD_BUSINESS_USER_ID: accessId,
+		platform_common.FLD_BUSINESS_ID:      p.businessID,
+		platform_common.FLD_APP_USER_ID:      userId,
+	})
+	return err
+}
+
+// verifyEmpty - Verify the business has no records in any business scoped collection
+func (p *businessBaseService) verifyEmpty(funcode string) error {
+	for _, entity := range archiveCollections() {
+		records, err := entity.dao(p.dbRegion.GetClient(), p.businessID).Count()
+		if err != nil {
+			return err
+		}
+		if records > 0 {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Business not empty",
+				ErrorDetail: fmt.Sprintf("Business %s already has %d %s", p.businessID, records, entity.collection)}
+			return err
+		}
+	}
+	return nil
+}
+
+// hasAllReferences - Whether all the ids referred by the record are in the mapping
+func hasAllReferences(data utils.Map, refs map[string]string, idMap map[string]map[string]string) bool {
+	for field, collection := range refs {
+		for _, oldId := range referenceIds(data, field) {
+			if _, found := idMap[collection][oldId]; !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// referenceIds - The ids in the field, single id or list of ids, of the record or of its nested records
+func referenceIds(data utils.Map, field string) []string {
+	head, rest, nested := strings.Cut(field, ".")
+	if !nested {
+		return getMemberDataStrArray(data, field)
+	}
+
+	if dataNested, ok := getMemberDataMap(data, head); ok {
+		return referenceIds(dataNested, rest)
+	}
+	ids := []string{}
+	for _, record := range getMemberDataMapArray(data, head) {
+		ids = append(ids, referenceIds(record, rest)...)
+	}
+	return ids
+}
+
+// rewriteReference - Replace the ids in the field, single id or list of ids, with their new ids.
+// Ids not in the mapping refer to records outside the copied ones, they are kept unless strict.
+func rewriteReference(data utils.Map, field string, ids map[string]string, strict bool) {
+	head, rest, nested := strings.Cut(field, ".")
+	value, ok := data[head]
+	if !ok || value == nil {
+		return
+	}
+
+	// Nested records are rewritten in copies, the records given stay as they are
+	if nested {
+		if dataNested, ok := getMemberDataMap(data, head); ok {
+			dataNested = utils.CopyMap(dataNested)
+			rewriteReference(dataNested, rest, ids, strict)
+			data[head] = dataNested
+			return
+		}
+		records := []utils.Map{}
+		for _, record := range getMemberDataMapArray(data, head) {
+			record = utils.CopyMap(record)
+			rewriteReference(record, rest, ids, strict)
+			records = append(records, record)
+		}
+		data[head] = records
+		return
+	}
+
+	if oldId, isStr := value.(string); isStr {
+		if newId, found := ids[oldId]; found {
+			data[field] = newId
+		} else if strict {
+			delete(data, field)
+		}
+		return
+	}
+
+	newIds := []string{}
+	for _, oldId := range getMemberDataStrArray(data, field) {
+		if newId, found := ids[oldId]; found {
+			newIds = append(newIds, newId)
+		} else if !strict {
+			newIds = append(newIds, oldId)
+		}
+	}
+	data[field] = newIds
+}
+
+// cleanArchiveRecord - Remove the database and tenant specific fields from the record
+func cleanArchiveRecord(record utils.Map) utils.Map {
+	data := utils.CopyMap(record)
+	delete(data, "_id")
+	delete(data, business_common.FLD_BUSINESS_ID)
+	return data
+}
@@ -0,0 +1,143 @@
+package business_service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestRewriteReference(t *testing.T) {
+	ids := map[string]string{"role_1": "role_a", "role_2": "role_b"}
+
+	tests := []struct {
+		name   string
+		data   utils.Map
+		field  string
+		strict bool
+		want   utils.Map
+	}{
+		{"single id", utils.Map{"role_id": "role_1"}, "role_id", false, utils.Map{"role_id": "role_a"}},
+		{"unknown id kept", utils.Map{"role_id": "role_9"}, "role_id", false, utils.Map{"role_id": "role_9"}},
+		{"unknown id removed when strict", utils.Map{"role_id": "role_9"}, "role_id", true, utils.Map{}},
+		{"missing field", utils.Map{}, "role_id", true, utils.Map{}},
+		{"null field", utils.Map{"role_id": nil}, "role_id", true, utils.Map{"role_id": nil}},
+		{"list of ids", utils.Map{"parent_ids": []any{"role_1", "role_9", "role_2"}}, "parent_ids", false,
+			utils.Map{"parent_ids": []string{"role_a", "role_9", "role_b"}}},
+		{"list of ids when strict", utils.Map{"parent_ids": []string{"role_1", "role_9"}}, "parent_ids", true,
+			utils.Map{"parent_ids": []string{"role_a"}}},
+		{"nested records", utils.Map{"grants": []utils.Map{{"role_id": "role_1"}, {"role_id": "role_2"}}}, "grants.role_id", false,
+			utils.Map{"grants": []utils.Map{{"role_id": "role_a"}, {"role_id": "role_b"}}}},
+		{"nested record", utils.Map{"grant": utils.Map{"role_id": "role_2"}}, "grant.role_id", false,
+			utils.Map{"grant": utils.Map{"role_id": "role_b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewriteReference(tt.data, tt.field, ids, tt.strict)
+			if !reflect.DeepEqual(tt.data, tt.want) {
+				t.Errorf("rewriteReference = %v, want %v", tt.data, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteReferenceKeepsNestedRecords(t *testing.T) {
+	grant := utils.Map{"role_id": "role_1"}
+	data := utils.Map{"grants": []utils.Map{grant}}
+
+	rewriteReference(data, "grants.role_id", map[string]string{"role_1": "role_a"}, false)
+	if grant["role_id"] != "role_1" {
+		t.Errorf("nested record given changed to %v", grant)
+	}
+}
+
+func TestHasAllReferences(t *testing.T) {
+	idMap := map[string]map[string]string{
+		COLLECTION_ROLE: {"role_1": "role_a"},
+		COLLECTION_SITE: {"site_1": "site_a"},
+	}
+	refs := map[string]string{"role_ids": COLLECTION_ROLE, "grants.site_id": COLLECTION_SITE}
+
+	tests := []struct {
+		name string
+		data utils.Map
+		want bool
+	}{
+		{"no references", utils.Map{}, true},
+		{"all mapped", utils.Map{"role_ids": []string{"role_1"}, "grants": []utils.Map{{"site_id": "site_1"}}}, true},
+		{"list id missing", utils.Map{"role_ids": []string{"role_1", "role_2"}}, false},
+		{"nested id missing", utils.Map{"grants": []utils.Map{{"site_id": "site_1"}, {"site_id": "site_2"}}}, false},
+		{"other collection", utils.Map{"role_ids": []string{"site_1"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasAllReferences(tt.data, refs, idMap); got != tt.want {
+				t.Errorf("hasAllReferences(%v) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportRecordsWithDeleted(t *testing.T) {
+	dao := &fakeCollectionDao{idField: business_common.FLD_APP_CONTACT_ID, records: []utils.Map{
+		{"_id": "oid1", business_common.FLD_BUSINESS_ID: "biz1", business_common.FLD_APP_CONTACT_ID: "cont_1", db_common.FLD_IS_DELETED: false},
+		{"_id": "oid2", business_common.FLD_BUSINESS_ID: "biz1", business_common.FLD_APP_CONTACT_ID: "cont_2", db_common.FLD_IS_DELETED: true},
+	}}
+
+	records, err := exportRecords(dao, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []utils.Map{
+		{business_common.FLD_APP_CONTACT_ID: "cont_1", db_common.FLD_IS_DELETED: false},
+		{business_common.FLD_APP_CONTACT_ID: "cont_2", db_common.FLD_IS_DELETED: true},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("exportRecords = %v, want %v", records, want)
+	}
+}
+
+func TestImportBatch(t *testing.T) {
+	entity := businessCollection{collection: COLLECTION_CONTACT, idField: business_common.FLD_APP_CONTACT_ID, idPrefix: "cont"}
+	p := &businessBaseService{businessID: "biz2"}
+	newId := func(oldId string) string {
+		return utils.GenerateChecksumId("cont", "biz2_"+oldId)
+	}
+	idMap := map[string]map[string]string{COLLECTION_CONTACT: {
+		"cont_1": newId("cont_1"), "cont_2": newId("cont_2"), "cont_3": newId("cont_3"),
+	}}
+
+	// cont_1 was imported by an interrupted run
+	dao := &fakeCollectionDao{idField: business_common.FLD_APP_CONTACT_ID, records: []utils.Map{
+		{business_common.FLD_APP_CONTACT_ID: newId("cont_1"), "name": "imported"},
+	}}
+	existing, err := existingIds(entity, dao)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []utils.Map{
+		{business_common.FLD_APP_CONTACT_ID: "cont_1", "name": "archived", db_common.FLD_IS_DELETED: false},
+		{business_common.FLD_APP_CONTACT_ID: "cont_2", db_common.FLD_IS_DELETED: true},
+		{business_common.FLD_APP_CONTACT_ID: "cont_3"},
+	}
+	if _, err := p.importBatch("test", entity, dao, records, idMap, existing, false); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := map[string]utils.Map{}
+	for _, record := range dao.records {
+		stored[record[business_common.FLD_APP_CONTACT_ID].(string)] = record
+	}
+	if len(dao.records) != 3 || stored[newId("cont_1")]["name"] != "imported" {
+		t.Errorf("records = %v, want cont_1 kept and cont_2, cont_3 added", dao.records)
+	}
+	if dataContact := stored[newId("cont_2")]; dataContact[db_common.FLD_IS_DELETED] != true || dataContact[business_common.FLD_BUSINESS_ID] != "biz2" {
+		t.Errorf("cont_2 = %v, want it deleted in biz2", dataContact)
+	}
+	if dataContact := stored[newId("cont_3")]; dataContact[db_common.FLD_IS_DELETED] != false {
+		t.Errorf("cont_3 = %v, want it live", dataContact)
+	}
+}
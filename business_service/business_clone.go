@@ -0,0 +1,105 @@
+package business_service
+
+import (
+	"log"
+	"strings"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Clone report fields
+const (
+	FLD_CLONE_TARGET_ID = "target_business_id"
+	FLD_CLONE_SELECTION = "selection"
+	FLD_CLONE_SKIPPED   = "skipped"
+)
+
+// cloneKinds - The configuration collections which can be cloned, contacts and payments never are
+var cloneKinds = []string{
+	COLLECTION_TERRITORY,
+	COLLECTION_SITE,
+	COLLECTION_ROLE,
+	COLLECTION_USERTYPE,
+	COLLECTION_ACCESS,
+}
+
+// CloneBusiness - Copy the selected kinds of configuration from the source business into the target
+// business, all of them when the selection is empty. New ids are checksum ids of the target business,
+// references to records which are not copied are dropped, and grants are copied only for users already
+// in the target business and when their role and site are copied too. Repeating a clone copies only
+// what is missing. Returns the old to new id mapping and the skipped records.
+func (p *businessBaseService) CloneBusiness(sourceId string, targetId string, selection []string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	log.Println("BusinessService::CloneBusiness - Begin", sourceId, targetId, selection)
+
+	if sourceId == targetId {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid target", ErrorDetail: "Source and target business should be different"}
+		return nil, err
+	}
+
+	if len(selection) == 0 {
+		selection = cloneKinds
+	}
+	kinds := map[string]bool{}
+	for _, kind := range selection {
+		if !containsString(cloneKinds, kind) {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid selection",
+				ErrorDetail: "Kind " + kind + " cannot be cloned, select from " + strings.Join(cloneKinds, ", ")}
+			return nil, err
+		}
+		kinds[kind] = true
+	}
+
+	source, err := p.openBusiness(sourceId)
+	if err != nil {
+		return nil, err
+	}
+	defer source.EndService()
+
+	target, err := p.openBusiness(targetId)
+	if err != nil {
+		return nil, err
+	}
+	defer target.EndService()
+
+	err = verifyBusinessWritable(target.daoPlatformBusiness, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := source.exportCollections(kinds, false)
+	if err != nil {
+		return nil, err
+	}
+
+	idMap, skipped, err := target.importCollections(funcode, collections, true)
+	if err != nil {
+		return nil, err
+	}
+
+	report := utils.Map{
+		FLD_ARCHIVE_SOURCE_ID: sourceId,
+		FLD_CLONE_TARGET_ID:   targetId,
+		FLD_CLONE_SELECTION:   sortedKeys(kinds),
+		FLD_ID_MAP:            idMap,
+		FLD_CLONE_SKIPPED:     skipped,
+	}
+
+	log.Println("BusinessService::CloneBusiness - End", report)
+	return report, nil
+}
+
+// openBusiness - Open the service of another business with the same connection properties
+func (p *businessBaseService) openBusiness(businessId string) (*businessBaseService, error) {
+	props := utils.CopyMap(p.props)
+	props[business_common.FLD_BUSINESS_ID] = businessId
+
+	service, err := NewBusinessService(props)
+	if err != nil {
+		return nil, err
+	}
+	return service.(*businessBaseService), nil
+}
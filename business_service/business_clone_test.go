@@ -0,0 +1,82 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestCloneBusinessSelection(t *testing.T) {
+	p := &businessBaseService{businessID: "biz1"}
+
+	tests := []struct {
+		name      string
+		targetId  string
+		selection []string
+		wantCode  string
+	}{
+		{"same business", "biz1", nil, "01"},
+		{"contacts", "biz2", []string{COLLECTION_ROLE, COLLECTION_CONTACT}, "02"},
+		{"unknown kind", "biz2", []string{"widgets"}, "02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var appErr *utils.AppError
+			_, err := p.CloneBusiness("biz1", tt.targetId, tt.selection)
+			if !errors.As(err, &appErr) || appErr.ErrorCode != p.getServiceModuleCode()+"03"+tt.wantCode {
+				t.Errorf("CloneBusiness = %v, want error %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestImportBatchStrictGrants(t *testing.T) {
+	var entity businessCollection
+	for _, collection := range businessCollections() {
+		if collection.collection == COLLECTION_ACCESS {
+			entity = collection
+		}
+	}
+	p := &businessBaseService{
+		daoUser:    &fakeUserDao{users: map[string]utils.Map{"user1": {business_common.FLD_USER_ID: "user1"}}},
+		businessID: "biz2",
+	}
+	// Only role_1 and site_1 were copied
+	idMap := map[string]map[string]string{
+		COLLECTION_ROLE:     {"role_1": "role_a"},
+		COLLECTION_SITE:     {"site_1": "site_a"},
+		COLLECTION_USERTYPE: {},
+		COLLECTION_GROUP:    {},
+		COLLECTION_ACCESS:   {},
+	}
+
+	records := []utils.Map{
+		{business_common.FLD_APP_ACCESS_ID: "aces_1", business_common.FLD_USER_ID: "user1",
+			business_common.FLD_ROLE_ID: "role_1", business_common.FLD_APP_SITE_ID: "site_1"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_2", business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "role_2"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_3", business_common.FLD_USER_ID: "user9", business_common.FLD_ROLE_ID: "role_1"},
+		{business_common.FLD_APP_ACCESS_ID: "aces_4", FLD_GROUP_ID: "grp_1", business_common.FLD_ROLE_ID: "role_1"},
+	}
+	dao := &fakeCollectionDao{idField: entity.idField}
+	skipped, err := p.importBatch("test", entity, dao, records, idMap, map[string]bool{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"aces_2", "aces_3", "aces_4"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+	if len(dao.records) != 1 {
+		t.Fatalf("records = %v, want the grant of user1 only", dao.records)
+	}
+	dataGrant := dao.records[0]
+	if dataGrant[business_common.FLD_ROLE_ID] != "role_a" || dataGrant[business_common.FLD_APP_SITE_ID] != "site_a" {
+		t.Errorf("grant = %v, want the copied role and site", dataGrant)
+	}
+	if accessId := generateAccessId("user1", "site_a", GRANT_SCOPE_SELF); dataGrant[entity.idField] != accessId || idMap[COLLECTION_ACCESS]["aces_1"] != accessId {
+		t.Errorf("grant id = %v mapped from %v, want %s", dataGrant[entity.idField], idMap[COLLECTION_ACCESS]["aces_1"], accessId)
+	}
+}
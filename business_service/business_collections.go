@@ -0,0 +1,107 @@
+package business_service
+
+import (
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Business scoped collections as named in archives and reports
+const (
+	COLLECTION_BUSINESS      = "business"
+	COLLECTION_TERRITORY     = "territories"
+	COLLECTION_SITE          = "sites"
+	COLLECTION_ROLE          = "roles"
+	COLLECTION_USERTYPE      = "user_types"
+	COLLECTION_USER          = "users"
+	COLLECTION_GROUP         = "groups"
+	COLLECTION_CONTACT       = "contacts"
+	COLLECTION_PAYMENT       = "payments"
+	COLLECTION_PAYMENT_TXN   = "payment_txns"
+	COLLECTION_ACCESS        = "access"
+	COLLECTION_USER_INVITE   = "user_invites"
+	COLLECTION_ACCESS_REVIEW = "access_reviews"
+	// Members of the business in the platform database
+	COLLECTION_MEMBER = "platform_members"
+)
+
+// businessCollection - A business scoped collection of the region database. Archive, teardown and region
+// migration work on a whole business, so they use the collections directly rather than the Daos.
+type businessCollection struct {
+	collection   string
+	dbCollection string
+	idField      string
+	// Prefix of the new ids of imported records, empty when the ids are kept (e.g. users are AppUser ids)
+	idPrefix string
+	// Whether the id is derived from the other fields of the record, like the access id of a grant
+	rekey bool
+	// Fields holding ids of other collections, single id or list of ids.
+	// Fields of nested records are given by their path, e.g. "grants.role_id".
+	refs map[string]string
+	// Quota of the plan limiting the number of records, checked for the imported ones
+	quota string
+}
+
+// businessCollections - All the business scoped collections, the referred ones first. Archives are
+// imported in this order, a teardown erases in the reverse order so the business record goes last.
+func businessCollections() []businessCollection {
+	return []businessCollection{
+		{collection: COLLECTION_BUSINESS, dbCollection: business_common.DbBusinesses, idField: business_common.FLD_BUSINESS_ID},
+		{
+			collection: COLLECTION_TERRITORY, dbCollection: business_common.DbBusinessTerritories, idField: business_common.FLD_APP_TERRITORY_ID, idPrefix: "territory",
+			quota: QUOTA_MAX_TERRITORIES,
+		},
+		{
+			collection: COLLECTION_SITE, dbCollection: business_common.DbBusinessSites, idField: business_common.FLD_APP_SITE_ID, idPrefix: "site",
+			refs:  map[string]string{business_common.FLD_APP_TERRITORY_ID: COLLECTION_TERRITORY},
+			quota: QUOTA_MAX_SITES,
+		},
+		{
+			collection: COLLECTION_ROLE, dbCollection: business_common.DbBusinessRoles, idField: business_common.FLD_ROLE_ID, idPrefix: "role",
+			refs: map[string]string{FLD_ROLE_PARENT_IDS: COLLECTION_ROLE},
+		},
+		{
+			collection: COLLECTION_USERTYPE, dbCollection: business_common.DbBusinessUserTypes, idField: business_common.FLD_USERTYPE_ID, idPrefix: "stftyp",
+			refs: map[string]string{FLD_DEFAULT_ROLE_IDS: COLLECTION_ROLE, FLD_DEFAULT_SITE_IDS: COLLECTION_SITE},
+		},
+		{
+			collection: COLLECTION_USER, dbCollection: business_common.DbBusinessUsers, idField: business_common.FLD_USER_ID,
+			refs:  map[string]string{business_common.FLD_USERTYPE_ID: COLLECTION_USERTYPE},
+			quota: QUOTA_MAX_USERS,
+		},
+		{collection: COLLECTION_GROUP, dbCollection: DbBusinessGroups, idField: FLD_GROUP_ID, idPrefix: "grp"},
+		{collection: COLLECTION_CONTACT, dbCollection: business_common.DbBusinessContacts, idField: business_common.FLD_APP_CONTACT_ID, idPrefix: "cont"},
+		{collection: COLLECTION_PAYMENT, dbCollection: business_common.DbBusinessPayments, idField: business_common.FLD_PAYMENT_ID, idPrefix: "pay"},
+		{
+			collection: COLLECTION_PAYMENT_TXN, dbCollection: business_common.DbBusinessPaymentTxns, idField: business_common.FLD_PAYMENT_TXN_ID, idPrefix: "paytxn",
+			refs: map[string]string{business_common.FLD_PAYMENT_ID: COLLECTION_PAYMENT},
+		},
+		{
+			// The access id is derived from the rewritten fields of the grant
+			collection: COLLECTION_ACCESS, dbCollection: business_common.DbBusinessAccess, idField: business_common.FLD_APP_ACCESS_ID, rekey: true,
+			refs: map[string]string{
+				business_common.FLD_ROLE_ID:     COLLECTION_ROLE,
+				business_common.FLD_APP_SITE_ID: COLLECTION_SITE,
+				business_common.FLD_USERTYPE_ID: COLLECTION_USERTYPE,
+				FLD_GROUP_ID:                    COLLECTION_GROUP,
+			},
+		},
+		{
+			collection: COLLECTION_USER_INVITE, dbCollection: DbBusinessUserInvites, idField: FLD_INVITE_ID, idPrefix: "invt",
+			refs: map[string]string{
+				business_common.FLD_USERTYPE_ID:                           COLLECTION_USERTYPE,
+				FLD_INVITE_GRANTS + "." + business_common.FLD_ROLE_ID:     COLLECTION_ROLE,
+				FLD_INVITE_GRANTS + "." + business_common.FLD_APP_SITE_ID: COLLECTION_SITE,
+			},
+		},
+		{
+			// The reviewed grants are a snapshot, only the access ids of the items are rewritten
+			collection: COLLECTION_ACCESS_REVIEW, dbCollection: DbBusinessAccessReviews, idField: FLD_REVIEW_ID, idPrefix: "acrv",
+			refs: map[string]string{FLD_REVIEW_ITEMS + "." + business_common.FLD_APP_ACCESS_ID: COLLECTION_ACCESS},
+		},
+	}
+}
+
+// dao - Dao of the collection in the region database of the client
+func (c businessCollection) dao(client utils.Map, businessId string) collectionDao {
+	return newCollectionDao(client, businessId, c.dbCollection, c.idField)
+}
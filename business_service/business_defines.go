@@ -0,0 +1,71 @@
+package business_service
+
+// Field names used by the business services in addition to business_common
+const (
+	// Role table fields
+	FLD_ROLE_PERMISSIONS = "permissions"
+	FLD_ROLE_PARENT_IDS  = "parent_role_ids"
+
+	// Access table fields
+	FLD_APP_ROLE_ID = "app_role_id"
+	FLD_VALID_FROM  = "valid_from"
+	FLD_VALID_UNTIL = "valid_until"
+	FLD_GRANT_SCOPE = "scope"
+
+	// User table fields
+	FLD_MANAGER_ID = "manager_id"
+
+	// Site and Territory table fields, the users assigned to them. Their manager is in manager_id.
+	FLD_USER_IDS = "user_ids"
+
+	// User list options
+	FLD_SKIP_USER_INFO = "skip_user_info"
+
+	// Permission catalog fields
+	FLD_PERMISSION              = "permission"
+	FLD_PERMISSION_MODULE       = "module"
+	FLD_PERMISSION_ACTION       = "action"
+	FLD_PERMISSION_DESCRIPTION  = "description"
+	FLD_PERMISSION_DEPENDENCIES = "dependencies"
+
+	// Effective permission fields
+	FLD_PERMISSIONS = "permissions"
+	FLD_ROLES       = "roles"
+	FLD_APP_ROLES   = "app_roles"
+	FLD_GRANTS      = "grants"
+
+	// Resolved role fields
+	FLD_GROUPS          = "groups"
+	FLD_BUSINESS_IDS    = "business_ids"
+	FLD_INHERITED_ROLES = "inherited_roles"
+	FLD_DANGLING_ROLES  = "dangling_roles"
+
+	// Offboarding options and summary fields
+	FLD_DELETE_PERMANENT      = "delete_permanent"
+	FLD_REVOKED_GRANTS        = "revoked_grants"
+	FLD_DETACHED_SITES        = "detached_sites"
+	FLD_DETACHED_TERRITORIES  = "detached_territories"
+	FLD_DETACHED_GROUPS       = "detached_groups"
+	FLD_REMOVED_FROM_BUSINESS = "removed_from_business"
+
+	// Sweep report fields
+	FLD_SWEPT_AT    = "swept_at"
+	FLD_SWEPT_COUNT = "swept_count"
+	FLD_SWEPT       = "swept"
+	FLD_FAILED      = "failed"
+)
+
+// Grant scopes
+const (
+	// Grant applies to the user's own actions
+	GRANT_SCOPE_SELF = ""
+	// Grant applies to the actions of the user on the users reporting to them
+	GRANT_SCOPE_REPORTS = "reports"
+)
+
+const (
+	// Permission which grants every other permission
+	PERMISSION_ALL = "*"
+	// Separator between module and action of a permission key
+	PERMISSION_SEPARATOR = "."
+)
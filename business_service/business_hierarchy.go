@@ -0,0 +1,135 @@
+package business_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Business hierarchy fields
+const (
+	// Platform business field holding the parent company
+	FLD_PARENT_BUSINESS_ID = "parent_business_id"
+	// Grant field extending a business-wide grant to all the subsidiaries
+	FLD_INCLUDE_SUBSIDIARIES = "include_subsidiaries"
+)
+
+// SetParent - Declare the parent company of the business, empty parentId makes it standalone
+func (p *businessBaseService) SetParent(parentId string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "04"
+
+	log.Println("BusinessService::SetParent - Begin", p.businessID, parentId)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	if len(parentId) > 0 {
+		if parentId == p.businessID {
+			err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid parent", ErrorDetail: "Business cannot be its own parent"}
+			return nil, err
+		}
+		if _, err := p.daoPlatformBusiness.Get(parentId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid parent", ErrorDetail: "Given parent business is not exist"}
+			return nil, err
+		}
+
+		ancestorIds, err := getBusinessAncestorIds(p.daoPlatformBusiness, parentId)
+		if err != nil {
+			return nil, err
+		}
+		if containsString(ancestorIds, p.businessID) {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Cyclic hierarchy", ErrorDetail: "Business " + parentId + " is a subsidiary of this business"}
+			return nil, err
+		}
+	}
+
+	data, err := p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_PARENT_BUSINESS_ID: parentId})
+
+	log.Println("BusinessService::SetParent - End", err)
+	return data, err
+}
+
+// GetChildren - List the direct subsidiaries of the business
+func (p *businessBaseService) GetChildren() (utils.Map, error) {
+
+	log.Println("BusinessService::GetChildren - Begin", p.businessID)
+
+	filter := buildFilter(utils.Map{FLD_PARENT_BUSINESS_ID: p.businessID})
+	response, err := p.daoPlatformBusiness.List(filter, "", 0, 0)
+
+	log.Println("BusinessService::GetChildren - End", err)
+	return response, err
+}
+
+// GetAncestors - List the parent companies of the business, starting with the direct parent
+func (p *businessBaseService) GetAncestors() (utils.Map, error) {
+
+	log.Println("BusinessService::GetAncestors - Begin", p.businessID)
+
+	ancestorIds, err := getBusinessAncestorIds(p.daoPlatformBusiness, p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataBusinesses := []utils.Map{}
+	for _, ancestorId := range ancestorIds {
+		dataBusiness, err := p.daoPlatformBusiness.Get(ancestorId)
+		if err != nil {
+			return nil, err
+		}
+		dataBusinesses = append(dataBusinesses, dataBusiness)
+	}
+
+	log.Println("BusinessService::GetAncestors - End", len(dataBusinesses))
+	return listResponse(dataBusinesses), nil
+}
+
+// getBusinessAncestorIds - Get the ids of the parent companies of the business, starting with the direct parent
+func getBusinessAncestorIds(daoBusiness platform_repository.BusinessDao, businessId string) ([]string, error) {
+	ancestorIds := []string{}
+	visited := map[string]bool{businessId: true}
+
+	for currentId := businessId; ; {
+		dataBusiness, err := daoBusiness.Get(currentId)
+		if err != nil {
+			return nil, err
+		}
+		currentId, _ = utils.GetMemberDataStr(dataBusiness, FLD_PARENT_BUSINESS_ID)
+		if len(currentId) == 0 || visited[currentId] {
+			break
+		}
+		visited[currentId] = true
+		ancestorIds = append(ancestorIds, currentId)
+	}
+	return ancestorIds, nil
+}
+
+// getBusinessDescendantIds - Get the ids of all the subsidiaries of the business, level by level
+func getBusinessDescendantIds(daoBusiness platform_repository.BusinessDao, businessId string) ([]string, error) {
+	descendantIds := []string{}
+	visited := map[string]bool{businessId: true}
+	parentIds := []string{businessId}
+
+	for len(parentIds) > 0 {
+		filter := buildFilter(utils.Map{FLD_PARENT_BUSINESS_ID: utils.Map{"$in": parentIds}})
+		response, err := daoBusiness.List(filter, "", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		parentIds = []string{}
+		for _, dataBusiness := range getListResult(response) {
+			childId, _ := utils.GetMemberDataStr(dataBusiness, platform_common.FLD_BUSINESS_ID)
+			if !visited[childId] {
+				visited[childId] = true
+				parentIds = append(parentIds, childId)
+				descendantIds = append(descendantIds, childId)
+			}
+		}
+	}
+	return descendantIds, nil
+}
@@ -0,0 +1,151 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testHierarchy - Platform businesses holding <- biz1 <- sub1 <- sub2 and the standalone other
+func testHierarchy() *fakePlatformBusinessDao {
+	daoBusiness := &fakePlatformBusinessDao{businesses: map[string]utils.Map{}, members: map[string]utils.Map{}}
+	for businessId, parentId := range map[string]string{"holding": "", "biz1": "holding", "sub1": "biz1", "sub2": "sub1", "other": ""} {
+		daoBusiness.businesses[businessId] = utils.Map{
+			platform_common.FLD_BUSINESS_ID: businessId,
+			FLD_PARENT_BUSINESS_ID:          parentId,
+			FLD_BUSINESS_STATUS:             BUSINESS_STATUS_ACTIVE,
+		}
+	}
+	return daoBusiness
+}
+
+func TestBusinessAncestorsAndDescendants(t *testing.T) {
+	daoBusiness := testHierarchy()
+
+	ancestorIds, err := getBusinessAncestorIds(daoBusiness, "sub2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sub1", "biz1", "holding"}; !reflect.DeepEqual(ancestorIds, want) {
+		t.Errorf("ancestors = %v, want %v", ancestorIds, want)
+	}
+
+	descendantIds, err := getBusinessDescendantIds(daoBusiness, "holding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"biz1", "sub1", "sub2"}; !reflect.DeepEqual(descendantIds, want) {
+		t.Errorf("descendants = %v, want %v", descendantIds, want)
+	}
+}
+
+func TestSetParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		businessId string
+		parentId   string
+		wantCode   string
+	}{
+		{"own parent", "biz1", "biz1", "01"},
+		{"unknown parent", "biz1", "biz9", "02"},
+		{"subsidiary as parent", "holding", "sub2", "03"},
+		{"new parent", "other", "holding", ""},
+		{"standalone", "sub1", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daoBusiness := testHierarchy()
+			p := &businessBaseService{daoPlatformBusiness: daoBusiness, businessID: tt.businessId}
+
+			_, err := p.SetParent(tt.parentId)
+			if len(tt.wantCode) > 0 {
+				var appErr *utils.AppError
+				if !errors.As(err, &appErr) || appErr.ErrorCode != p.getServiceModuleCode()+"04"+tt.wantCode {
+					t.Errorf("SetParent = %v, want error %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := daoBusiness.businesses[tt.businessId][FLD_PARENT_BUSINESS_ID]; got != tt.parentId {
+				t.Errorf("parent = %v, want %q", got, tt.parentId)
+			}
+		})
+	}
+}
+
+// testSubsidiaryAccess - Access service of biz1 where user1 views contacts in the subsidiaries too
+// and sites in biz1 only
+func testSubsidiaryAccess() *accessBaseService {
+	return &accessBaseService{
+		daoUser:  &fakeUserDao{users: map[string]utils.Map{"user1": {business_common.FLD_USER_ID: "user1"}}},
+		daoRole:  testRoles(),
+		daoGroup: &fakeCollectionDao{idField: FLD_GROUP_ID},
+		daoAccess: &fakeAccessDao{filtered: true, grants: []utils.Map{
+			{business_common.FLD_APP_ACCESS_ID: "aces_group", business_common.FLD_USER_ID: "user1",
+				business_common.FLD_ROLE_ID: "viewer", FLD_INCLUDE_SUBSIDIARIES: true},
+			{business_common.FLD_APP_ACCESS_ID: "aces_biz1", business_common.FLD_USER_ID: "user1",
+				business_common.FLD_ROLE_ID: "cycle_a"},
+		}},
+		daoBusiness: testHierarchy(),
+		businessID:  "biz1",
+		shared:      true,
+	}
+}
+
+func TestCheckPermissionInBusiness(t *testing.T) {
+	p := testSubsidiaryAccess()
+
+	tests := []struct {
+		businessId string
+		permission string
+		want       bool
+	}{
+		{"biz1", "contact.view", true},
+		{"biz1", "site.view", true},
+		{"sub2", "contact.view", true},
+		{"sub2", "site.view", false},
+		{"holding", "contact.view", false},
+		{"other", "contact.view", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.businessId+" "+tt.permission, func(t *testing.T) {
+			allowed, err := p.CheckPermissionInBusiness("user1", tt.businessId, tt.permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.want {
+				t.Errorf("CheckPermissionInBusiness = %v, want %v", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestListVisibleBusinesses(t *testing.T) {
+	p := testSubsidiaryAccess()
+
+	tests := []struct {
+		permission string
+		want       []string
+	}{
+		{"contact.view", []string{"biz1", "sub1", "sub2"}},
+		{"site.view", []string{"biz1"}},
+		{"payment.view", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			response, err := p.ListVisibleBusinesses("user1", tt.permission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := response[FLD_BUSINESS_IDS]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("visible businesses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package business_service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-platform-service/platform_service"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Region migration options, state and report fields
+const (
+	FLD_MIGRATION_PURGE_SOURCE = "purge_source"
+
+	// State of the migration in the platform business record
+	FLD_MIGRATION                 = "region_migration"
+	FLD_MIGRATION_SOURCE_REGION   = "source_region_id"
+	FLD_MIGRATION_TARGET_REGION   = "target_region_id"
+	FLD_MIGRATION_STATE           = "state"
+	FLD_MIGRATION_COPIED          = "copied"
+	FLD_MIGRATION_PURGED          = "purged"
+	FLD_MIGRATION_PREVIOUS_STATUS = "previous_status"
+	FLD_MIGRATION_STARTED_AT      = "started_at"
+	FLD_MIGRATION_FINISHED_AT     = "finished_at"
+
+	FLD_SOURCE_RECORDS     = "source_records"
+	FLD_TARGET_RECORDS     = "target_records"
+	FLD_SOURCE_CHECKSUM    = "source_checksum"
+	FLD_TARGET_CHECKSUM    = "target_checksum"
+	FLD_MIGRATION_VERIFIED = "verified"
+)
+
+// Region migration states
+const (
+	MIGRATION_STATE_COPYING  = "copying"
+	MIGRATION_STATE_SWITCHED = "switched"
+	MIGRATION_STATE_DONE     = "done"
+)
+
+// MigrateRegion - Move all the data of the business to the target region database.
+// Every collection is copied as stored, deleted records and timestamps included, records of the business
+// already in the target are replaced or removed, and the copy is verified by record count and checksum,
+// then the region of the business is switched and, with purge_source, the source is erased.
+// The business is read-only meanwhile. The progress is kept in the platform business record,
+// so a run after an interruption continues where it stopped and a finished migration is not repeated.
+func (p *businessBaseService) MigrateRegion(targetRegionId string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "07"
+
+	log.Println("BusinessService::MigrateRegion - Begin", p.businessID, targetRegionId, opts)
+
+	purgeSource, _ := utils.GetMemberDataBool(opts, FLD_MIGRATION_PURGE_SOURCE)
+
+	dataPlatform, err := p.daoPlatformBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+	regionId, _ := utils.GetMemberDataStr(dataPlatform, platform_common.FLD_BUSINESS_REGION_ID)
+
+	state, ok := getMemberDataMap(dataPlatform, FLD_MIGRATION)
+	stateName, _ := utils.GetMemberDataStr(state, FLD_MIGRATION_STATE)
+	stateTarget, _ := utils.GetMemberDataStr(state, FLD_MIGRATION_TARGET_REGION)
+	if ok && stateName != MIGRATION_STATE_DONE && stateTarget != targetRegionId {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Migration in progress",
+			ErrorDetail: "Migration to region " + stateTarget + " is not finished, run it again to resume"}
+		return nil, err
+	}
+
+	if !ok || stateName == MIGRATION_STATE_DONE {
+		if regionId == targetRegionId {
+			// Nothing to copy, only a purge of the source may be left
+			if ok && purgeSource && stateTarget == targetRegionId {
+				purged, _ := utils.GetMemberDataBool(state, FLD_MIGRATION_PURGED)
+				if !purged {
+					return p.finishMigration(state, true)
+				}
+			}
+			log.Println("BusinessService::MigrateRegion - End, already in region", targetRegionId)
+			return p.migrationReport(state, nil), nil
+		}
+
+		state = utils.Map{
+			FLD_MIGRATION_SOURCE_REGION:   regionId,
+			FLD_MIGRATION_TARGET_REGION:   targetRegionId,
+			FLD_MIGRATION_STATE:           MIGRATION_STATE_COPYING,
+			FLD_MIGRATION_COPIED:          []string{},
+			FLD_MIGRATION_PREVIOUS_STATUS: getBusinessStatus(dataPlatform),
+			FLD_MIGRATION_STARTED_AT:      formatDateTime(time.Now()),
+		}
+		// No changes while the data is copied
+		_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{
+			FLD_MIGRATION:       state,
+			FLD_BUSINESS_STATUS: BUSINESS_STATUS_READ_ONLY,
+		})
+		if err != nil {
+			return nil, err
+		}
+		stateName = MIGRATION_STATE_COPYING
+	}
+
+	if stateName == MIGRATION_STATE_SWITCHED {
+		return p.finishMigration(state, purgeSource)
+	}
+
+	sourceRegionId, _ := utils.GetMemberDataStr(state, FLD_MIGRATION_SOURCE_REGION)
+	dbSource, err := p.openRegionDatabase(sourceRegionId)
+	if err != nil {
+		return nil, err
+	}
+	defer dbSource.CloseDatabaseService()
+
+	dbTarget, err := p.openRegionDatabase(targetRegionId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid region", ErrorDetail: "Region " + targetRegionId + " cannot be opened: " + err.Error()}
+		return nil, err
+	}
+	defer dbTarget.CloseDatabaseService()
+
+	copied := map[string]bool{}
+	for _, collection := range getMemberDataStrArray(state, FLD_MIGRATION_COPIED) {
+		copied[collection] = true
+	}
+
+	results := []utils.Map{}
+	unverified := []string{}
+	for _, entity := range businessCollections() {
+		source := entity.dao(dbSource.GetClient(), p.businessID)
+		target := entity.dao(dbTarget.GetClient(), p.businessID)
+
+		if !copied[entity.collection] {
+			err := copyRegionCollection(funcode, entity, source, target)
+			if err != nil {
+				return nil, err
+			}
+
+			copied[entity.collection] = true
+			state[FLD_MIGRATION_COPIED] = sortedKeys(copied)
+			_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_MIGRATION: state})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		result, err := verifyRegionCollection(entity, source, target)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+		if result[FLD_MIGRATION_VERIFIED] != true {
+			unverified = append(unverified, entity.collection)
+		}
+	}
+
+	if len(unverified) > 0 {
+		// Stays in copying, so the next run reconciles every collection again
+		state[FLD_MIGRATION_COPIED] = []string{}
+		_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_MIGRATION: state})
+		if err != nil {
+			return nil, err
+		}
+
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Migration not verified",
+			ErrorDetail: fmt.Sprintf("Copied %v differ from region %s, run it again to resume", unverified, sourceRegionId)}
+		return nil, err
+	}
+
+	// Switch the business to the target region and restore its status
+	previousStatus, _ := utils.GetMemberDataStr(state, FLD_MIGRATION_PREVIOUS_STATUS)
+	state[FLD_MIGRATION_STATE] = MIGRATION_STATE_SWITCHED
+	_, err = p.daoPlatformBusiness.Update(p.businessID, utils.Map{
+		platform_common.FLD_BUSINESS_REGION_ID: targetRegionId,
+		FLD_BUSINESS_STATUS:                    previousStatus,
+		FLD_MIGRATION:                          state,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.businessStatus = previousStatus
+
+	report, err := p.finishMigration(state, purgeSource)
+	if err != nil {
+		return nil, err
+	}
+	report[FLD_COLLECTIONS] = results
+
+	log.Println("BusinessService::MigrateRegion - End", report)
+	return report, nil
+}
+
+// finishMigration - Erase the business from the source region when asked and mark the migration done
+func (p *businessBaseService) finishMigration(state utils.Map, purgeSource bool) (utils.Map, error) {
+	if purgeSource {
+		sourceRegionId, _ := utils.GetMemberDataStr(state, FLD_MIGRATION_SOURCE_REGION)
+		dbSource, err := p.openRegionDatabase(sourceRegionId)
+		if err != nil {
+			return nil, err
+		}
+		defer dbSource.CloseDatabaseService()
+
+		for _, entity := range businessCollections() {
+			if _, err := entity.dao(dbSource.GetClient(), p.businessID).DeleteAll(); err != nil {
+				return nil, err
+			}
+		}
+		state[FLD_MIGRATION_PURGED] = true
+	}
+
+	state[FLD_MIGRATION_STATE] = MIGRATION_STATE_DONE
+	state[FLD_MIGRATION_FINISHED_AT] = formatDateTime(time.Now())
+	_, err := p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_MIGRATION: state})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.migrationReport(state, nil), nil
+}
+
+// migrationReport - Report of the migration with the verification of each collection
+func (p *businessBaseService) migrationReport(state utils.Map, results []utils.Map) utils.Map {
+	report := utils.CopyMap(state)
+	report[business_common.FLD_BUSINESS_ID] = p.businessID
+	if results != nil {
+		report[FLD_COLLECTIONS] = results
+	}
+	return report
+}
+
+// openRegionDatabase - Open the region database of the business. The region the business is in now is
+// opened by the platform service like for every service. The other region of the migration is not yet
+// or no longer the region of the business, so it is opened from its region record.
+func (p *businessBaseService) openRegionDatabase(regionId string) (db_utils.DatabaseService, error) {
+	var dbRegion db_utils.DatabaseService
+
+	// Read again, the region changes during the migration
+	dataPlatform, err := p.daoPlatformBusiness.Get(p.businessID)
+	if err != nil {
+		return dbRegion, err
+	}
+	if currentId, _ := utils.GetMemberDataStr(dataPlatform, platform_common.FLD_BUSINESS_REGION_ID); currentId == regionId {
+		return platform_service.OpenRegionDatabaseService(p.props)
+	}
+
+	dataRegion, err := platform_repository.NewRegionDao(p.GetClient()).Get(regionId)
+	if err != nil {
+		return dbRegion, err
+	}
+
+	dbType, _ := utils.GetMemberDataInt(dataRegion, platform_common.FLD_REGION_DB_TYPE, true)
+	dbServer, _ := utils.GetMemberDataStr(dataRegion, platform_common.FLD_REGION_MONGODB_SERVER)
+	dbUser, _ := utils.GetMemberDataStr(dataRegion, platform_common.FLD_REGION_MONGODB_USER)
+	dbSecret, _ := utils.GetMemberDataStr(dataRegion, platform_common.FLD_REGION_MONGODB_SECRET)
+	dbName, _ := utils.GetMemberDataStr(dataRegion, platform_common.FLD_REGION_MONGODB_NAME)
+
+	if isTenantDB, _ := utils.GetMemberDataBool(dataPlatform, platform_common.FLD_BUSINESS_IS_TENANT_DB); isTenantDB {
+		dbName = dbName + "-" + p.businessID
+	}
+
+	err = dbRegion.OpenDatabaseService(utils.Map{
+		db_common.DB_TYPE:               db_common.DatabaseType(dbType),
+		db_common.DB_SERVER:             dbServer,
+		db_common.DB_USER:               dbUser,
+		db_common.DB_SECRET:             dbSecret,
+		db_common.DB_NAME:               dbName,
+		platform_common.FLD_BUSINESS_ID: p.businessID,
+	})
+	return dbRegion, err
+}
+
+// copyRegionCollection - Make the target hold the records as they are stored in the source. Missing records
+// are inserted, records which differ are replaced and records not in the source are removed, so the target
+// is reconciled whatever an earlier run or an earlier migration left in it.
+func copyRegionCollection(funcode string, entity businessCollection, source collectionDao, target collectionDao) error {
+	records, err := source.ListAll()
+	if err != nil {
+		return err
+	}
+
+	// Copied by an earlier run, deleted ones included
+	targetRecords, err := target.ListAll()
+	if err != nil {
+		return err
+	}
+	copied := map[string]string{}
+	for _, record := range targetRecords {
+		id, _ := utils.GetMemberDataStr(record, entity.idField)
+		copied[id], err = recordChecksum(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	copyFailed := func(id string, err error) error {
+		return &utils.AppError{ErrorCode: funcode + "04", ErrorMsg: "Migration copy failed",
+			ErrorDetail: fmt.Sprintf("%s %s: %v", entity.collection, id, err)}
+	}
+
+	sourceIds := map[string]bool{}
+	for _, record := range records {
+		id, _ := utils.GetMemberDataStr(record, entity.idField)
+		sourceIds[id] = true
+
+		checksum, err := recordChecksum(record)
+		if err != nil {
+			return err
+		}
+		if targetChecksum, ok := copied[id]; ok {
+			if targetChecksum == checksum {
+				continue
+			}
+			// Changed since it was copied
+			if _, err := target.Delete(id); err != nil {
+				return copyFailed(id, err)
+			}
+		}
+
+		data := utils.CopyMap(record)
+		delete(data, db_common.FLD_DEFAULT_ID)
+		if err := target.Insert(data); err != nil {
+			return copyFailed(id, err)
+		}
+	}
+
+	for id := range copied {
+		if !sourceIds[id] {
+			if _, err := target.Delete(id); err != nil {
+				return copyFailed(id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifyRegionCollection - Compare the number of records and the checksum of the collection in both regions
+func verifyRegionCollection(entity businessCollection, source collectionDao, target collectionDao) (utils.Map, error) {
+	sourceRecords, sourceChecksum, err := checksumRecords(entity, source)
+	if err != nil {
+		return nil, err
+	}
+	targetRecords, targetChecksum, err := checksumRecords(entity, target)
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.Map{
+		FLD_COLLECTION:         entity.collection,
+		FLD_SOURCE_RECORDS:     sourceRecords,
+		FLD_TARGET_RECORDS:     targetRecords,
+		FLD_SOURCE_CHECKSUM:    sourceChecksum,
+		FLD_TARGET_CHECKSUM:    targetChecksum,
+		FLD_MIGRATION_VERIFIED: sourceRecords == targetRecords && sourceChecksum == targetChecksum,
+	}, nil
+}
+
+// checksumRecords - Number of records and checksum of their content in id order, deleted records,
+// timestamps and deleted flags included. Only the database id differs between the regions.
+func checksumRecords(entity businessCollection, dao collectionDao) (int, string, error) {
+	records, err := dao.ListAll()
+	if err != nil {
+		return 0, "", err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		idI, _ := utils.GetMemberDataStr(records[i], entity.idField)
+		idJ, _ := utils.GetMemberDataStr(records[j], entity.idField)
+		return idI < idJ
+	})
+
+	content := ""
+	for _, record := range records {
+		checksum, err := recordChecksum(record)
+		if err != nil {
+			return 0, "", err
+		}
+		content += checksum
+	}
+	return len(records), utils.GetMD5Hash(content), nil
+}
+
+// recordChecksum - Checksum of the content of the record, without the database id
+func recordChecksum(record utils.Map) (string, error) {
+	data := utils.CopyMap(record)
+	delete(data, db_common.FLD_DEFAULT_ID)
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return utils.GetMD5Hash(string(encoded)), nil
+}
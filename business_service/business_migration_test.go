@@ -0,0 +1,63 @@
+package business_service
+
+import (
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func testSites(sites ...utils.Map) *fakeCollectionDao {
+	return &fakeCollectionDao{idField: business_common.FLD_APP_SITE_ID, records: sites}
+}
+
+func TestCopyRegionCollectionReconcilesTarget(t *testing.T) {
+	entity := businessCollection{collection: COLLECTION_SITE, idField: business_common.FLD_APP_SITE_ID}
+	source := testSites(
+		utils.Map{business_common.FLD_APP_SITE_ID: "site_a", "name": "A"},
+		utils.Map{business_common.FLD_APP_SITE_ID: "site_b", "name": "B v2"},
+	)
+	// Left by an earlier run, site_b changed since and site_c is no longer in the source
+	target := testSites(
+		utils.Map{business_common.FLD_APP_SITE_ID: "site_b", "name": "B v1"},
+		utils.Map{business_common.FLD_APP_SITE_ID: "site_c", "name": "C"},
+	)
+
+	result, err := verifyRegionCollection(entity, source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result[FLD_MIGRATION_VERIFIED] != false {
+		t.Fatalf("stale target verified: %v", result)
+	}
+
+	if err := copyRegionCollection("test", entity, source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = verifyRegionCollection(entity, source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result[FLD_MIGRATION_VERIFIED] != true {
+		t.Errorf("reconciled target not verified: %v, target %v", result, target.records)
+	}
+	for _, record := range target.records {
+		if record[business_common.FLD_APP_SITE_ID] == "site_b" && record["name"] != "B v2" {
+			t.Errorf("site_b = %v, want the source record", record)
+		}
+	}
+}
+
+func TestCopyRegionCollectionKeepsCopiedRecords(t *testing.T) {
+	entity := businessCollection{collection: COLLECTION_SITE, idField: business_common.FLD_APP_SITE_ID}
+	source := testSites(utils.Map{business_common.FLD_APP_SITE_ID: "site_a", "name": "A"})
+	target := testSites(utils.Map{business_common.FLD_APP_SITE_ID: "site_a", "name": "A"})
+
+	if err := copyRegionCollection("test", entity, source, target); err != nil {
+		t.Fatal(err)
+	}
+	if len(target.records) != 1 {
+		t.Errorf("target = %v, want site_a once", target.records)
+	}
+}
@@ -0,0 +1,228 @@
+package business_service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Plan fields of the business record
+const (
+	FLD_FEATURES = "features"
+	FLD_QUOTAS   = "quotas"
+
+	FLD_USAGE = "usage"
+	FLD_LIMIT = "limit"
+
+	// Payment table fields
+	FLD_PAYMENT_AMOUNT = "amount"
+)
+
+// Quotas, a missing or zero limit is unlimited
+const (
+	QUOTA_MAX_USERS       = "max_users"
+	QUOTA_MAX_SITES       = "max_sites"
+	QUOTA_MAX_TERRITORIES = "max_territories"
+	// Total amount of the payments created in the current month of the business time zone
+	QUOTA_MAX_MONTHLY_PAYMENT_VOLUME = "max_monthly_payment_volume"
+)
+
+// ERROR_CODE_QUOTA_EXCEEDED - Error code returned by every Create that would exceed a quota
+var ERROR_CODE_QUOTA_EXCEEDED = business_common.GetServiceModuleCode() + "14" + "10" + "01"
+
+// planQuotas - All the quotas in reporting order
+var planQuotas = []string{
+	QUOTA_MAX_USERS,
+	QUOTA_MAX_SITES,
+	QUOTA_MAX_TERRITORIES,
+	QUOTA_MAX_MONTHLY_PAYMENT_VOLUME,
+}
+
+// GetUsage - Report the current usage of every quota against its limit, and the feature flags
+func (p *businessBaseService) GetUsage() (utils.Map, error) {
+
+	log.Println("BusinessService::GetUsage - Begin", p.businessID)
+
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+	quotas, _ := getMemberDataMap(dataBusiness, FLD_QUOTAS)
+	features, ok := getMemberDataMap(dataBusiness, FLD_FEATURES)
+	if !ok {
+		features = utils.Map{}
+	}
+
+	usage := utils.Map{}
+	for _, quota := range planQuotas {
+		current, err := getQuotaUsage(p.dbRegion.GetClient(), p.businessID, quota)
+		if err != nil {
+			return nil, err
+		}
+		limit, _ := getMemberDataFloat(quotas, quota)
+		usage[quota] = utils.Map{FLD_USAGE: current, FLD_LIMIT: limit}
+	}
+
+	response := utils.Map{
+		business_common.FLD_BUSINESS_ID: p.businessID,
+		FLD_QUOTAS:                      usage,
+		FLD_FEATURES:                    features,
+	}
+
+	log.Println("BusinessService::GetUsage - End", response)
+	return response, nil
+}
+
+// IsFeatureEnabled - Whether the feature flag is set for the business
+func (p *businessBaseService) IsFeatureEnabled(feature string) (bool, error) {
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	if err != nil {
+		return false, err
+	}
+	features, _ := getMemberDataMap(dataBusiness, FLD_FEATURES)
+	enabled, _ := utils.GetMemberDataBool(features, feature)
+	return enabled, nil
+}
+
+// UpdatePlan - Set the feature flags and quota limits given, the others are kept
+func (p *businessBaseService) UpdatePlan(features utils.Map, quotas utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "05"
+
+	log.Println("BusinessService::UpdatePlan - Begin", features, quotas)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	dataFeatures, ok := getMemberDataMap(dataBusiness, FLD_FEATURES)
+	if !ok {
+		dataFeatures = utils.Map{}
+	}
+	for feature := range features {
+		enabled, err := utils.GetMemberDataBool(features, feature)
+		if err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid feature", ErrorDetail: "Feature " + feature + " should be true or false"}
+			return nil, err
+		}
+		dataFeatures[feature] = enabled
+	}
+
+	dataQuotas, ok := getMemberDataMap(dataBusiness, FLD_QUOTAS)
+	if !ok {
+		dataQuotas = utils.Map{}
+	}
+	for quota := range quotas {
+		if !containsString(planQuotas, quota) {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid quota", ErrorDetail: "Unknown quota " + quota}
+			return nil, err
+		}
+		limit, ok := getMemberDataFloat(quotas, quota)
+		if !ok || limit < 0 {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid quota", ErrorDetail: "Quota " + quota + " should be zero or a positive number"}
+			return nil, err
+		}
+		dataQuotas[quota] = limit
+	}
+
+	data, err := p.daoBusiness.Update(utils.Map{FLD_FEATURES: dataFeatures, FLD_QUOTAS: dataQuotas})
+
+	log.Println("BusinessService::UpdatePlan - End", err)
+	return data, err
+}
+
+// checkQuota - Return the quota error when adding to the current usage would exceed the limit of the business.
+// The check and the Create which follows it are not atomic, Creates running at the same time may all pass
+// the check and together exceed the limit by what they add.
+func checkQuota(client utils.Map, businessId string, quota string, adding float64) error {
+	dataBusiness, err := business_repository.NewBusinessDao(client, businessId).Get(businessId)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// No business record, no plan
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return checkQuotaLimit(dataBusiness, quota, adding, func() (float64, error) {
+		return getQuotaUsage(client, businessId, quota)
+	})
+}
+
+// checkQuotaLimit - Return the quota error when adding to the usage would exceed the limit in the business record,
+// the usage is only read for a quota with a limit
+func checkQuotaLimit(dataBusiness utils.Map, quota string, adding float64, usage func() (float64, error)) error {
+	quotas, _ := getMemberDataMap(dataBusiness, FLD_QUOTAS)
+	limit, ok := getMemberDataFloat(quotas, quota)
+	if !ok || limit <= 0 {
+		return nil
+	}
+
+	current, err := usage()
+	if err != nil {
+		return err
+	}
+	if current+adding > limit {
+		err := &utils.AppError{ErrorCode: ERROR_CODE_QUOTA_EXCEEDED, ErrorMsg: "Quota exceeded",
+			ErrorDetail: fmt.Sprintf("%s limit is %v, current usage is %v", quota, limit, current)}
+		return err
+	}
+	return nil
+}
+
+// getQuotaUsage - Get the current usage of the quota
+func getQuotaUsage(client utils.Map, businessId string, quota string) (float64, error) {
+	switch quota {
+	case QUOTA_MAX_USERS:
+		return countTotal(business_repository.NewUserDao(client, businessId).List("", "", 0, 1))
+	case QUOTA_MAX_SITES:
+		return countTotal(business_repository.NewSiteDao(client, businessId).List("", "", 0, 1))
+	case QUOTA_MAX_TERRITORIES:
+		return countTotal(business_repository.NewTerritoryDao(client, businessId).List("", "", 0, 1))
+	case QUOTA_MAX_MONTHLY_PAYMENT_VOLUME:
+		// The month of the business time zone
+		location, err := getBusinessLocation(client, businessId)
+		if err != nil {
+			return 0, err
+		}
+		now := time.Now().In(location)
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		filter := buildFilter(utils.Map{db_common.FLD_CREATED_AT: utils.Map{"$gte": utils.Map{"$date": monthStart.UTC().Format(time.RFC3339)}}})
+		return sumAmounts(business_repository.NewPaymentDao(client, businessId).List(filter, "", 0, 0))
+	}
+	return 0, nil
+}
+
+// sumAmounts - Total amount of the payments listed by a Dao's List
+func sumAmounts(response utils.Map, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, dataPayment := range getListResult(response) {
+		amount, _ := getMemberDataFloat(dataPayment, FLD_PAYMENT_AMOUNT)
+		total += amount
+	}
+	return total, nil
+}
+
+// countTotal - Number of records matching the filter of a Dao's List, whatever page was listed
+func countTotal(response utils.Map, err error) (float64, error) {
+	if err != nil {
+		return 0, err
+	}
+	summary, _ := getMemberDataMap(response, db_common.LIST_SUMMARY)
+	total, _ := getMemberDataFloat(summary, db_common.LIST_FILTEREDSIZE)
+	return total, nil
+}
@@ -0,0 +1,66 @@
+package business_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestSumAmounts(t *testing.T) {
+	payments := []utils.Map{
+		{FLD_PAYMENT_AMOUNT: 120.5},
+		{FLD_PAYMENT_AMOUNT: int64(30)},
+		{FLD_PAYMENT_AMOUNT: int32(10)},
+		{"other": 1000},
+	}
+
+	total, err := sumAmounts(listResponse(payments), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 160.5 {
+		t.Errorf("sumAmounts = %v, want 160.5", total)
+	}
+
+	if _, err := sumAmounts(nil, errors.New("connection lost")); err == nil {
+		t.Error("sumAmounts succeeded, want the list error")
+	}
+}
+
+func TestCheckQuotaLimitPaymentVolume(t *testing.T) {
+	dataBusiness := utils.Map{FLD_QUOTAS: utils.Map{QUOTA_MAX_MONTHLY_PAYMENT_VOLUME: 1000}}
+	usage := func() (float64, error) {
+		return 900, nil
+	}
+
+	tests := []struct {
+		name   string
+		amount float64
+		want   bool
+	}{
+		{"within the volume", 100, false},
+		{"over the volume", 100.01, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQuotaLimit(dataBusiness, QUOTA_MAX_MONTHLY_PAYMENT_VOLUME, tt.amount, usage)
+			var appErr *utils.AppError
+			if exceeded := errors.As(err, &appErr) && appErr.ErrorCode == ERROR_CODE_QUOTA_EXCEEDED; exceeded != tt.want {
+				t.Errorf("checkQuotaLimit(%v) = %v, want exceeded %v", tt.amount, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckQuotaLimitUnlimited(t *testing.T) {
+	usage := func() (float64, error) {
+		t.Fatal("usage read for a quota without a limit")
+		return 0, nil
+	}
+	for _, dataBusiness := range []utils.Map{{}, {FLD_QUOTAS: utils.Map{QUOTA_MAX_USERS: 0}}} {
+		if err := checkQuotaLimit(dataBusiness, QUOTA_MAX_USERS, 1, usage); err != nil {
+			t.Errorf("checkQuotaLimit(%v) = %v, want nil", dataBusiness, err)
+		}
+	}
+}
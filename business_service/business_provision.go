@@ -0,0 +1,285 @@
+package business_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Provisioning spec fields
+const (
+	FLD_PROVISION_BUSINESS   = "business"
+	FLD_PROVISION_OWNER_ID   = "owner_id"
+	FLD_PROVISION_SITE       = "site"
+	FLD_PROVISION_USER_TYPES = "user_types"
+	FLD_PROVISION_ROLES      = "roles"
+	FLD_PROVISION_STEPS      = "steps"
+
+	FLD_PROVISION_STEP   = "step"
+	FLD_PROVISION_ID     = "id"
+	FLD_PROVISION_STATUS = "status"
+
+	FLD_SITE_NAME      = "site_name"
+	FLD_IS_HEAD_OFFICE = "is_head_office"
+	FLD_USERTYPE_NAME  = "usertype_name"
+	FLD_ROLE_NAME      = "role_name"
+	FLD_IS_OWNER       = "is_owner"
+)
+
+// Provisioning steps and their status
+const (
+	PROVISION_STEP_BUSINESS = "business"
+	PROVISION_STEP_SITE     = "site"
+	PROVISION_STEP_USERTYPE = "usertype"
+	PROVISION_STEP_ROLE     = "role"
+	PROVISION_STEP_OWNER    = "owner"
+	PROVISION_STEP_MEMBER   = "member"
+	PROVISION_STEP_GRANT    = "grant"
+
+	PROVISION_STATUS_CREATED  = "created"
+	PROVISION_STATUS_EXISTING = "existing"
+)
+
+// defaultProvisionSpec - Defaults used for the parts missing in the provisioning spec
+func defaultProvisionSpec() utils.Map {
+	return utils.Map{
+		FLD_PROVISION_SITE: utils.Map{
+			FLD_SITE_NAME:      "Head Office",
+			FLD_IS_HEAD_OFFICE: true,
+		},
+		FLD_PROVISION_USER_TYPES: []utils.Map{
+			{FLD_USERTYPE_NAME: "Staff"},
+			{FLD_USERTYPE_NAME: "Manager"},
+		},
+		FLD_PROVISION_ROLES: []utils.Map{
+			{FLD_ROLE_NAME: "Administrator", FLD_ROLE_PERMISSIONS: []string{PERMISSION_ALL}},
+			{FLD_ROLE_NAME: "Staff", FLD_ROLE_PERMISSIONS: []string{}},
+		},
+	}
+}
+
+// ProvisionBusiness - Create the business record, the head-office site, the default user types and roles,
+// and add the creating SysUser given in owner_id as owner with a grant of the administrator role (the first
+// role having "*"). All the records get ids derived from the business id, so a retry after a partial failure
+// only creates the missing ones. Returns the steps with the id and whether it was created or already existing.
+func (p *businessBaseService) ProvisionBusiness(spec utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	log.Println("BusinessService::ProvisionBusiness - Begin", p.businessID)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	ownerId, err := utils.GetMemberDataStr(spec, FLD_PROVISION_OWNER_ID)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Missing owner_id", ErrorDetail: "SysUser id of the owner is required"}
+		return nil, err
+	}
+	// The SysUser id is the user id of the business user, the platform business member and the grant
+	if _, err := p.daoSysUser.Get(ownerId); err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid owner_id", ErrorDetail: "Given owner_id is not exist"}
+		return nil, err
+	}
+
+	spec = utils.MergeMap(defaultProvisionSpec(), spec, true)
+
+	// Platform and region databases are committed together
+	p.BeginTransaction()
+	p.dbRegion.BeginTransaction()
+
+	// Roles and the grant go through the services sharing the provisioning databases
+	roleService := newSharedRoleService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+
+	steps, err := p.provisionBusiness(funcode, spec, ownerId, roleService, accessService)
+	if err != nil {
+		p.dbRegion.RollbackTransaction()
+		p.RollbackTransaction()
+		return nil, err
+	}
+
+	p.dbRegion.CommitTransaction()
+	p.CommitTransaction()
+
+	response := utils.Map{
+		business_common.FLD_BUSINESS_ID: p.businessID,
+		FLD_PROVISION_OWNER_ID:          ownerId,
+		FLD_PROVISION_STEPS:             steps,
+	}
+
+	log.Println("BusinessService::ProvisionBusiness - End", len(steps))
+	return response, nil
+}
+
+// provisionBusiness - Create the missing records, only a record which is not found is created
+func (p *businessBaseService) provisionBusiness(funcode string, spec utils.Map, ownerId string, roleService RoleService, accessService AccessService) ([]utils.Map, error) {
+	steps := []utils.Map{}
+	addStep := func(step string, id string, created bool) {
+		status := PROVISION_STATUS_EXISTING
+		if created {
+			status = PROVISION_STATUS_CREATED
+		}
+		steps = append(steps, utils.Map{FLD_PROVISION_STEP: step, FLD_PROVISION_ID: id, FLD_PROVISION_STATUS: status})
+	}
+
+	// Business record, its quotas apply to the site and the owner
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	exists, err := recordExists(err)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		dataBusiness, _ = getMemberDataMap(spec, FLD_PROVISION_BUSINESS)
+		dataBusiness = utils.CopyMap(dataBusiness)
+		dataBusiness[business_common.FLD_BUSINESS_ID] = p.businessID
+		if _, err := p.daoBusiness.Create(dataBusiness); err != nil {
+			return nil, err
+		}
+	}
+	addStep(PROVISION_STEP_BUSINESS, p.businessID, !exists)
+
+	// Head-office site
+	dataSite, _ := getMemberDataMap(spec, FLD_PROVISION_SITE)
+	siteId := p.provisionId(dataSite, business_common.FLD_APP_SITE_ID, "site", "head_office")
+	_, err = p.daoSite.Get(siteId)
+	if exists, err = recordExists(err); err != nil {
+		return nil, err
+	}
+	if !exists {
+		err := checkQuotaLimit(dataBusiness, QUOTA_MAX_SITES, 1, func() (float64, error) {
+			return countTotal(p.daoSite.List("", "", 0, 1))
+		})
+		if err != nil {
+			return nil, err
+		}
+		dataSite = utils.CopyMap(dataSite)
+		dataSite[business_common.FLD_APP_SITE_ID] = siteId
+		dataSite[business_common.FLD_BUSINESS_ID] = p.businessID
+		if _, err := p.daoSite.Create(dataSite); err != nil {
+			return nil, err
+		}
+	}
+	addStep(PROVISION_STEP_SITE, siteId, !exists)
+
+	// User types
+	for _, dataUserType := range getMemberDataMapArray(spec, FLD_PROVISION_USER_TYPES) {
+		name, _ := utils.GetMemberDataStr(dataUserType, FLD_USERTYPE_NAME)
+		userTypeId := p.provisionId(dataUserType, business_common.FLD_USERTYPE_ID, "stftyp", name)
+		_, err := p.daoUserType.Get(userTypeId)
+		exists, err := recordExists(err)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			dataUserType = utils.CopyMap(dataUserType)
+			dataUserType[business_common.FLD_USERTYPE_ID] = userTypeId
+			dataUserType[business_common.FLD_BUSINESS_ID] = p.businessID
+			if _, err := p.daoUserType.Create(dataUserType); err != nil {
+				return nil, err
+			}
+		}
+		addStep(PROVISION_STEP_USERTYPE, userTypeId, !exists)
+	}
+
+	// Roles are created through the RoleService to validate and expand their permissions,
+	// the first one with all permissions becomes the owner's role
+	adminRoleId := ""
+	for _, dataRole := range getMemberDataMapArray(spec, FLD_PROVISION_ROLES) {
+		name, _ := utils.GetMemberDataStr(dataRole, FLD_ROLE_NAME)
+		roleId := p.provisionId(dataRole, business_common.FLD_ROLE_ID, "role", name)
+		_, err := p.daoRole.GetDetails(roleId)
+		exists, err := recordExists(err)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			dataRole = utils.CopyMap(dataRole)
+			dataRole[business_common.FLD_ROLE_ID] = roleId
+			if _, err := roleService.Create(dataRole); err != nil {
+				return nil, err
+			}
+		}
+		addStep(PROVISION_STEP_ROLE, roleId, !exists)
+
+		if len(adminRoleId) == 0 && containsString(getMemberDataStrArray(dataRole, FLD_ROLE_PERMISSIONS), PERMISSION_ALL) {
+			adminRoleId = roleId
+		}
+	}
+	if len(adminRoleId) == 0 {
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Missing administrator role", ErrorDetail: "One of the roles should have all permissions"}
+		return nil, err
+	}
+
+	// Owner as business user
+	_, err = p.daoUser.Get(ownerId)
+	if exists, err = recordExists(err); err != nil {
+		return nil, err
+	}
+	if !exists {
+		err := checkQuotaLimit(dataBusiness, QUOTA_MAX_USERS, 1, func() (float64, error) {
+			return countTotal(p.daoUser.List("", "", 0, 1))
+		})
+		if err != nil {
+			return nil, err
+		}
+		dataUser := utils.Map{
+			business_common.FLD_USER_ID:     ownerId,
+			business_common.FLD_BUSINESS_ID: p.businessID,
+			FLD_USER_STATUS:                 USER_STATUS_ACTIVE,
+			FLD_IS_OWNER:                    true,
+		}
+		if _, err := p.daoUser.Create(dataUser); err != nil {
+			return nil, err
+		}
+	}
+	addStep(PROVISION_STEP_OWNER, ownerId, !exists)
+
+	// Owner as member of the platform business
+	accessId := utils.GetMD5Hash(p.businessID + "_" + ownerId)
+	_, err = p.daoPlatformBusiness.GetAccessDetails(accessId)
+	if exists, err = recordExists(err); err != nil {
+		return nil, err
+	}
+	if !exists {
+		dataMember := utils.Map{
+			platform_common.FLD_BUSINESS_USER_ID: accessId,
+			platform_common.FLD_BUSINESS_ID:      p.businessID,
+			platform_common.FLD_SYS_USER_ID:      ownerId,
+		}
+		if _, err := p.daoPlatformBusiness.AddUser(dataMember); err != nil {
+			return nil, err
+		}
+	}
+	addStep(PROVISION_STEP_MEMBER, accessId, !exists)
+
+	// Administrator grant of the owner, validated by the AccessService
+	grantId := generateAccessId(ownerId, "", GRANT_SCOPE_SELF)
+	_, err = p.daoAccess.Get(grantId)
+	if exists, err = recordExists(err); err != nil {
+		return nil, err
+	}
+	if !exists {
+		dataGrant := utils.Map{
+			business_common.FLD_USER_ID: ownerId,
+			business_common.FLD_ROLE_ID: adminRoleId,
+		}
+		if _, err := accessService.GrantPermission(dataGrant); err != nil {
+			return nil, err
+		}
+	}
+	addStep(PROVISION_STEP_GRANT, grantId, !exists)
+
+	return steps, nil
+}
+
+// provisionId - Get the id given in the record, or derive it from the business id and the key
+func (p *businessBaseService) provisionId(data utils.Map, idField string, prefix string, key string) string {
+	if id, _ := utils.GetMemberDataStr(data, idField); len(id) > 0 {
+		return id
+	}
+	return utils.GenerateChecksumId(prefix, p.businessID+"_"+key)
+}
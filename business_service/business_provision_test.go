@@ -0,0 +1,137 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testProvision - BusinessService of an empty business with the role and access services sharing its Daos
+type testProvision struct {
+	p             *businessBaseService
+	roleService   RoleService
+	accessService AccessService
+}
+
+func newTestProvision() *testProvision {
+	daoRole := &fakeRoleDao{roles: map[string]utils.Map{}}
+	daoUser := &fakeUserDao{users: map[string]utils.Map{}}
+	daoAccess := &fakeAccessDao{}
+
+	p := &businessBaseService{
+		daoBusiness:         &fakeBusinessDao{businesses: map[string]utils.Map{}},
+		daoUser:             daoUser,
+		daoSite:             &fakeSiteDao{sites: map[string]utils.Map{}},
+		daoUserType:         &fakeUserTypeDao{userTypes: map[string]utils.Map{}},
+		daoRole:             daoRole,
+		daoAccess:           daoAccess,
+		daoPlatformBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE),
+		businessID:          "biz1",
+	}
+	return &testProvision{
+		p:             p,
+		roleService:   &roleBaseService{daoRole: daoRole, businessID: "biz1", shared: true},
+		accessService: &accessBaseService{daoAccess: daoAccess, daoUser: daoUser, daoRole: daoRole, businessID: "biz1", shared: true},
+	}
+}
+
+func (t *testProvision) run() ([]utils.Map, error) {
+	spec := utils.MergeMap(defaultProvisionSpec(), utils.Map{}, true)
+	return t.p.provisionBusiness("test", spec, "sysusr1", t.roleService, t.accessService)
+}
+
+// stepStatuses - Status of each step in order
+func stepStatuses(steps []utils.Map) []string {
+	statuses := []string{}
+	for _, step := range steps {
+		statuses = append(statuses, step[FLD_PROVISION_STEP].(string)+":"+step[FLD_PROVISION_STATUS].(string))
+	}
+	return statuses
+}
+
+func TestProvisionBusinessFirstRun(t *testing.T) {
+	provision := newTestProvision()
+
+	steps, err := provision.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"business:created", "site:created", "usertype:created", "usertype:created",
+		"role:created", "role:created", "owner:created", "member:created", "grant:created"}
+	if got := stepStatuses(steps); !reflect.DeepEqual(got, want) {
+		t.Errorf("steps = %v, want %v", got, want)
+	}
+
+	dataOwner, err := provision.p.daoUser.Get("sysusr1")
+	if err != nil || dataOwner[FLD_IS_OWNER] != true {
+		t.Errorf("owner = %v %v, want a business user marked as owner", dataOwner, err)
+	}
+	dataGrant, err := provision.p.daoAccess.Get(generateAccessId("sysusr1", "", GRANT_SCOPE_SELF))
+	if err != nil || dataGrant[business_common.FLD_ROLE_ID] != steps[4][FLD_PROVISION_ID] {
+		t.Errorf("grant = %v %v, want the administrator role %v", dataGrant, err, steps[4][FLD_PROVISION_ID])
+	}
+}
+
+func TestProvisionBusinessRetry(t *testing.T) {
+	provision := newTestProvision()
+	daoPlatformBusiness := provision.p.daoPlatformBusiness.(*fakePlatformBusinessDao)
+
+	// The platform member fails after the region records are created
+	daoPlatformBusiness.addUserErr = errors.New("connection lost")
+	if _, err := provision.run(); err == nil {
+		t.Fatal("provisioning succeeded, want the member error")
+	}
+
+	daoPlatformBusiness.addUserErr = nil
+	steps, err := provision.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"business:existing", "site:existing", "usertype:existing", "usertype:existing",
+		"role:existing", "role:existing", "owner:existing", "member:created", "grant:created"}
+	if got := stepStatuses(steps); !reflect.DeepEqual(got, want) {
+		t.Errorf("retry steps = %v, want %v", got, want)
+	}
+
+	// Nothing is left to create
+	steps, err = provision.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range stepStatuses(steps) {
+		if !strings.HasSuffix(status, ":"+PROVISION_STATUS_EXISTING) {
+			t.Errorf("step %s after a complete run, want existing", status)
+		}
+	}
+}
+
+func TestProvisionBusinessLookupFailure(t *testing.T) {
+	provision := newTestProvision()
+	provision.p.daoBusiness.(*fakeBusinessDao).getErr = errors.New("connection lost")
+
+	if _, err := provision.run(); err == nil || err.Error() != "connection lost" {
+		t.Fatalf("provisioning = %v, want the lookup error", err)
+	}
+	if sites := provision.p.daoSite.(*fakeSiteDao).sites; len(sites) > 0 {
+		t.Errorf("created sites %v after the lookup failed", sites)
+	}
+}
+
+func TestProvisionBusinessQuota(t *testing.T) {
+	provision := newTestProvision()
+	provision.p.daoBusiness.(*fakeBusinessDao).businesses["biz1"] = utils.Map{
+		business_common.FLD_BUSINESS_ID: "biz1",
+		FLD_QUOTAS:                      utils.Map{QUOTA_MAX_USERS: 1},
+	}
+	provision.p.daoUser.(*fakeUserDao).users["user1"] = utils.Map{business_common.FLD_USER_ID: "user1"}
+
+	var appErr *utils.AppError
+	if _, err := provision.run(); !errors.As(err, &appErr) || appErr.ErrorCode != ERROR_CODE_QUOTA_EXCEEDED {
+		t.Errorf("provisioning = %v, want the quota error for the owner", err)
+	}
+}
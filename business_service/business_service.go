@@ -20,6 +20,40 @@ type BusinessService interface {
 	Find(filter string) (utils.Map, error)
 	Delete() error
 
+	// Teardown - Erase all the data of the business, Delete is a Teardown without options
+	Teardown(opts utils.Map, progress TeardownProgress) (utils.Map, error)
+
+	// Export - Export everything of the business as a versioned archive
+	Export() (utils.Map, error)
+	// Import - Import an archive into this new or empty business, ids are rewritten
+	Import(archive utils.Map) (utils.Map, error)
+
+	// CloneBusiness - Copy the configuration of the source business into the target business
+	CloneBusiness(sourceId string, targetId string, selection []string) (utils.Map, error)
+
+	// Parent company and subsidiaries
+	SetParent(parentId string) (utils.Map, error)
+	GetChildren() (utils.Map, error)
+	GetAncestors() (utils.Map, error)
+
+	// Plan feature flags and quotas
+	GetUsage() (utils.Map, error)
+	IsFeatureEnabled(feature string) (bool, error)
+	UpdatePlan(features utils.Map, quotas utils.Map) (utils.Map, error)
+
+	// Settings sections with their defaults, see settingsSections
+	GetSettings(section string) (utils.Map, error)
+	UpdateSettings(section string, indata utils.Map) (utils.Map, error)
+
+	// MigrateRegion - Move the data of the business to another region database, resumable
+	MigrateRegion(targetRegionId string, opts utils.Map) (utils.Map, error)
+
+	// SetStatus - Set the business active, read_only or suspended
+	SetStatus(status string) (utils.Map, error)
+
+	// ProvisionBusiness - Create the business with its default site, user types, roles and owner
+	ProvisionBusiness(spec utils.Map) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -33,10 +67,16 @@ type businessBaseService struct {
 	daoBusiness         business_repository.BusinessDao
 	daoUser             business_repository.UserDao
 	daoContact          business_repository.ContactDao
+	daoSite             business_repository.SiteDao
+	daoUserType         business_repository.UserTypeDao
+	daoRole             business_repository.RoleDao
+	daoAccess           business_repository.AccessDao
 	daoSysUser          platform_repository.SysUserDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               BusinessService
+	props               utils.Map
 	businessID          string
+	businessStatus      string
 }
 
 func init() {
@@ -71,16 +111,20 @@ func NewBusinessService(props utils.Map) (BusinessService, error) {
 
 	// Assign the BusinessId
 	p.businessID = businessId
+	p.props = props
 
 	// Initialise Services
 	p.initializeService()
 
-	_, err = p.daoPlatformBusiness.Get(businessId)
+	dataBusiness, err := p.daoPlatformBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid business_id", ErrorDetail: "Given business_id is not exist"}
 		return p.errorReturn(err)
 	}
 
+	// Not verified active here, this service lifts a suspension with SetStatus
+	p.businessStatus = getBusinessStatus(dataBusiness)
+
 	p.child = &p
 
 	return &p, err
@@ -101,6 +145,14 @@ func (p *businessBaseService) initializeService() {
 	p.daoBusiness = business_repository.NewBusinessDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoContact = business_repository.NewContactDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoRole = business_repository.NewRoleDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+}
+
+func (p *businessBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "14"
 }
 
 // Create - Create Service
@@ -110,6 +162,10 @@ func (p *businessBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("BusinessService::Create - Begin")
 
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	// Add Business Id
 	indata[business_common.FLD_BUSINESS_ID] = p.businessID
 
@@ -132,6 +188,10 @@ func (p *businessBaseService) Update(indata utils.Map) (utils.Map, error) {
 
 	log.Println("BusinessService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	data, err := p.daoBusiness.Get(p.businessID)
 	if err != nil {
 		return data, err
@@ -139,6 +199,8 @@ func (p *businessBaseService) Update(indata utils.Map) (utils.Map, error) {
 
 	// Delete Business Id if exist
 	delete(indata, business_common.FLD_BUSINESS_ID)
+	// Settings are validated, they are written through UpdateSettings
+	delete(indata, FLD_SETTINGS)
 
 	data, err = p.daoBusiness.Update(indata)
 	log.Println("BusinessService::Update - End ")
@@ -173,17 +235,12 @@ func (p *businessBaseService) Delete() error {
 
 	log.Println("BusinessService::Delete - Begin", p.businessID)
 
-	result, err := p.daoContact.DeleteAll()
-	if err != nil {
-		return err
-	}
-	log.Printf("BusinessService::DeleteAll - Contact  %v", result)
-
-	result, err = p.daoBusiness.Delete(p.businessID)
+	// Teardown verifies the business status
+	report, err := p.Teardown(utils.Map{}, nil)
 	if err != nil {
 		return err
 	}
-	log.Printf("BusinessService::Delete - End %v", result)
+	log.Printf("BusinessService::Delete - End %v", report)
 	return nil
 }
 
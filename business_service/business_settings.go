@@ -0,0 +1,308 @@
+package business_service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+	// Time zones do not depend on the zoneinfo of the server
+	_ "time/tzdata"
+
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FLD_SETTINGS - Business record field holding the settings sections
+const FLD_SETTINGS = "settings"
+
+// Settings sections
+const (
+	SETTINGS_LOCALE       = "locale"
+	SETTINGS_TIMEZONE     = "timezone"
+	SETTINGS_CURRENCY     = "currency"
+	SETTINGS_FISCAL_YEAR  = "fiscal_year"
+	SETTINGS_WORKING_WEEK = "working_week"
+	SETTINGS_NUMBERING    = "numbering"
+	SETTINGS_BRANDING     = "branding"
+)
+
+// Settings fields
+const (
+	FLD_SETTING_LANGUAGE    = "language"
+	FLD_SETTING_COUNTRY     = "country"
+	FLD_SETTING_DATE_FORMAT = "date_format"
+
+	FLD_SETTING_TIMEZONE = "timezone"
+
+	FLD_SETTING_CURRENCY = "currency"
+	FLD_SETTING_DECIMALS = "decimals"
+
+	FLD_SETTING_START_MONTH = "start_month"
+	FLD_SETTING_START_DAY   = "start_day"
+
+	FLD_SETTING_INVOICE_PREFIX     = "invoice_prefix"
+	FLD_SETTING_PAYMENT_PREFIX     = "payment_prefix"
+	FLD_SETTING_PAYMENT_TXN_PREFIX = "payment_txn_prefix"
+	FLD_SETTING_NUMBER_PADDING     = "number_padding"
+
+	FLD_SETTING_LOGO_URL        = "logo_url"
+	FLD_SETTING_PRIMARY_COLOR   = "primary_color"
+	FLD_SETTING_SECONDARY_COLOR = "secondary_color"
+)
+
+var (
+	languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+	countryPattern  = regexp.MustCompile(`^[A-Z]{2}$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	colorPattern    = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+)
+
+// settingsSection - Fields of a section in attribute schema form, and the checks beyond type and enum
+type settingsSection struct {
+	schema   []utils.Map
+	validate func(settings utils.Map) error
+}
+
+// settingsSections - All the settings sections with their defaults
+var settingsSections = map[string]settingsSection{
+	SETTINGS_LOCALE: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_LANGUAGE, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "en"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_COUNTRY, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_DATE_FORMAT, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "YYYY-MM-DD",
+				FLD_ATTRIBUTE_ENUM: []any{"YYYY-MM-DD", "DD/MM/YYYY", "MM/DD/YYYY", "DD.MM.YYYY"}},
+		},
+		validate: func(settings utils.Map) error {
+			if err := matchSetting(settings, FLD_SETTING_LANGUAGE, languagePattern, "an ISO 639 language code"); err != nil {
+				return err
+			}
+			return matchSetting(settings, FLD_SETTING_COUNTRY, countryPattern, "an ISO 3166 country code")
+		},
+	},
+	SETTINGS_TIMEZONE: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_TIMEZONE, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "UTC"},
+		},
+		validate: func(settings utils.Map) error {
+			timezone, _ := utils.GetMemberDataStr(settings, FLD_SETTING_TIMEZONE)
+			_, err := loadTimezone(FLD_SETTING_TIMEZONE, timezone)
+			return err
+		},
+	},
+	SETTINGS_CURRENCY: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_CURRENCY, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "USD"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_DECIMALS, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_INTEGER, FLD_ATTRIBUTE_DEFAULT: 2,
+				FLD_ATTRIBUTE_ENUM: []any{0, 1, 2, 3}},
+		},
+		validate: func(settings utils.Map) error {
+			return matchSetting(settings, FLD_SETTING_CURRENCY, currencyPattern, "an ISO 4217 currency code")
+		},
+	},
+	SETTINGS_FISCAL_YEAR: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_START_MONTH, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_INTEGER, FLD_ATTRIBUTE_DEFAULT: 1},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_START_DAY, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_INTEGER, FLD_ATTRIBUTE_DEFAULT: 1},
+		},
+		validate: func(settings utils.Map) error {
+			month, _ := utils.GetMemberDataInt(settings, FLD_SETTING_START_MONTH, true)
+			day, _ := utils.GetMemberDataInt(settings, FLD_SETTING_START_DAY, true)
+			// Without leap days, the start is the same every year
+			if month < 1 || month > 12 || day < 1 || time.Date(2001, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+				return fmt.Errorf("fiscal year start %d-%d is not a valid month and day", month, day)
+			}
+			return nil
+		},
+	},
+	SETTINGS_WORKING_WEEK: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: "monday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: true},
+			{FLD_ATTRIBUTE_NAME: "tuesday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: true},
+			{FLD_ATTRIBUTE_NAME: "wednesday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: true},
+			{FLD_ATTRIBUTE_NAME: "thursday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: true},
+			{FLD_ATTRIBUTE_NAME: "friday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: true},
+			{FLD_ATTRIBUTE_NAME: "saturday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: false},
+			{FLD_ATTRIBUTE_NAME: "sunday", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN, FLD_ATTRIBUTE_DEFAULT: false},
+		},
+	},
+	SETTINGS_NUMBERING: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_INVOICE_PREFIX, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "INV-"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_PAYMENT_PREFIX, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "PAY-"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_PAYMENT_TXN_PREFIX, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "TXN-"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_NUMBER_PADDING, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_INTEGER, FLD_ATTRIBUTE_DEFAULT: 6},
+		},
+		validate: func(settings utils.Map) error {
+			padding, _ := utils.GetMemberDataInt(settings, FLD_SETTING_NUMBER_PADDING, true)
+			if padding < 0 || padding > 20 {
+				return fmt.Errorf("%s should be from 0 to 20", FLD_SETTING_NUMBER_PADDING)
+			}
+			return nil
+		},
+	},
+	SETTINGS_BRANDING: {
+		schema: []utils.Map{
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_LOGO_URL, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_PRIMARY_COLOR, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "#1F2937"},
+			{FLD_ATTRIBUTE_NAME: FLD_SETTING_SECONDARY_COLOR, FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_DEFAULT: "#6B7280"},
+		},
+		validate: func(settings utils.Map) error {
+			if err := matchSetting(settings, FLD_SETTING_PRIMARY_COLOR, colorPattern, "a #RRGGBB color"); err != nil {
+				return err
+			}
+			return matchSetting(settings, FLD_SETTING_SECONDARY_COLOR, colorPattern, "a #RRGGBB color")
+		},
+	},
+}
+
+// GetSettings - Get the settings section, the defaults fill in what is not set
+func (p *businessBaseService) GetSettings(section string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "08"
+
+	log.Println("BusinessService::GetSettings - Begin", section)
+
+	if _, ok := settingsSections[section]; !ok {
+		return nil, invalidSectionError(funcode, section)
+	}
+
+	settings, err := getBusinessSettings(p.dbRegion.GetClient(), p.businessID, section)
+
+	log.Println("BusinessService::GetSettings - End", err)
+	return settings, err
+}
+
+// UpdateSettings - Change the fields given in the settings section, a null field is reset to its default
+func (p *businessBaseService) UpdateSettings(section string, indata utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "09"
+
+	log.Println("BusinessService::UpdateSettings - Begin", section, indata)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	if _, ok := settingsSections[section]; !ok {
+		return nil, invalidSectionError(funcode, section)
+	}
+
+	dataBusiness, err := p.daoBusiness.Get(p.businessID)
+	if err != nil {
+		return nil, err
+	}
+	dataSettings, ok := getMemberDataMap(dataBusiness, FLD_SETTINGS)
+	if !ok {
+		dataSettings = utils.Map{}
+	}
+	stored, ok := getMemberDataMap(dataSettings, section)
+	if !ok {
+		stored = utils.Map{}
+	}
+
+	// Only the values set are stored, so later changes of a default apply
+	stored = utils.CopyMap(stored)
+	for field, value := range indata {
+		if value == nil {
+			delete(stored, field)
+		} else {
+			stored[field] = value
+		}
+	}
+
+	settings, err := applySettings(section, stored)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid settings", ErrorDetail: err.Error()}
+		return nil, err
+	}
+	for field := range stored {
+		stored[field] = settings[field]
+	}
+
+	dataSettings[section] = stored
+	_, err = p.daoBusiness.Update(utils.Map{FLD_SETTINGS: dataSettings})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("BusinessService::UpdateSettings - End", section)
+	return settings, nil
+}
+
+// getBusinessSettings - Get the settings section of the business with the defaults filled in,
+// only the defaults when there is no business record
+func getBusinessSettings(client utils.Map, businessId string, section string) (utils.Map, error) {
+	stored := utils.Map{}
+	dataBusiness, err := business_repository.NewBusinessDao(client, businessId).Get(businessId)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	dataSettings, _ := getMemberDataMap(dataBusiness, FLD_SETTINGS)
+	if dataSection, ok := getMemberDataMap(dataSettings, section); ok {
+		stored = dataSection
+	}
+	return applySettings(section, stored)
+}
+
+// getBusinessLocation - Time zone of the business, UTC when it is not set
+func getBusinessLocation(client utils.Map, businessId string) (*time.Location, error) {
+	settings, err := getBusinessSettings(client, businessId, SETTINGS_TIMEZONE)
+	if err != nil {
+		return nil, err
+	}
+	timezone, _ := utils.GetMemberDataStr(settings, FLD_SETTING_TIMEZONE)
+	return loadTimezone(FLD_SETTING_TIMEZONE, timezone)
+}
+
+// loadTimezone - Load the IANA time zone of the field. "Local" is the zone of the server, not a business zone.
+func loadTimezone(field string, timezone string) (*time.Location, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		return nil, fmt.Errorf("%s %q is not an IANA time zone", field, timezone)
+	}
+	return location, nil
+}
+
+// applySettings - Validate the settings of the section and fill in the defaults
+func applySettings(section string, settings utils.Map) (utils.Map, error) {
+	definition := settingsSections[section]
+
+	result, err := applyAttributeSchema(definition.schema, settings)
+	if err != nil {
+		return nil, err
+	}
+	if definition.validate != nil {
+		if err := definition.validate(result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// matchSetting - Check the string field when it is set
+func matchSetting(settings utils.Map, field string, pattern *regexp.Regexp, expected string) error {
+	value, err := utils.GetMemberDataStr(settings, field)
+	if err != nil || len(value) == 0 {
+		return nil
+	}
+	if !pattern.MatchString(value) {
+		return fmt.Errorf("%s %q is not %s", field, value, expected)
+	}
+	return nil
+}
+
+// invalidSectionError - Error listing the valid sections
+func invalidSectionError(funcode string, section string) error {
+	sections := []string{}
+	for name := range settingsSections {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+
+	err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid settings section",
+		ErrorDetail: fmt.Sprintf("Section %q is not one of %v", section, sections)}
+	return err
+}
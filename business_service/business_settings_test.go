@@ -0,0 +1,120 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestApplySettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		section  string
+		settings utils.Map
+		wantErr  bool
+	}{
+		{"locale defaults", SETTINGS_LOCALE, utils.Map{}, false},
+		{"locale", SETTINGS_LOCALE, utils.Map{FLD_SETTING_LANGUAGE: "fr", FLD_SETTING_COUNTRY: "FR"}, false},
+		{"language", SETTINGS_LOCALE, utils.Map{FLD_SETTING_LANGUAGE: "French"}, true},
+		{"country", SETTINGS_LOCALE, utils.Map{FLD_SETTING_COUNTRY: "fr"}, true},
+		{"date format", SETTINGS_LOCALE, utils.Map{FLD_SETTING_DATE_FORMAT: "YY-M-D"}, true},
+		{"timezone", SETTINGS_TIMEZONE, utils.Map{FLD_SETTING_TIMEZONE: "Asia/Kolkata"}, false},
+		{"unknown timezone", SETTINGS_TIMEZONE, utils.Map{FLD_SETTING_TIMEZONE: "Mars/Olympus"}, true},
+		{"server timezone", SETTINGS_TIMEZONE, utils.Map{FLD_SETTING_TIMEZONE: "Local"}, true},
+		{"currency", SETTINGS_CURRENCY, utils.Map{FLD_SETTING_CURRENCY: "EUR", FLD_SETTING_DECIMALS: 2}, false},
+		{"decimals", SETTINGS_CURRENCY, utils.Map{FLD_SETTING_DECIMALS: 5}, true},
+		{"fiscal year", SETTINGS_FISCAL_YEAR, utils.Map{FLD_SETTING_START_MONTH: 4, FLD_SETTING_START_DAY: 1}, false},
+		{"leap day", SETTINGS_FISCAL_YEAR, utils.Map{FLD_SETTING_START_MONTH: 2, FLD_SETTING_START_DAY: 29}, true},
+		{"month", SETTINGS_FISCAL_YEAR, utils.Map{FLD_SETTING_START_MONTH: 13}, true},
+		{"padding", SETTINGS_NUMBERING, utils.Map{FLD_SETTING_NUMBER_PADDING: 21}, true},
+		{"color", SETTINGS_BRANDING, utils.Map{FLD_SETTING_PRIMARY_COLOR: "red"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applySettings(tt.section, tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("applySettings(%v) = %v, want error %v", tt.settings, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplySettingsDefaults(t *testing.T) {
+	settings, err := applySettings(SETTINGS_LOCALE, utils.Map{FLD_SETTING_COUNTRY: "DE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings[FLD_SETTING_LANGUAGE] != "en" || settings[FLD_SETTING_DATE_FORMAT] != "YYYY-MM-DD" || settings[FLD_SETTING_COUNTRY] != "DE" {
+		t.Errorf("settings = %v, want the defaults with the country", settings)
+	}
+}
+
+// testSettingsBusiness - BusinessService of biz1 with the language of the locale set
+func testSettingsBusiness() *businessBaseService {
+	return &businessBaseService{
+		daoBusiness: &fakeBusinessDao{businessId: "biz1", businesses: map[string]utils.Map{"biz1": {
+			business_common.FLD_BUSINESS_ID: "biz1",
+			FLD_SETTINGS:                    utils.Map{SETTINGS_LOCALE: utils.Map{FLD_SETTING_LANGUAGE: "fr"}},
+		}}},
+		daoPlatformBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE),
+		businessID:          "biz1",
+	}
+}
+
+// storedSettings - The settings section as stored in the business record
+func storedSettings(p *businessBaseService, section string) utils.Map {
+	dataBusiness, _ := p.daoBusiness.Get(p.businessID)
+	dataSettings, _ := getMemberDataMap(dataBusiness, FLD_SETTINGS)
+	stored, _ := getMemberDataMap(dataSettings, section)
+	return stored
+}
+
+func TestUpdateSettings(t *testing.T) {
+	p := testSettingsBusiness()
+
+	settings, err := p.UpdateSettings(SETTINGS_LOCALE, utils.Map{FLD_SETTING_LANGUAGE: nil, FLD_SETTING_COUNTRY: "FR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings[FLD_SETTING_LANGUAGE] != "en" || settings[FLD_SETTING_COUNTRY] != "FR" {
+		t.Errorf("settings = %v, want the default language and the country", settings)
+	}
+	// Only the values set are stored
+	if stored, want := storedSettings(p, SETTINGS_LOCALE), (utils.Map{FLD_SETTING_COUNTRY: "FR"}); !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored = %v, want %v", stored, want)
+	}
+}
+
+func TestUpdateSettingsInvalid(t *testing.T) {
+	p := testSettingsBusiness()
+
+	tests := []struct {
+		name     string
+		section  string
+		indata   utils.Map
+		wantCode string
+	}{
+		{"unknown section", "theme", utils.Map{}, "01"},
+		{"invalid value", SETTINGS_LOCALE, utils.Map{FLD_SETTING_COUNTRY: "France"}, "02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var appErr *utils.AppError
+			_, err := p.UpdateSettings(tt.section, tt.indata)
+			if !errors.As(err, &appErr) || appErr.ErrorCode != p.getServiceModuleCode()+"09"+tt.wantCode {
+				t.Errorf("UpdateSettings = %v, want error %s", err, tt.wantCode)
+			}
+		})
+	}
+	if stored, want := storedSettings(p, SETTINGS_LOCALE), (utils.Map{FLD_SETTING_LANGUAGE: "fr"}); !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored = %v after invalid updates, want %v", stored, want)
+	}
+
+	var appErr *utils.AppError
+	if _, err := p.GetSettings("theme"); !errors.As(err, &appErr) || appErr.ErrorCode != p.getServiceModuleCode()+"0801" {
+		t.Errorf("GetSettings = %v, want the invalid section error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package business_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// FLD_BUSINESS_STATUS - Status field of the platform business record
+const FLD_BUSINESS_STATUS = "business_status"
+
+// Business status values, a missing status is active
+const (
+	BUSINESS_STATUS_ACTIVE    = "active"
+	BUSINESS_STATUS_READ_ONLY = "read_only"
+	BUSINESS_STATUS_SUSPENDED = "suspended"
+)
+
+// Error codes returned for a business that is not active
+var (
+	ERROR_CODE_BUSINESS_SUSPENDED = business_common.GetServiceModuleCode() + "14" + "11" + "01"
+	ERROR_CODE_BUSINESS_READ_ONLY = business_common.GetServiceModuleCode() + "14" + "11" + "02"
+)
+
+// businessStatuses - All the valid business status values
+var businessStatuses = []string{
+	BUSINESS_STATUS_ACTIVE,
+	BUSINESS_STATUS_READ_ONLY,
+	BUSINESS_STATUS_SUSPENDED,
+}
+
+// SetStatus - Set the status of the business, allowed whatever the current status is
+func (p *businessBaseService) SetStatus(status string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "06"
+
+	log.Println("BusinessService::SetStatus - Begin", p.businessID, status)
+
+	if !containsString(businessStatuses, status) {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid status", ErrorDetail: "Business status should be active, read_only or suspended"}
+		return nil, err
+	}
+
+	data, err := p.daoPlatformBusiness.Update(p.businessID, utils.Map{FLD_BUSINESS_STATUS: status})
+	if err != nil {
+		return nil, err
+	}
+	p.businessStatus = status
+
+	log.Println("BusinessService::SetStatus - End", p.businessID, status)
+	return data, nil
+}
+
+// getBusinessStatus - Get the status of the platform business record
+func getBusinessStatus(dataBusiness utils.Map) string {
+	status, _ := utils.GetMemberDataStr(dataBusiness, FLD_BUSINESS_STATUS)
+	if len(status) == 0 {
+		return BUSINESS_STATUS_ACTIVE
+	}
+	return status
+}
+
+// verifyBusinessActive - Services cannot be constructed for a suspended business
+func verifyBusinessActive(businessId string, status string) error {
+	if status == BUSINESS_STATUS_SUSPENDED {
+		err := &utils.AppError{ErrorCode: ERROR_CODE_BUSINESS_SUSPENDED, ErrorMsg: "Business suspended", ErrorDetail: "Business " + businessId + " is suspended"}
+		return err
+	}
+	return nil
+}
+
+// verifyBusinessWritable - Changes are rejected unless the business is active. The status is read once
+// at the start of every changing operation, so services opened before the business became read-only or
+// suspended reject changes too. The steps of the operation do not read it again.
+func verifyBusinessWritable(daoBusiness platform_repository.BusinessDao, businessId string) error {
+	dataBusiness, err := daoBusiness.Get(businessId)
+	if err != nil {
+		return err
+	}
+
+	switch status := getBusinessStatus(dataBusiness); status {
+	case BUSINESS_STATUS_ACTIVE:
+		return nil
+	case BUSINESS_STATUS_SUSPENDED:
+		return verifyBusinessActive(businessId, status)
+	default:
+		err := &utils.AppError{ErrorCode: ERROR_CODE_BUSINESS_READ_ONLY, ErrorMsg: "Business is read-only", ErrorDetail: "Business " + businessId + " is " + status + ", changes are not allowed"}
+		return err
+	}
+}
@@ -0,0 +1,93 @@
+package business_service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestVerifyBusinessWritable(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		wantCode string
+	}{
+		{"active", BUSINESS_STATUS_ACTIVE, ""},
+		{"missing status is active", "", ""},
+		{"read-only", BUSINESS_STATUS_READ_ONLY, ERROR_CODE_BUSINESS_READ_ONLY},
+		{"suspended", BUSINESS_STATUS_SUSPENDED, ERROR_CODE_BUSINESS_SUSPENDED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyBusinessWritable(testBusiness("biz1", tt.status), "biz1")
+			if len(tt.wantCode) == 0 {
+				if err != nil {
+					t.Errorf("verifyBusinessWritable = %v, want nil", err)
+				}
+				return
+			}
+			var appErr *utils.AppError
+			if !errors.As(err, &appErr) || appErr.ErrorCode != tt.wantCode {
+				t.Errorf("verifyBusinessWritable = %v, want error code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestVerifyBusinessWritableUnknownBusiness(t *testing.T) {
+	if err := verifyBusinessWritable(testBusiness("biz1", ""), "biz2"); err == nil {
+		t.Error("verifyBusinessWritable succeeded for an unknown business")
+	}
+}
+
+func TestSweepExpiredGrantsReadsStatusOnce(t *testing.T) {
+	daoBusiness := testBusiness("biz1", BUSINESS_STATUS_ACTIVE)
+	daoAccess := &fakeAccessDao{grants: []utils.Map{
+		{business_common.FLD_APP_ACCESS_ID: "aces1"},
+		{business_common.FLD_APP_ACCESS_ID: "aces2"},
+		{business_common.FLD_APP_ACCESS_ID: "aces3"},
+	}}
+	p := &accessBaseService{daoAccess: daoAccess, daoBusiness: daoBusiness, businessID: "biz1"}
+
+	report, err := p.SweepExpiredGrants(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report[FLD_SWEPT_COUNT] != 3 || len(daoAccess.revoked) != 3 {
+		t.Errorf("swept %v and revoked %v, want the 3 grants", report[FLD_SWEPT_COUNT], daoAccess.revoked)
+	}
+	if daoBusiness.gets != 1 {
+		t.Errorf("business read %d times, want once", daoBusiness.gets)
+	}
+}
+
+func TestSweepExpiredGrantsSuspended(t *testing.T) {
+	daoAccess := &fakeAccessDao{grants: []utils.Map{{business_common.FLD_APP_ACCESS_ID: "aces1"}}}
+	p := &accessBaseService{daoAccess: daoAccess, daoBusiness: testBusiness("biz1", BUSINESS_STATUS_SUSPENDED), businessID: "biz1"}
+
+	var appErr *utils.AppError
+	if _, err := p.SweepExpiredGrants(time.Now()); !errors.As(err, &appErr) || appErr.ErrorCode != ERROR_CODE_BUSINESS_SUSPENDED {
+		t.Errorf("SweepExpiredGrants = %v, want the suspended error", err)
+	}
+	if len(daoAccess.revoked) > 0 {
+		t.Errorf("revoked %v in a suspended business", daoAccess.revoked)
+	}
+}
+
+func TestSharedAccessServiceSkipsStatus(t *testing.T) {
+	daoBusiness := testBusiness("biz1", BUSINESS_STATUS_ACTIVE)
+	daoAccess := &fakeAccessDao{}
+	p := &accessBaseService{daoAccess: daoAccess, daoBusiness: daoBusiness, businessID: "biz1", shared: true}
+
+	for _, accessId := range []string{"aces1", "aces2"} {
+		if err := p.RevokePermission(accessId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if daoBusiness.gets != 0 {
+		t.Errorf("shared service read the business %d times, the caller verified it", daoBusiness.gets)
+	}
+}
@@ -0,0 +1,179 @@
+package business_service
+
+import (
+	"log"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Teardown options and report fields
+const (
+	FLD_TEARDOWN_DRY_RUN     = "dry_run"
+	FLD_TEARDOWN             = "teardown"
+	FLD_TEARDOWN_COMPLETED   = "completed"
+	FLD_TEARDOWN_STARTED_AT  = "started_at"
+	FLD_TEARDOWN_FINISHED_AT = "finished_at"
+	FLD_TEARDOWN_VERIFIED    = "verified"
+	FLD_COLLECTIONS          = "collections"
+	FLD_COLLECTION           = "collection"
+	FLD_RECORDS              = "records"
+	FLD_DELETED              = "deleted"
+	FLD_REMAINING            = "remaining"
+	FLD_TEARDOWN_STATUS      = "status"
+)
+
+// Teardown status of a collection
+const (
+	TEARDOWN_STATUS_PENDING = "pending"
+	TEARDOWN_STATUS_DONE    = "done"
+	// Erased by an earlier interrupted run
+	TEARDOWN_STATUS_RESUMED = "resumed"
+)
+
+// TeardownProgress - Called after each collection, index starts at 1
+type TeardownProgress func(collection string, index int, total int, deleted int64)
+
+// teardownStep - Erasing of one collection
+type teardownStep struct {
+	collection string
+	dao        collectionDao
+}
+
+// Teardown - Erase all the data of the business from every business scoped collection.
+// With dry_run only the number of records of each collection is reported. Completed collections
+// are recorded in the business record, so a run after an interruption continues where it stopped.
+// Each collection is counted again after erasing, deleted records included, the report is verified
+// when nothing remains. An active or suspended business can be erased, tenants are usually suspended
+// when offboarded. A read-only business is being migrated or maintained and is not erased.
+func (p *businessBaseService) Teardown(opts utils.Map, progress TeardownProgress) (utils.Map, error) {
+
+	log.Println("BusinessService::Teardown - Begin", p.businessID, opts)
+
+	dryRun, _ := utils.GetMemberDataBool(opts, FLD_TEARDOWN_DRY_RUN)
+
+	if !dryRun {
+		if err := verifyBusinessErasable(p.daoPlatformBusiness, p.businessID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resume an interrupted teardown
+	completed := map[string]bool{}
+	startedAt := formatDateTime(time.Now())
+	if dataBusiness, err := p.daoBusiness.Get(p.businessID); err == nil {
+		if dataTeardown, ok := getMemberDataMap(dataBusiness, FLD_TEARDOWN); ok {
+			for _, collection := range getMemberDataStrArray(dataTeardown, FLD_TEARDOWN_COMPLETED) {
+				completed[collection] = true
+			}
+			if value, err := utils.GetMemberDataStr(dataTeardown, FLD_TEARDOWN_STARTED_AT); err == nil {
+				startedAt = value
+			}
+		}
+	}
+
+	steps := p.teardownSteps()
+	collections := []utils.Map{}
+	verified := true
+
+	for idx, step := range steps {
+		records, err := step.dao.Count()
+		if err != nil {
+			return nil, err
+		}
+		result := utils.Map{FLD_COLLECTION: step.collection, FLD_RECORDS: records}
+		collections = append(collections, result)
+
+		if dryRun {
+			result[FLD_TEARDOWN_STATUS] = TEARDOWN_STATUS_PENDING
+			if completed[step.collection] {
+				result[FLD_TEARDOWN_STATUS] = TEARDOWN_STATUS_RESUMED
+			}
+			continue
+		}
+
+		var deleted int64
+		if completed[step.collection] && records == 0 {
+			result[FLD_TEARDOWN_STATUS] = TEARDOWN_STATUS_RESUMED
+		} else {
+			deleted, err = step.dao.DeleteAll()
+			if err != nil {
+				return nil, err
+			}
+			result[FLD_TEARDOWN_STATUS] = TEARDOWN_STATUS_DONE
+		}
+		result[FLD_DELETED] = deleted
+
+		remaining, err := step.dao.Count()
+		if err != nil {
+			return nil, err
+		}
+		result[FLD_REMAINING] = remaining
+		verified = verified && remaining == 0
+
+		// Remember the progress while the business record still exists
+		completed[step.collection] = true
+		if step.collection != COLLECTION_BUSINESS {
+			_, err = p.daoBusiness.Update(utils.Map{FLD_TEARDOWN: utils.Map{
+				FLD_TEARDOWN_STARTED_AT: startedAt,
+				FLD_TEARDOWN_COMPLETED:  sortedKeys(completed),
+			}})
+			if err != nil {
+				log.Println("Teardown: Progress not saved ", step.collection, err)
+				return nil, err
+			}
+		}
+
+		if progress != nil {
+			progress(step.collection, idx+1, len(steps), deleted)
+		}
+	}
+
+	report := utils.Map{
+		business_common.FLD_BUSINESS_ID: p.businessID,
+		FLD_TEARDOWN_DRY_RUN:            dryRun,
+		FLD_COLLECTIONS:                 collections,
+		FLD_TEARDOWN_STARTED_AT:         startedAt,
+	}
+	if !dryRun {
+		report[FLD_TEARDOWN_FINISHED_AT] = formatDateTime(time.Now())
+		report[FLD_TEARDOWN_VERIFIED] = verified
+	}
+
+	log.Println("BusinessService::Teardown - End", verified)
+	return report, nil
+}
+
+// verifyBusinessErasable - Only an active or suspended business can be erased
+func verifyBusinessErasable(daoBusiness platform_repository.BusinessDao, businessId string) error {
+	dataBusiness, err := daoBusiness.Get(businessId)
+	if err != nil {
+		return err
+	}
+
+	if status := getBusinessStatus(dataBusiness); status != BUSINESS_STATUS_ACTIVE && status != BUSINESS_STATUS_SUSPENDED {
+		err := &utils.AppError{ErrorCode: ERROR_CODE_BUSINESS_READ_ONLY, ErrorMsg: "Business is read-only", ErrorDetail: "Business " + businessId + " is " + status + ", it cannot be erased"}
+		return err
+	}
+	return nil
+}
+
+// teardownSteps - All the business scoped collections in the order they are erased
+func (p *businessBaseService) teardownSteps() []teardownStep {
+	collections := businessCollections()
+
+	steps := []teardownStep{}
+	for idx := len(collections) - 1; idx >= 0; idx-- {
+		entity := collections[idx]
+		if entity.collection == COLLECTION_BUSINESS {
+			// Members are unlinked while the business record still exists
+			daoMember := newCollectionDao(p.GetClient(), p.businessID, platform_common.DbPlatformBusinessUser, platform_common.FLD_BUSINESS_USER_ID)
+			steps = append(steps, teardownStep{COLLECTION_MEMBER, daoMember})
+		}
+		steps = append(steps, teardownStep{entity.collection, entity.dao(p.dbRegion.GetClient(), p.businessID)})
+	}
+	return steps
+}
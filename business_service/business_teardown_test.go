@@ -0,0 +1,40 @@
+package business_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestVerifyBusinessErasable(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		wantErr bool
+	}{
+		{"active", BUSINESS_STATUS_ACTIVE, false},
+		{"suspended for offboarding", BUSINESS_STATUS_SUSPENDED, false},
+		{"read-only while migrating", BUSINESS_STATUS_READ_ONLY, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyBusinessErasable(testBusiness("biz1", tt.status), "biz1")
+			var appErr *utils.AppError
+			if tt.wantErr && (!errors.As(err, &appErr) || appErr.ErrorCode != ERROR_CODE_BUSINESS_READ_ONLY) {
+				t.Errorf("verifyBusinessErasable = %v, want the read-only error", err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("verifyBusinessErasable = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestTeardownReadOnlyBusiness(t *testing.T) {
+	p := &businessBaseService{daoPlatformBusiness: testBusiness("biz1", BUSINESS_STATUS_READ_ONLY), businessID: "biz1"}
+
+	// Rejected before any collection is touched
+	if _, err := p.Teardown(utils.Map{}, nil); err == nil {
+		t.Error("Teardown of a read-only business succeeded")
+	}
+}
@@ -0,0 +1,213 @@
+package business_service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// buildFilter - Convert the given conditions into the JSON filter used by the Dao's
+func buildFilter(conditions utils.Map) string {
+	filter, err := json.Marshal(conditions)
+	if err != nil {
+		return ""
+	}
+	return string(filter)
+}
+
+// combineFilters - Combine the JSON filters so that all of them have to match
+func combineFilters(filters ...string) string {
+	conditions := []any{}
+	for _, filter := range filters {
+		if len(filter) > 0 {
+			conditions = append(conditions, json.RawMessage(filter))
+		}
+	}
+
+	switch len(conditions) {
+	case 0:
+		return ""
+	case 1:
+		return string(conditions[0].(json.RawMessage))
+	}
+	return buildFilter(utils.Map{"$and": conditions})
+}
+
+// getListResult - Get the records from the response of a Dao's List
+func getListResult(response utils.Map) []utils.Map {
+	if dataVal, dataOk := response[db_common.LIST_RESULT]; dataOk {
+		if listData, ok := dataVal.([]utils.Map); ok {
+			return listData
+		}
+	}
+	return []utils.Map{}
+}
+
+// getMemberDataStrArray - Get the string array member, whatever slice type the database returned
+func getMemberDataStrArray(data utils.Map, memberName string) []string {
+	values := []string{}
+
+	dataVal, dataOk := data[memberName]
+	if !dataOk || dataVal == nil {
+		return values
+	}
+
+	refVal := reflect.ValueOf(dataVal)
+	if refVal.Kind() != reflect.Slice && refVal.Kind() != reflect.Array {
+		if strVal, ok := dataVal.(string); ok && len(strVal) > 0 {
+			values = append(values, strVal)
+		}
+		return values
+	}
+
+	for idx := 0; idx < refVal.Len(); idx++ {
+		if strVal, ok := refVal.Index(idx).Interface().(string); ok && len(strVal) > 0 {
+			values = append(values, strVal)
+		}
+	}
+	return values
+}
+
+// sortedKeys - Get the keys of the given set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// removeString - Get the values without the given value
+func removeString(values []string, value string) []string {
+	result := []string{}
+	for _, item := range values {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// matchPermission - Check whether the permission is covered by any of the granted permissions
+func matchPermission(granted []string, permission string) bool {
+	for _, grant := range granted {
+		if grant == permission || grant == PERMISSION_ALL {
+			return true
+		}
+		// Wildcard for all the actions of a module, e.g. "contact.*"
+		if strings.HasSuffix(grant, PERMISSION_SEPARATOR+PERMISSION_ALL) &&
+			strings.HasPrefix(permission, strings.TrimSuffix(grant, PERMISSION_ALL)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatDateTime - Format the time as UTC RFC3339 so that stored values compare as strings
+func formatDateTime(value time.Time) string {
+	return value.UTC().Format(time.RFC3339)
+}
+
+// parseDateTime - Parse a time given as time.Time, RFC3339 string or "YYYY-MM-DD HH:MM:SS" UTC string
+func parseDateTime(value any) (time.Time, error) {
+	switch dataVal := value.(type) {
+	case time.Time:
+		return dataVal, nil
+	case interface{ Time() time.Time }:
+		// Database date type
+		return dataVal.Time(), nil
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, dataVal); err == nil {
+			return parsed, nil
+		}
+		return time.ParseInLocation(time.DateTime, dataVal, time.UTC)
+	}
+	return time.Time{}, errors.New("unsupported date time value")
+}
+
+// getMemberDataMapArray - Get the array of documents member, whatever slice type the database returned
+func getMemberDataMapArray(data utils.Map, memberName string) []utils.Map {
+	values := []utils.Map{}
+
+	dataVal, dataOk := data[memberName]
+	if !dataOk || dataVal == nil {
+		return values
+	}
+
+	refVal := reflect.ValueOf(dataVal)
+	if refVal.Kind() != reflect.Slice && refVal.Kind() != reflect.Array {
+		return values
+	}
+
+	mapType := reflect.TypeOf(utils.Map{})
+	for idx := 0; idx < refVal.Len(); idx++ {
+		item := reflect.ValueOf(refVal.Index(idx).Interface())
+		if item.IsValid() && item.Kind() == reflect.Map && item.Type().ConvertibleTo(mapType) {
+			values = append(values, item.Convert(mapType).Interface().(utils.Map))
+		}
+	}
+	return values
+}
+
+// getMemberDataMap - Get the document member, whatever map type the database returned
+func getMemberDataMap(data utils.Map, memberName string) (utils.Map, bool) {
+	dataVal, dataOk := data[memberName]
+	if !dataOk || dataVal == nil {
+		return nil, false
+	}
+
+	mapType := reflect.TypeOf(utils.Map{})
+	refVal := reflect.ValueOf(dataVal)
+	if refVal.Kind() != reflect.Map || !refVal.Type().ConvertibleTo(mapType) {
+		return nil, false
+	}
+	return refVal.Convert(mapType).Interface().(utils.Map), true
+}
+
+// containsString - Check whether the value is in the list
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// recordExists - Check the error of a Dao's Get, a missing record is not an error
+func recordExists(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return false, err
+}
+
+// getMemberDataFloat - Get the numeric member as float64, whatever number type the database returned
+func getMemberDataFloat(data utils.Map, memberName string) (float64, bool) {
+	dataVal, dataOk := data[memberName]
+	if !dataOk || dataVal == nil {
+		return 0, false
+	}
+
+	refVal := reflect.ValueOf(dataVal)
+	switch {
+	case refVal.CanInt():
+		return float64(refVal.Int()), true
+	case refVal.CanUint():
+		return float64(refVal.Uint()), true
+	case refVal.CanFloat():
+		return refVal.Float(), true
+	}
+	return 0, false
+}
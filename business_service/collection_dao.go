@@ -0,0 +1,335 @@
+package business_service
+
+import (
+	"context"
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-dbutils/mongo_utils"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections of the region database kept by this module rather than golib-business-repository
+const (
+	DbBusinessAccessReviews = db_common.DB_COLLECTION_PREFIX + "business_access_reviews"
+	DbBusinessUserInvites   = db_common.DB_COLLECTION_PREFIX + "business_user_invites"
+	DbBusinessGroups        = db_common.DB_COLLECTION_PREFIX + "business_groups"
+)
+
+// collectionDao - Dao of a business scoped collection, with the methods of the repository Daos.
+// ListAll, Insert, Count and DeleteAll work on the records as stored, deleted ones included.
+type collectionDao interface {
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	Get(id string) (utils.Map, error)
+	Find(filter string) (utils.Map, error)
+	Create(indata utils.Map) (utils.Map, error)
+	Update(id string, indata utils.Map) (utils.Map, error)
+	UpdateItem(id string, field string, itemField string, itemId string, indata utils.Map) (int64, error)
+	Delete(id string) (int64, error)
+	ListAll() ([]utils.Map, error)
+	Insert(indata utils.Map) error
+	Count() (int64, error)
+	DeleteAll() (int64, error)
+}
+
+// collectionMongoDBDao - collectionDao of a MongoDB region database
+type collectionMongoDBDao struct {
+	client     utils.Map
+	businessId string
+	collection string
+	idField    string
+}
+
+// newCollectionDao - Dao of the collection, the records are keyed by idField within the business
+func newCollectionDao(client utils.Map, businessId string, collection string, idField string) collectionDao {
+	log.Println("Initialize CollectionDao", collection)
+	return &collectionMongoDBDao{client: client, businessId: businessId, collection: collection, idField: idField}
+}
+
+// newAccessReviewDao - Dao of the access review campaigns
+func newAccessReviewDao(client utils.Map, businessId string) collectionDao {
+	return newCollectionDao(client, businessId, DbBusinessAccessReviews, FLD_REVIEW_ID)
+}
+
+// newUserInviteDao - Dao of the user invitations
+func newUserInviteDao(client utils.Map, businessId string) collectionDao {
+	return newCollectionDao(client, businessId, DbBusinessUserInvites, FLD_INVITE_ID)
+}
+
+// newGroupDao - Dao of the user groups
+func newGroupDao(client utils.Map, businessId string) collectionDao {
+	return newCollectionDao(client, businessId, DbBusinessGroups, FLD_GROUP_ID)
+}
+
+// getCollection - The MongoDB collection, other database types are not supported
+func (t *collectionMongoDBDao) getCollection() (*mongo.Collection, context.Context, error) {
+	if dbType, _ := db_common.GetDatabaseType(t.client); dbType != db_common.DATABASE_TYPE_MONGODB {
+		err := &utils.AppError{ErrorCode: business_common.GetServiceModuleCode() + "00" + "01", ErrorMsg: "Database type not supported",
+			ErrorDetail: t.collection + " is only available in MongoDB region databases"}
+		return nil, nil, err
+	}
+	return mongo_utils.GetMongoDbCollection(t.client, t.collection)
+}
+
+// businessFilter - Filter of the records of the business, with the given filter and not deleted
+func (t *collectionMongoDBDao) businessFilter(filter string) bson.D {
+	filterdoc := bson.D{}
+	if len(filter) > 0 {
+		err := bson.UnmarshalExtJSON([]byte(filter), true, &filterdoc)
+		if err != nil {
+			log.Println("Unmarshal Ext JSON error", err)
+		}
+	}
+	return append(filterdoc,
+		bson.E{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId},
+		bson.E{Key: db_common.FLD_IS_DELETED, Value: false})
+}
+
+// List - List the records of the business
+func (t *collectionMongoDBDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	var results []utils.Map
+
+	log.Println("Begin - Find All Collection Dao", t.collection)
+
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find()
+	filterdoc := t.businessFilter(filter)
+
+	if len(sort) > 0 {
+		var sortdoc interface{}
+		err = bson.UnmarshalExtJSON([]byte(sort), true, &sortdoc)
+		if err != nil {
+			log.Println("Sort Unmarshal Error ", sort)
+		} else {
+			opts.SetSort(sortdoc)
+		}
+	}
+	if skip > 0 {
+		opts.SetSkip(skip)
+	}
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := collection.Find(ctx, filterdoc, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	listdata := []utils.Map{}
+	for _, value := range results {
+		listdata = append(listdata, db_common.AmendFldsForGet(value))
+	}
+
+	filtercount, err := collection.CountDocuments(ctx, filterdoc)
+	if err != nil {
+		return nil, err
+	}
+	totalcount, err := collection.CountDocuments(ctx, t.businessFilter(""))
+	if err != nil {
+		return nil, err
+	}
+
+	response := utils.Map{
+		db_common.LIST_SUMMARY: utils.Map{
+			db_common.LIST_TOTALSIZE:    totalcount,
+			db_common.LIST_FILTEREDSIZE: filtercount,
+			db_common.LIST_RESULTSIZE:   len(listdata),
+		},
+		db_common.LIST_RESULT: listdata,
+	}
+
+	log.Println("End - Find All Collection Dao", t.collection, len(listdata))
+	return response, nil
+}
+
+// Get - Get the record by its id
+func (t *collectionMongoDBDao) Get(id string) (utils.Map, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := append(t.businessFilter(""), bson.E{Key: t.idField, Value: id})
+	return t.findOne(collection, ctx, filter)
+}
+
+// Find - Find the first record matching the filter
+func (t *collectionMongoDBDao) Find(filter string) (utils.Map, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.findOne(collection, ctx, t.businessFilter(filter))
+}
+
+// findOne - Decode the single record of the filter
+func (t *collectionMongoDBDao) findOne(collection *mongo.Collection, ctx context.Context, filter bson.D) (utils.Map, error) {
+	var result utils.Map
+
+	singleResult := collection.FindOne(ctx, filter)
+	if singleResult.Err() != nil {
+		log.Println("Find:: Record not found ", t.collection, singleResult.Err())
+		return nil, singleResult.Err()
+	}
+	if err := singleResult.Decode(&result); err != nil {
+		log.Println("Error in decode", err)
+		return nil, err
+	}
+	return db_common.AmendFldsForGet(result), nil
+}
+
+// Create - Insert the record into the business
+func (t *collectionMongoDBDao) Create(indata utils.Map) (utils.Map, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	indata[business_common.FLD_BUSINESS_ID] = t.businessId
+	indata = db_common.AmendFldsforCreate(indata)
+
+	insertResult, err := collection.InsertOne(ctx, indata)
+	if err != nil {
+		log.Println("Error in insert ", err)
+		return nil, err
+	}
+	log.Println("Inserted a single document: ", t.collection, insertResult.InsertedID)
+
+	return db_common.AmendFldsForGet(indata), nil
+}
+
+// Update - Update the fields of the record
+func (t *collectionMongoDBDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	indata = db_common.AmendFldsforUpdate(indata)
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}, {Key: t.idField, Value: id}}
+	updateResult, err := collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: indata}})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Update a single document: ", t.collection, updateResult.ModifiedCount)
+
+	return indata, nil
+}
+
+// UpdateItem - Set the given fields of the item whose itemField is itemId in the list field of the record,
+// in place, so the other items and concurrent changes to them are kept. Returns the number of records changed.
+func (t *collectionMongoDBDao) UpdateItem(id string, field string, itemField string, itemId string, indata utils.Map) (int64, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	setdoc := db_common.AmendFldsforUpdate(utils.Map{})
+	for key, value := range indata {
+		setdoc[field+".$[item]."+key] = value
+	}
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}, {Key: t.idField, Value: id}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"item." + itemField: itemId}}})
+	updateResult, err := collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: setdoc}}, opts)
+	if err != nil {
+		return 0, err
+	}
+	log.Println("Update an item of a single document: ", t.collection, updateResult.ModifiedCount)
+
+	return updateResult.ModifiedCount, nil
+}
+
+// Delete - Remove the record permanently
+func (t *collectionMongoDBDao) Delete(id string) (int64, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}, {Key: t.idField, Value: id}}
+	res, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		log.Println("Error in delete ", err)
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// ListAll - Every record of the business as stored, deleted ones included
+func (t *collectionMongoDBDao) ListAll() ([]utils.Map, error) {
+	var results []utils.Map
+
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if results == nil {
+		results = []utils.Map{}
+	}
+	return results, nil
+}
+
+// Insert - Insert the record as it is, with its own business id, timestamps and deleted flag
+func (t *collectionMongoDBDao) Insert(indata utils.Map) error {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.InsertOne(ctx, indata)
+	if err != nil {
+		log.Println("Error in insert ", err)
+	}
+	return err
+}
+
+// Count - Number of records of the business, deleted ones included
+func (t *collectionMongoDBDao) Count() (int64, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}}
+	return collection.CountDocuments(ctx, filter)
+}
+
+// DeleteAll - Remove every record of the business permanently, deleted ones included
+func (t *collectionMongoDBDao) DeleteAll() (int64, error) {
+	collection, ctx, err := t.getCollection()
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.D{{Key: business_common.FLD_BUSINESS_ID, Value: t.businessId}}
+	res, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		log.Println("Error in delete ", err)
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
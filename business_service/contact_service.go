@@ -31,11 +31,12 @@ type ContactService interface {
 // ContactBaseService - Contacts Service structure
 type contactBaseService struct {
 	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
-	daoContact  business_repository.ContactDao
-	daoBusiness platform_repository.BusinessDao
-	child       ContactService
-	businessID  string
+	dbRegion       db_utils.DatabaseService
+	daoContact     business_repository.ContactDao
+	daoBusiness    platform_repository.BusinessDao
+	child          ContactService
+	businessID     string
+	businessStatus string
 }
 
 func init() {
@@ -72,12 +73,18 @@ func NewContactService(props utils.Map) (ContactService, error) {
 	// Initialize other Service
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid business_id", ErrorDetail: "Given business_id is not exist"}
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -132,6 +139,10 @@ func (p *contactBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	dataval, dataok := indata[business_common.FLD_APP_CONTACT_ID]
 	if !dataok {
 		uid := utils.GenerateUniqueId("cont")
@@ -161,6 +172,10 @@ func (p *contactBaseService) Update(contact_id string, indata utils.Map) (utils.
 
 	log.Println("ContactService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	data, err := p.daoContact.Get(contact_id)
 	if err != nil {
 		return data, err
@@ -176,6 +191,10 @@ func (p *contactBaseService) Delete(contact_id string) error {
 
 	log.Println("ContactService::Delete - Begin", contact_id)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
 	daoContact := p.daoContact
 	result, err := daoContact.Delete(contact_id)
 	if err != nil {
@@ -0,0 +1,320 @@
+package business_service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Delete options and references fields
+const (
+	// Move the references to the given id and delete
+	FLD_DELETE_REASSIGN_TO = "reassign_to"
+	// Remove or clear the references and delete
+	FLD_DELETE_CASCADE = "cascade"
+
+	FLD_REFERENCES      = "references"
+	FLD_REFERENCE_KIND  = "kind"
+	FLD_REFERENCE_FIELD = "field"
+	FLD_REFERENCE_IDS   = "ids"
+	FLD_REASSIGNED      = "reassigned"
+	FLD_CASCADED        = "cascaded"
+)
+
+// Kinds of referring records
+const (
+	REFERENCE_KIND_ACCESS    = "access"
+	REFERENCE_KIND_ROLE      = "role"
+	REFERENCE_KIND_USER      = "user"
+	REFERENCE_KIND_USERTYPE  = "usertype"
+	REFERENCE_KIND_SITE      = "site"
+	REFERENCE_KIND_TERRITORY = "territory"
+)
+
+// reference - Records of one kind which may refer to the record to delete
+type reference struct {
+	kind    string
+	field   string
+	idField string
+	// Whether the field holds a list of ids
+	multi bool
+	list  func(filter string) (utils.Map, error)
+	// Change the referring record, the changes replace the referring field
+	update func(dataRef utils.Map, changes utils.Map) error
+	// Remove the referring record on cascade, when nil the field is cleared instead
+	remove func(dataRef utils.Map) error
+}
+
+// findReferences - Find the records referring to the id, one entry for each kind that has any
+func findReferences(refs []reference, id string) ([]utils.Map, error) {
+	found := []utils.Map{}
+	for _, ref := range refs {
+		dataRefs, err := ref.find(id)
+		if err != nil {
+			return nil, err
+		}
+		if len(dataRefs) == 0 {
+			continue
+		}
+
+		refIds := []string{}
+		for _, dataRef := range dataRefs {
+			refId, _ := utils.GetMemberDataStr(dataRef, ref.idField)
+			refIds = append(refIds, refId)
+		}
+		found = append(found, utils.Map{
+			FLD_REFERENCE_KIND:  ref.kind,
+			FLD_REFERENCE_FIELD: ref.field,
+			FLD_REFERENCE_IDS:   refIds,
+		})
+	}
+	return found, nil
+}
+
+// verifyNoReferences - Return an error when any record refers to the id. Its ErrorDetail holds
+// the references as JSON, each with the kind, the referring field and the ids of the referring records.
+func verifyNoReferences(funcode string, entity string, refs []reference, id string) error {
+	found, err := findReferences(refs, id)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	kinds := []string{}
+	for _, ref := range found {
+		kind, _ := utils.GetMemberDataStr(ref, FLD_REFERENCE_KIND)
+		kinds = append(kinds, fmt.Sprintf("%s (%d)", kind, len(getMemberDataStrArray(ref, FLD_REFERENCE_IDS))))
+	}
+
+	detail, err := json.Marshal(found)
+	if err != nil {
+		return err
+	}
+
+	err = &utils.AppError{ErrorCode: funcode, ErrorMsg: fmt.Sprintf("Delete blocked, %s %s is referred by %s", entity, id, strings.Join(kinds, ", ")),
+		ErrorDetail: string(detail)}
+	return err
+}
+
+// resolveReferences - Reassign the references to toId, or with empty toId remove or clear them.
+// Returns the handled references in the same form as the error of verifyNoReferences.
+func resolveReferences(refs []reference, id string, toId string) ([]utils.Map, error) {
+	handled := []utils.Map{}
+	for _, ref := range refs {
+		dataRefs, err := ref.find(id)
+		if err != nil {
+			return nil, err
+		}
+
+		refIds := []string{}
+		for _, dataRef := range dataRefs {
+			refId, _ := utils.GetMemberDataStr(dataRef, ref.idField)
+
+			switch {
+			case len(toId) == 0 && ref.remove != nil:
+				err = ref.remove(dataRef)
+			case ref.multi:
+				values := removeString(getMemberDataStrArray(dataRef, ref.field), id)
+				if len(toId) > 0 && refId != toId && !containsString(values, toId) {
+					values = append(values, toId)
+				}
+				err = ref.update(dataRef, utils.Map{ref.field: values})
+			default:
+				err = ref.update(dataRef, utils.Map{ref.field: toId})
+			}
+			if err != nil {
+				return nil, err
+			}
+			refIds = append(refIds, refId)
+		}
+
+		if len(refIds) > 0 {
+			handled = append(handled, utils.Map{
+				FLD_REFERENCE_KIND:  ref.kind,
+				FLD_REFERENCE_FIELD: ref.field,
+				FLD_REFERENCE_IDS:   refIds,
+			})
+		}
+	}
+	return handled, nil
+}
+
+// handleReferences - Reassign or cascade the references when asked to, and report what was done
+func handleReferences(refs []reference, id string, toId string, cascade bool) (utils.Map, error) {
+	summary := utils.Map{}
+	if len(toId) == 0 && !cascade {
+		return summary, nil
+	}
+
+	handled, err := resolveReferences(refs, id, toId)
+	if err != nil {
+		return nil, err
+	}
+
+	if cascade {
+		summary[FLD_CASCADED] = handled
+	} else {
+		summary[FLD_DELETE_REASSIGN_TO] = toId
+		summary[FLD_REASSIGNED] = handled
+	}
+	return summary, nil
+}
+
+// getDeleteOptions - Get the reassign target and cascade mode, only one of them may be given
+func getDeleteOptions(funcode string, id string, opts utils.Map) (string, bool, error) {
+	toId, _ := utils.GetMemberDataStr(opts, FLD_DELETE_REASSIGN_TO)
+	cascade, _ := utils.GetMemberDataBool(opts, FLD_DELETE_CASCADE)
+
+	if len(toId) > 0 && cascade {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid delete options", ErrorDetail: "Give either reassign_to or cascade"}
+		return "", false, err
+	}
+	if toId == id {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid delete options", ErrorDetail: "Cannot reassign to the record being deleted"}
+		return "", false, err
+	}
+	return toId, cascade, nil
+}
+
+// find - List the records of the kind referring to the id
+func (ref reference) find(id string) ([]utils.Map, error) {
+	response, err := ref.list(buildFilter(utils.Map{ref.field: id}))
+	if err != nil {
+		return nil, err
+	}
+	return getListResult(response), nil
+}
+
+// grantReference - Access grants referring through the given field, changed grants are stored under their new access id
+func grantReference(daoAccess business_repository.AccessDao, field string) reference {
+	return reference{
+		kind:    REFERENCE_KIND_ACCESS,
+		field:   field,
+		idField: business_common.FLD_APP_ACCESS_ID,
+		list: func(filter string) (utils.Map, error) {
+			return daoAccess.List("", filter, "", 0, 0)
+		},
+		update: func(dataRef utils.Map, changes utils.Map) error {
+			return rekeyGrant(daoAccess, dataRef, changes)
+		},
+		remove: func(dataRef utils.Map) error {
+			accessId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_APP_ACCESS_ID)
+			_, err := daoAccess.RevokePermission(accessId)
+			return err
+		},
+	}
+}
+
+// userTypeDefaultsReference - User types having the id in their default grants
+func userTypeDefaultsReference(daoUserType business_repository.UserTypeDao, field string) reference {
+	return reference{
+		kind:    REFERENCE_KIND_USERTYPE,
+		field:   field,
+		idField: business_common.FLD_USERTYPE_ID,
+		multi:   true,
+		list: func(filter string) (utils.Map, error) {
+			return daoUserType.List(filter, "", 0, 0)
+		},
+		update: func(dataRef utils.Map, changes utils.Map) error {
+			userTypeId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_USERTYPE_ID)
+			_, err := daoUserType.Update(userTypeId, changes)
+			return err
+		},
+	}
+}
+
+// siteReference - Sites referring through the given field
+func siteReference(daoSite business_repository.SiteDao, field string, multi bool) reference {
+	return reference{
+		kind:    REFERENCE_KIND_SITE,
+		field:   field,
+		idField: business_common.FLD_APP_SITE_ID,
+		multi:   multi,
+		list: func(filter string) (utils.Map, error) {
+			return daoSite.List(filter, "", 0, 0)
+		},
+		update: func(dataRef utils.Map, changes utils.Map) error {
+			siteId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_APP_SITE_ID)
+			_, err := daoSite.Update(siteId, changes)
+			return err
+		},
+	}
+}
+
+// territoryReference - Territories referring through the given field
+func territoryReference(daoTerritory business_repository.TerritoryDao, field string, multi bool) reference {
+	return reference{
+		kind:    REFERENCE_KIND_TERRITORY,
+		field:   field,
+		idField: business_common.FLD_APP_TERRITORY_ID,
+		multi:   multi,
+		list: func(filter string) (utils.Map, error) {
+			return daoTerritory.List(filter, "", 0, 0)
+		},
+		update: func(dataRef utils.Map, changes utils.Map) error {
+			territoryId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_APP_TERRITORY_ID)
+			_, err := daoTerritory.Update(territoryId, changes)
+			return err
+		},
+	}
+}
+
+// referredIds - Ids of the handled references of the kind, each once whatever the field
+func referredIds(handled []utils.Map, kind string) []string {
+	ids := []string{}
+	for _, ref := range handled {
+		if ref[FLD_REFERENCE_KIND] != kind {
+			continue
+		}
+		for _, id := range getMemberDataStrArray(ref, FLD_REFERENCE_IDS) {
+			if !containsString(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// rekeyGrant - Apply the changes to the grant and store it under the access id matching its new fields
+func rekeyGrant(daoAccess business_repository.AccessDao, dataGrant utils.Map, changes utils.Map) error {
+	oldAccessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+
+	newGrant := utils.MergeMap(dataGrant, changes, true)
+	delete(newGrant, "_id")
+	if siteId, _ := utils.GetMemberDataStr(newGrant, business_common.FLD_APP_SITE_ID); len(siteId) == 0 {
+		delete(newGrant, business_common.FLD_APP_SITE_ID)
+	}
+	newAccessId := grantAccessId(newGrant)
+	newGrant[business_common.FLD_APP_ACCESS_ID] = newAccessId
+
+	if newAccessId != oldAccessId {
+		_, err := daoAccess.RevokePermission(oldAccessId)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := daoAccess.GrantPermission(newGrant)
+	return err
+}
+
+// grantAccessId - Generate the access id of the grant from its fields, the same way GrantPermission does
+func grantAccessId(dataGrant utils.Map) string {
+	userId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_USER_ID)
+	if groupId, err := utils.GetMemberDataStr(dataGrant, FLD_GROUP_ID); err == nil {
+		userId = GROUP_ACCESS_PREFIX + groupId
+	}
+	siteId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_SITE_ID)
+	scope, _ := utils.GetMemberDataStr(dataGrant, FLD_GRANT_SCOPE)
+
+	if source, _ := utils.GetMemberDataStr(dataGrant, FLD_GRANT_SOURCE); source == GRANT_SOURCE_USERTYPE {
+		roleId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_ROLE_ID)
+		return generateAutoAccessId(userId, siteId, roleId)
+	}
+	return generateAccessId(userId, siteId, scope)
+}
@@ -0,0 +1,118 @@
+package business_service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testTerritorySites - Sites of territories territory_1 and territory_2
+func testTerritorySites() *fakeSiteDao {
+	return &fakeSiteDao{sites: map[string]utils.Map{
+		"site_1": {business_common.FLD_APP_SITE_ID: "site_1", business_common.FLD_APP_TERRITORY_ID: "territory_1"},
+		"site_2": {business_common.FLD_APP_SITE_ID: "site_2", business_common.FLD_APP_TERRITORY_ID: "territory_2"},
+	}}
+}
+
+func TestGetDeleteOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        utils.Map
+		wantToId    string
+		wantCascade bool
+		wantErr     bool
+	}{
+		{"no options", utils.Map{}, "", false, false},
+		{"reassign", utils.Map{FLD_DELETE_REASSIGN_TO: "site_2"}, "site_2", false, false},
+		{"cascade", utils.Map{FLD_DELETE_CASCADE: true}, "", true, false},
+		{"both", utils.Map{FLD_DELETE_REASSIGN_TO: "site_2", FLD_DELETE_CASCADE: true}, "", false, true},
+		{"reassign to itself", utils.Map{FLD_DELETE_REASSIGN_TO: "site_1"}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toId, cascade, err := getDeleteOptions("test", "site_1", tt.opts)
+			if (err != nil) != tt.wantErr || toId != tt.wantToId || cascade != tt.wantCascade {
+				t.Errorf("getDeleteOptions = %q, %v, %v, want %q, %v, error %v", toId, cascade, err, tt.wantToId, tt.wantCascade, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyNoReferences(t *testing.T) {
+	refs := []reference{siteReference(testTerritorySites(), business_common.FLD_APP_TERRITORY_ID, false)}
+
+	if err := verifyNoReferences("test01", "Territory", refs, "territory_3"); err != nil {
+		t.Errorf("verifyNoReferences of an unreferred territory = %v, want nil", err)
+	}
+
+	err := verifyNoReferences("test01", "Territory", refs, "territory_1")
+	var appErr *utils.AppError
+	if !errors.As(err, &appErr) || appErr.ErrorCode != "test01" {
+		t.Fatalf("verifyNoReferences = %v, want the blocked error", err)
+	}
+	found := []utils.Map{}
+	if err := json.Unmarshal([]byte(appErr.ErrorDetail), &found); err != nil {
+		t.Fatal(err)
+	}
+	want := []utils.Map{{FLD_REFERENCE_KIND: REFERENCE_KIND_SITE, FLD_REFERENCE_FIELD: business_common.FLD_APP_TERRITORY_ID, FLD_REFERENCE_IDS: []any{"site_1"}}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("references = %v, want %v", found, want)
+	}
+}
+
+func TestHandleReferencesReassign(t *testing.T) {
+	daoSite := testTerritorySites()
+	refs := []reference{siteReference(daoSite, business_common.FLD_APP_TERRITORY_ID, false)}
+
+	summary, err := handleReferences(refs, "territory_1", "territory_2", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary[FLD_DELETE_REASSIGN_TO] != "territory_2" || len(summary[FLD_REASSIGNED].([]utils.Map)) != 1 {
+		t.Errorf("summary = %v, want site_1 reassigned to territory_2", summary)
+	}
+	if territoryId := daoSite.sites["site_1"][business_common.FLD_APP_TERRITORY_ID]; territoryId != "territory_2" {
+		t.Errorf("site_1 territory = %v, want territory_2", territoryId)
+	}
+}
+
+func TestHandleReferencesWithoutOptions(t *testing.T) {
+	daoSite := testTerritorySites()
+	refs := []reference{siteReference(daoSite, business_common.FLD_APP_TERRITORY_ID, false)}
+
+	summary, err := handleReferences(refs, "territory_1", "", false)
+	if err != nil || len(summary) > 0 {
+		t.Errorf("handleReferences = %v, %v, want nothing done", summary, err)
+	}
+	if territoryId := daoSite.sites["site_1"][business_common.FLD_APP_TERRITORY_ID]; territoryId != "territory_1" {
+		t.Errorf("site_1 territory = %v, want it unchanged", territoryId)
+	}
+}
+
+func TestRekeyGrant(t *testing.T) {
+	oldAccessId := generateAccessId("user1", "site_1", GRANT_SCOPE_SELF)
+	dataGrant := utils.Map{
+		business_common.FLD_APP_ACCESS_ID: oldAccessId,
+		business_common.FLD_USER_ID:       "user1",
+		business_common.FLD_APP_SITE_ID:   "site_1",
+		FLD_GRANT_SCOPE:                   GRANT_SCOPE_SELF,
+	}
+	daoAccess := &fakeAccessDao{grants: []utils.Map{dataGrant}}
+
+	err := rekeyGrant(daoAccess, dataGrant, utils.Map{business_common.FLD_APP_SITE_ID: "site_2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAccessId := generateAccessId("user1", "site_2", GRANT_SCOPE_SELF)
+	if !reflect.DeepEqual(daoAccess.revoked, []string{oldAccessId}) {
+		t.Errorf("revoked %v, want the old grant %s", daoAccess.revoked, oldAccessId)
+	}
+	if dataNew, err := daoAccess.Get(newAccessId); err != nil || dataNew[business_common.FLD_APP_SITE_ID] != "site_2" {
+		t.Errorf("new grant = %v %v, want it on site_2", dataNew, err)
+	}
+}
@@ -0,0 +1,480 @@
+package business_service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-utils/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Fakes of the Daos for the tests, the methods not implemented panic through the nil embedded Dao
+
+// fakeUserDao - UserDao of the given users, List, Get, Create and Update are implemented
+type fakeUserDao struct {
+	business_repository.UserDao
+	users map[string]utils.Map
+}
+
+func (t *fakeUserDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return listResponse(filterRecords(mapValues(t.users), filter)), nil
+}
+
+func (t *fakeUserDao) Get(id string) (utils.Map, error) {
+	dataUser, ok := t.users[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataUser, nil
+}
+
+func (t *fakeUserDao) Create(indata utils.Map) (utils.Map, error) {
+	t.users[indata[business_common.FLD_USER_ID].(string)] = indata
+	return indata, nil
+}
+
+func (t *fakeUserDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	dataUser, ok := t.users[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	t.users[id] = utils.MergeMap(dataUser, indata, true)
+	return indata, nil
+}
+
+// fakeAppUserDao - AppUserDao of the given AppUsers counting the Lists, List, Get and Find are implemented
+type fakeAppUserDao struct {
+	platform_repository.AppUserDao
+	appUsers map[string]utils.Map
+	lists    int
+}
+
+func (t *fakeAppUserDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	t.lists++
+	return listResponse(filterRecords(mapValues(t.appUsers), filter)), nil
+}
+
+func (t *fakeAppUserDao) Get(id string) (utils.Map, error) {
+	dataAppUser, ok := t.appUsers[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataAppUser, nil
+}
+
+func (t *fakeAppUserDao) Find(filter string) (utils.Map, error) {
+	found := filterRecords(mapValues(t.appUsers), filter)
+	if len(found) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return found[0], nil
+}
+
+// fakeSiteDao - SiteDao of the given sites, List, Get, Create and Update are implemented
+type fakeSiteDao struct {
+	business_repository.SiteDao
+	sites map[string]utils.Map
+}
+
+func (t *fakeSiteDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return listResponse(filterRecords(mapValues(t.sites), filter)), nil
+}
+
+func (t *fakeSiteDao) Get(id string) (utils.Map, error) {
+	dataSite, ok := t.sites[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataSite, nil
+}
+
+func (t *fakeSiteDao) Create(indata utils.Map) (utils.Map, error) {
+	t.sites[indata[business_common.FLD_APP_SITE_ID].(string)] = indata
+	return indata, nil
+}
+
+func (t *fakeSiteDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	dataSite, ok := t.sites[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	t.sites[id] = utils.MergeMap(dataSite, indata, true)
+	return t.sites[id], nil
+}
+
+// fakeTerritoryDao - TerritoryDao of the given territories, List and Update are implemented
+type fakeTerritoryDao struct {
+	business_repository.TerritoryDao
+	territories map[string]utils.Map
+}
+
+func (t *fakeTerritoryDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return listResponse(filterRecords(mapValues(t.territories), filter)), nil
+}
+
+func (t *fakeTerritoryDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	dataTerritory, ok := t.territories[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	t.territories[id] = utils.MergeMap(dataTerritory, indata, true)
+	return t.territories[id], nil
+}
+
+// fakeUserTypeDao - UserTypeDao of the given user types, Get and Create are implemented
+type fakeUserTypeDao struct {
+	business_repository.UserTypeDao
+	userTypes map[string]utils.Map
+}
+
+func (t *fakeUserTypeDao) Get(id string) (utils.Map, error) {
+	dataUserType, ok := t.userTypes[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataUserType, nil
+}
+
+func (t *fakeUserTypeDao) Create(indata utils.Map) (utils.Map, error) {
+	t.userTypes[indata[business_common.FLD_USERTYPE_ID].(string)] = indata
+	return indata, nil
+}
+
+// fakeBusinessDao - Region BusinessDao of the given businesses, Get, Create and Update of the businessId
+// are implemented, getErr fails the Get
+type fakeBusinessDao struct {
+	business_repository.BusinessDao
+	businesses map[string]utils.Map
+	businessId string
+	getErr     error
+}
+
+func (t *fakeBusinessDao) Get(id string) (utils.Map, error) {
+	if t.getErr != nil {
+		return nil, t.getErr
+	}
+	dataBusiness, ok := t.businesses[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataBusiness, nil
+}
+
+func (t *fakeBusinessDao) Create(indata utils.Map) (utils.Map, error) {
+	t.businesses[indata[business_common.FLD_BUSINESS_ID].(string)] = indata
+	return indata, nil
+}
+
+func (t *fakeBusinessDao) Update(indata utils.Map) (utils.Map, error) {
+	dataBusiness, ok := t.businesses[t.businessId]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	for key, value := range indata {
+		dataBusiness[key] = value
+	}
+	return dataBusiness, nil
+}
+
+// fakeAccessDao - AccessDao of the given grants, List returns all of them whatever the filter unless filtered.
+// List, Get, GrantPermission and RevokePermission are implemented, getErr fails the Get.
+type fakeAccessDao struct {
+	business_repository.AccessDao
+	grants   []utils.Map
+	revoked  []string
+	getErr   error
+	filtered bool
+}
+
+func (t *fakeAccessDao) Get(id string) (utils.Map, error) {
+	if t.getErr != nil {
+		return nil, t.getErr
+	}
+	for _, dataGrant := range t.grants {
+		if dataGrant[business_common.FLD_APP_ACCESS_ID] == id {
+			return dataGrant, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (t *fakeAccessDao) GrantPermission(indata utils.Map) (utils.Map, error) {
+	for idx, dataGrant := range t.grants {
+		if dataGrant[business_common.FLD_APP_ACCESS_ID] == indata[business_common.FLD_APP_ACCESS_ID] {
+			t.grants[idx] = indata
+			return indata, nil
+		}
+	}
+	t.grants = append(t.grants, indata)
+	return indata, nil
+}
+
+func (t *fakeAccessDao) List(sys_filter string, filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	if t.filtered {
+		return listResponse(filterRecords(t.grants, filter)), nil
+	}
+	return listResponse(t.grants), nil
+}
+
+func (t *fakeAccessDao) RevokePermission(id string) (int64, error) {
+	t.revoked = append(t.revoked, id)
+	return 1, nil
+}
+
+// fakeRoleDao - RoleDao of the given roles, GetDetails and Create are implemented
+type fakeRoleDao struct {
+	business_repository.RoleDao
+	roles map[string]utils.Map
+}
+
+func (t *fakeRoleDao) GetDetails(id string) (utils.Map, error) {
+	dataRole, ok := t.roles[id]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	return dataRole, nil
+}
+
+func (t *fakeRoleDao) Create(indata utils.Map) (utils.Map, error) {
+	t.roles[indata[business_common.FLD_ROLE_ID].(string)] = indata
+	return indata, nil
+}
+
+// fakeCollectionDao - collectionDao of the given records identified by idField.
+// List, Get, UpdateItem, ListAll, Insert and Delete are implemented.
+type fakeCollectionDao struct {
+	collectionDao
+	idField string
+	records []utils.Map
+}
+
+func (t *fakeCollectionDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return listResponse(filterRecords(t.records, filter)), nil
+}
+
+func (t *fakeCollectionDao) Get(id string) (utils.Map, error) {
+	for _, record := range t.records {
+		if record[t.idField] == id {
+			return record, nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (t *fakeCollectionDao) Update(id string, indata utils.Map) (utils.Map, error) {
+	record, err := t.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range indata {
+		record[key] = value
+	}
+	return record, nil
+}
+
+func (t *fakeCollectionDao) UpdateItem(id string, field string, itemField string, itemId string, indata utils.Map) (int64, error) {
+	record, err := t.Get(id)
+	if err != nil {
+		return 0, nil
+	}
+	for _, item := range getMemberDataMapArray(record, field) {
+		if item[itemField] == itemId {
+			for key, value := range indata {
+				item[key] = value
+			}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (t *fakeCollectionDao) ListAll() ([]utils.Map, error) {
+	records := []utils.Map{}
+	for _, record := range t.records {
+		records = append(records, utils.CopyMap(record))
+	}
+	return records, nil
+}
+
+func (t *fakeCollectionDao) Insert(indata utils.Map) error {
+	t.records = append(t.records, indata)
+	return nil
+}
+
+func (t *fakeCollectionDao) Delete(id string) (int64, error) {
+	records := []utils.Map{}
+	for _, record := range t.records {
+		if record[t.idField] != id {
+			records = append(records, record)
+		}
+	}
+	deleted := int64(len(t.records) - len(records))
+	t.records = records
+	return deleted, nil
+}
+
+// fakePlatformBusinessDao - Platform BusinessDao of the given businesses counting the reads and of their members.
+// List, Get, Update, GetAccessDetails and AddUser are implemented, addUserErr fails the AddUser.
+type fakePlatformBusinessDao struct {
+	platform_repository.BusinessDao
+	businesses map[string]utils.Map
+	members    map[string]utils.Map
+	gets       int
+	addUserErr error
+}
+
+func (t *fakePlatformBusinessDao) GetAccessDetails(accessid string) (utils.Map, error) {
+	dataMember, ok := t.members[accessid]
+	if !ok {
+		return utils.Map{}, mongo.ErrNoDocuments
+	}
+	return dataMember, nil
+}
+
+func (t *fakePlatformBusinessDao) AddUser(indata utils.Map) (utils.Map, error) {
+	if t.addUserErr != nil {
+		return nil, t.addUserErr
+	}
+	t.members[indata[platform_common.FLD_BUSINESS_USER_ID].(string)] = indata
+	return indata, nil
+}
+
+func (t *fakePlatformBusinessDao) Get(id string) (utils.Map, error) {
+	t.gets++
+	dataBusiness, ok := t.businesses[id]
+	if !ok {
+		return utils.Map{}, mongo.ErrNoDocuments
+	}
+	return dataBusiness, nil
+}
+
+func (t *fakePlatformBusinessDao) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return listResponse(filterRecords(mapValues(t.businesses), filter)), nil
+}
+
+func (t *fakePlatformBusinessDao) Update(businessid string, indata utils.Map) (utils.Map, error) {
+	dataBusiness, ok := t.businesses[businessid]
+	if !ok {
+		return nil, mongo.ErrNoDocuments
+	}
+	for key, value := range indata {
+		dataBusiness[key] = value
+	}
+	return dataBusiness, nil
+}
+
+// testBusiness - Platform BusinessDao holding the business in the given status
+func testBusiness(businessId string, status string) *fakePlatformBusinessDao {
+	return &fakePlatformBusinessDao{
+		businesses: map[string]utils.Map{
+			businessId: {business_common.FLD_BUSINESS_ID: businessId, FLD_BUSINESS_STATUS: status},
+		},
+		members: map[string]utils.Map{},
+	}
+}
+
+// mapValues - Values of the records by id
+func mapValues(records map[string]utils.Map) []utils.Map {
+	values := []utils.Map{}
+	for _, record := range records {
+		values = append(values, record)
+	}
+	return values
+}
+
+// filterRecords - Records matching every field of the JSON filter, a list field matches when it holds the value.
+// A condition is a value, null for a missing field, {"$in": [values]} or a {"$lte"|"$gt": value} string comparison.
+// "$and" and "$or" take a list of such filters.
+func filterRecords(records []utils.Map, filter string) []utils.Map {
+	conditions := map[string]any{}
+	if len(filter) > 0 {
+		if err := json.Unmarshal([]byte(filter), &conditions); err != nil {
+			panic(err)
+		}
+	}
+
+	matching := []utils.Map{}
+	for _, record := range records {
+		if matchesConditions(record, conditions) {
+			matching = append(matching, record)
+		}
+	}
+	return matching
+}
+
+// matchesConditions - Whether the record matches every condition of the decoded filter
+func matchesConditions(record utils.Map, conditions map[string]any) bool {
+	for field, condition := range conditions {
+		switch field {
+		case "$and", "$or":
+			matches := field == "$and"
+			for _, alternative := range condition.([]any) {
+				if field == "$and" {
+					matches = matches && matchesConditions(record, alternative.(map[string]any))
+				} else {
+					matches = matches || matchesConditions(record, alternative.(map[string]any))
+				}
+			}
+			if !matches {
+				return false
+			}
+			continue
+		}
+
+		if condition == nil {
+			if _, ok := record[field]; ok {
+				return false
+			}
+			continue
+		}
+
+		values := []any{condition}
+		if dataCondition, ok := condition.(map[string]any); ok {
+			stored, _ := utils.GetMemberDataStr(record, field)
+			if value, ok := dataCondition["$lte"]; ok && !(stored <= value.(string)) {
+				return false
+			}
+			if value, ok := dataCondition["$gt"]; ok && !(stored > value.(string)) {
+				return false
+			}
+			if _, ok := dataCondition["$in"]; !ok {
+				continue
+			}
+			values = dataCondition["$in"].([]any)
+		}
+		if !matchesAny(record, field, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesAny - Whether the field of the record is, or as a list holds, one of the values
+func matchesAny(record utils.Map, field string, values []any) bool {
+	stored, ok := record[field]
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if stored == value || containsString(getMemberDataStrArray(record, field), fmt.Sprint(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// testRoles - Roles with inheritance, a cycle and a dangling parent
+func testRoles() *fakeRoleDao {
+	return &fakeRoleDao{roles: map[string]utils.Map{
+		"viewer":  {business_common.FLD_ROLE_ID: "viewer", FLD_ROLE_PERMISSIONS: []string{"contact.view"}},
+		"editor":  {business_common.FLD_ROLE_ID: "editor", FLD_ROLE_PERMISSIONS: []string{"contact.update"}, FLD_ROLE_PARENT_IDS: []string{"viewer"}},
+		"cycle_a": {business_common.FLD_ROLE_ID: "cycle_a", FLD_ROLE_PERMISSIONS: []string{"site.view"}, FLD_ROLE_PARENT_IDS: []string{"cycle_b"}},
+		"cycle_b": {business_common.FLD_ROLE_ID: "cycle_b", FLD_ROLE_PERMISSIONS: []string{"site.update"}, FLD_ROLE_PARENT_IDS: []string{"cycle_a", "editor"}},
+		"self":    {business_common.FLD_ROLE_ID: "self", FLD_ROLE_PERMISSIONS: []string{"user.view"}, FLD_ROLE_PARENT_IDS: []string{"self"}},
+		"orphan":  {business_common.FLD_ROLE_ID: "orphan", FLD_ROLE_PERMISSIONS: []string{"payment.view"}, FLD_ROLE_PARENT_IDS: []string{"deleted"}},
+	}}
+}
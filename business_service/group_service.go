@@ -0,0 +1,396 @@
+package business_service
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-platform-service/platform_service"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Group fields
+const (
+	FLD_GROUP_ID         = "group_id"
+	FLD_GROUP_NAME       = "group_name"
+	FLD_GROUP_MEMBER_IDS = "member_ids"
+
+	// Grants of a group are keyed with this prefix, so they never clash with the grants of a user
+	GROUP_ACCESS_PREFIX = "grp:"
+)
+
+// GroupService - User Groups Service structure
+type GroupService interface {
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	Get(groupId string) (utils.Map, error)
+	Find(filter string) (utils.Map, error)
+	Create(indata utils.Map) (utils.Map, error)
+	Update(groupId string, indata utils.Map) (utils.Map, error)
+	Delete(groupId string, delete_permanent bool) error
+
+	// Membership of the group
+	AddMembers(groupId string, userIds []string) (utils.Map, error)
+	RemoveMembers(groupId string, userIds []string) (utils.Map, error)
+	ListMembers(groupId string) (utils.Map, error)
+	ListUserGroups(userId string) (utils.Map, error)
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// groupBaseService - User Groups Service structure
+type groupBaseService struct {
+	db_utils.DatabaseService
+	dbRegion       db_utils.DatabaseService
+	daoGroup       collectionDao
+	daoUser        business_repository.UserDao
+	daoAccess      business_repository.AccessDao
+	daoBusiness    platform_repository.BusinessDao
+	child          GroupService
+	businessID     string
+	businessStatus string
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewGroupService(props utils.Map) (GroupService, error) {
+	funcode := business_common.GetServiceModuleCode() + "M" + "01"
+
+	log.Print("GroupService::Start ")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, business_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := groupBaseService{}
+	// Open Database Service
+	err = p.OpenDatabaseService(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open RegionDB Service
+	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	if err != nil {
+		p.CloseDatabaseService()
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessID = businessId
+	p.initializeService()
+
+	dataBusiness, err := p.daoBusiness.Get(businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business_id",
+			ErrorDetail: "Given business_id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, err
+}
+
+// EndService - Close all the services
+func (p *groupBaseService) EndService() {
+	log.Printf("EndGroupService ")
+	p.CloseDatabaseService()
+	p.dbRegion.CloseDatabaseService()
+}
+
+func (p *groupBaseService) initializeService() {
+	log.Printf("GroupService:: GetBusinessDao ")
+	p.daoGroup = newGroupDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+}
+
+func (p *groupBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "10"
+}
+
+// List - List All records
+func (p *groupBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+
+	log.Println("GroupService::FindAll - Begin")
+
+	response, err := p.daoGroup.List(filter, sort, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("GroupService::FindAll - End ")
+	return response, nil
+}
+
+// Get - Find By Code
+func (p *groupBaseService) Get(groupId string) (utils.Map, error) {
+	log.Printf("GroupService::Get::  Begin %v", groupId)
+
+	data, err := p.daoGroup.Get(groupId)
+	log.Println("GroupService::Get:: End ", err)
+	return data, err
+}
+
+func (p *groupBaseService) Find(filter string) (utils.Map, error) {
+	fmt.Println("GroupService::Find::  Begin ", filter)
+
+	data, err := p.daoGroup.Find(filter)
+	log.Println("GroupService::Find:: End ", data, err)
+	return data, err
+}
+
+// Create - Create the group, the given members have to be users of the business
+func (p *groupBaseService) Create(indata utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	log.Println("GroupService::Create - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	groupId, _ := utils.GetMemberDataStr(indata, FLD_GROUP_ID)
+	if len(groupId) == 0 {
+		groupId = utils.GenerateUniqueId("grp")
+		log.Println("Unique Group ID", groupId)
+	}
+	indata[FLD_GROUP_ID] = groupId
+	indata[business_common.FLD_BUSINESS_ID] = p.businessID
+
+	_, err := p.daoGroup.Get(groupId)
+	if err == nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Existing Group ID !", ErrorDetail: "Given Group ID already exist"}
+		return indata, err
+	}
+
+	memberIds := getMemberDataStrArray(indata, FLD_GROUP_MEMBER_IDS)
+	err = p.validateMembers(funcode, memberIds)
+	if err != nil {
+		return indata, err
+	}
+	indata[FLD_GROUP_MEMBER_IDS] = memberIds
+
+	insertResult, err := p.daoGroup.Create(indata)
+	if err != nil {
+		return indata, err
+	}
+	log.Println("GroupService::Create - End ", insertResult)
+	return indata, err
+}
+
+// Update - Update Service, the members are managed with AddMembers and RemoveMembers
+func (p *groupBaseService) Update(groupId string, indata utils.Map) (utils.Map, error) {
+
+	log.Println("GroupService::Update - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	data, err := p.daoGroup.Get(groupId)
+	if err != nil {
+		return data, err
+	}
+
+	delete(indata, FLD_GROUP_ID)
+	delete(indata, FLD_GROUP_MEMBER_IDS)
+
+	data, err = p.daoGroup.Update(groupId, indata)
+	log.Println("GroupService::Update - End ")
+	return data, err
+}
+
+// Delete - Delete the group along with the grants given to it
+func (p *groupBaseService) Delete(groupId string, delete_permanent bool) error {
+
+	log.Println("GroupService::Delete - Begin", groupId, delete_permanent)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	_, err := p.daoGroup.Get(groupId)
+	if err != nil {
+		return err
+	}
+
+	// Revoke all the grants of the group, including the expired ones
+	filter := buildFilter(utils.Map{FLD_GROUP_ID: groupId})
+	response, err := p.daoAccess.List("", filter, "", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, dataGrant := range getListResult(response) {
+		accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+		_, err := p.daoAccess.RevokePermission(accessId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if delete_permanent {
+		result, err := p.daoGroup.Delete(groupId)
+		if err != nil {
+			return err
+		}
+		log.Printf("Delete %v", result)
+	} else {
+		indata := utils.Map{db_common.FLD_IS_DELETED: true}
+		data, err := p.daoGroup.Update(groupId, indata)
+		if err != nil {
+			return err
+		}
+		log.Println("Update for Delete Flag", data)
+	}
+
+	log.Printf("GroupService::Delete - End")
+	return nil
+}
+
+// AddMembers - Add the users to the group, existing members are ignored
+func (p *groupBaseService) AddMembers(groupId string, userIds []string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("GroupService::AddMembers - Begin", groupId, userIds)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataGroup, err := p.daoGroup.Get(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validateMembers(funcode, userIds)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIds := getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS)
+	members := map[string]bool{}
+	for _, memberId := range memberIds {
+		members[memberId] = true
+	}
+	for _, userId := range userIds {
+		if !members[userId] {
+			members[userId] = true
+			memberIds = append(memberIds, userId)
+		}
+	}
+
+	data, err := p.daoGroup.Update(groupId, utils.Map{FLD_GROUP_MEMBER_IDS: memberIds})
+	log.Println("GroupService::AddMembers - End ", len(memberIds))
+	return data, err
+}
+
+// RemoveMembers - Remove the users from the group, the access they had through the group ends at once
+func (p *groupBaseService) RemoveMembers(groupId string, userIds []string) (utils.Map, error) {
+
+	log.Println("GroupService::RemoveMembers - Begin", groupId, userIds)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataGroup, err := p.daoGroup.Get(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIds := getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS)
+	for _, userId := range userIds {
+		memberIds = removeString(memberIds, userId)
+	}
+
+	data, err := p.daoGroup.Update(groupId, utils.Map{FLD_GROUP_MEMBER_IDS: memberIds})
+	log.Println("GroupService::RemoveMembers - End ", len(memberIds))
+	return data, err
+}
+
+// ListMembers - List the business users who are members of the group
+func (p *groupBaseService) ListMembers(groupId string) (utils.Map, error) {
+
+	log.Println("GroupService::ListMembers - Begin", groupId)
+
+	dataGroup, err := p.daoGroup.Get(groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIds := getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS)
+	filter := buildFilter(utils.Map{business_common.FLD_USER_ID: utils.Map{"$in": memberIds}})
+	response, err := p.daoUser.List(filter, "", 0, 0)
+
+	log.Println("GroupService::ListMembers - End ", err)
+	return response, err
+}
+
+// ListUserGroups - List the groups the user is a member of
+func (p *groupBaseService) ListUserGroups(userId string) (utils.Map, error) {
+
+	log.Println("GroupService::ListUserGroups - Begin", userId)
+
+	filter := buildFilter(utils.Map{FLD_GROUP_MEMBER_IDS: userId})
+	response, err := p.daoGroup.List(filter, "", 0, 0)
+
+	log.Println("GroupService::ListUserGroups - End ", err)
+	return response, err
+}
+
+// validateMembers - Verify all the users exist in the business
+func (p *groupBaseService) validateMembers(funcode string, userIds []string) error {
+	for _, userId := range userIds {
+		if _, err := p.daoUser.Get(userId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "09", ErrorMsg: "UserId not found ", ErrorDetail: "User " + userId + " is not exist"}
+			return err
+		}
+	}
+	return nil
+}
+
+// getUserGroupIds - Get the ids of the groups the user is a member of
+func getUserGroupIds(daoGroup collectionDao, userId string) ([]string, error) {
+	filter := buildFilter(utils.Map{FLD_GROUP_MEMBER_IDS: userId})
+	response, err := daoGroup.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	groupIds := []string{}
+	for _, dataGroup := range getListResult(response) {
+		groupId, _ := utils.GetMemberDataStr(dataGroup, FLD_GROUP_ID)
+		groupIds = append(groupIds, groupId)
+	}
+	return groupIds, nil
+}
+
+func (p *groupBaseService) errorReturn(err error) (GroupService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
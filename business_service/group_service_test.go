@@ -0,0 +1,107 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testGroupServices - Group and access services sharing the group grp_1 without members, which is granted the viewer role
+func testGroupServices() (*groupBaseService, *accessBaseService) {
+	daoUser := &fakeUserDao{users: map[string]utils.Map{
+		"user1": {business_common.FLD_USER_ID: "user1"},
+		"user2": {business_common.FLD_USER_ID: "user2"},
+	}}
+	daoGroup := &fakeCollectionDao{idField: FLD_GROUP_ID, records: []utils.Map{
+		{FLD_GROUP_ID: "grp_1", FLD_GROUP_MEMBER_IDS: []string{}},
+	}}
+	daoAccess := &fakeAccessDao{filtered: true, grants: []utils.Map{
+		{business_common.FLD_APP_ACCESS_ID: "aces_grp", FLD_GROUP_ID: "grp_1", business_common.FLD_ROLE_ID: "viewer"},
+	}}
+
+	groupService := &groupBaseService{daoGroup: daoGroup, daoUser: daoUser, daoAccess: daoAccess,
+		daoBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE), businessID: "biz1"}
+	accessService := &accessBaseService{daoGroup: daoGroup, daoUser: daoUser, daoAccess: daoAccess, daoRole: testRoles(),
+		businessID: "biz1", shared: true}
+	return groupService, accessService
+}
+
+func TestGroupMembershipGrantsPermissions(t *testing.T) {
+	groupService, accessService := testGroupServices()
+
+	permissions := func() []string {
+		response, err := accessService.EffectivePermissions("user1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response[FLD_PERMISSIONS].([]string)
+	}
+
+	if got := permissions(); len(got) > 0 {
+		t.Errorf("permissions before joining = %v, want none", got)
+	}
+
+	if _, err := groupService.AddMembers("grp_1", []string{"user1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := permissions(); !reflect.DeepEqual(got, []string{"contact.view"}) {
+		t.Errorf("permissions as a member = %v, want the group's viewer role", got)
+	}
+
+	if _, err := groupService.RemoveMembers("grp_1", []string{"user1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := permissions(); len(got) > 0 {
+		t.Errorf("permissions after leaving = %v, want none", got)
+	}
+}
+
+func TestAddMembers(t *testing.T) {
+	groupService, _ := testGroupServices()
+
+	for _, userIds := range [][]string{{"user1"}, {"user1", "user2"}} {
+		if _, err := groupService.AddMembers("grp_1", userIds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	groupIds, err := getUserGroupIds(groupService.daoGroup, "user2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(groupIds, []string{"grp_1"}) {
+		t.Errorf("groups of user2 = %v, want [grp_1]", groupIds)
+	}
+
+	dataGroup, _ := groupService.daoGroup.Get("grp_1")
+	if got := getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS); !reflect.DeepEqual(got, []string{"user1", "user2"}) {
+		t.Errorf("members = %v, want each user once", got)
+	}
+}
+
+func TestAddMembersUnknownUser(t *testing.T) {
+	groupService, _ := testGroupServices()
+
+	var appErr *utils.AppError
+	_, err := groupService.AddMembers("grp_1", []string{"user1", "user9"})
+	if !errors.As(err, &appErr) || appErr.ErrorCode != groupService.getServiceModuleCode()+"0209" {
+		t.Errorf("AddMembers = %v, want the unknown user error", err)
+	}
+
+	dataGroup, _ := groupService.daoGroup.Get("grp_1")
+	if got := getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS); len(got) > 0 {
+		t.Errorf("members = %v after a failed add, want none", got)
+	}
+}
+
+func TestGrantPermissionUnknownGroup(t *testing.T) {
+	_, accessService := testGroupServices()
+
+	var appErr *utils.AppError
+	_, err := accessService.GrantPermission(utils.Map{FLD_GROUP_ID: "grp_9", business_common.FLD_ROLE_ID: "viewer"})
+	if !errors.As(err, &appErr) || appErr.ErrorCode != accessService.getServiceModuleCode()+"0108" {
+		t.Errorf("GrantPermission = %v, want the unknown group error", err)
+	}
+}
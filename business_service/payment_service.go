@@ -39,11 +39,12 @@ type PaymentService interface {
 // PaymentService - Business Payment Service structure
 type paymentBaseService struct {
 	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
-	daoPayment  business_repository.PaymentDao
-	daoBusiness platform_repository.BusinessDao
-	child       PaymentService
-	businessId  string
+	dbRegion       db_utils.DatabaseService
+	daoPayment     business_repository.PaymentDao
+	daoBusiness    platform_repository.BusinessDao
+	child          PaymentService
+	businessId     string
+	businessStatus string
 }
 
 func init() {
@@ -78,7 +79,7 @@ func NewPaymentService(props utils.Map) (PaymentService, error) {
 	p.businessId = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -87,6 +88,12 @@ func NewPaymentService(props utils.Map) (PaymentService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -140,6 +147,10 @@ func (p *paymentBaseService) Find(filter string) (utils.Map, error) {
 func (p *paymentBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("PaymentService::Create - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return utils.Map{}, err
+	}
 	var paymentId string
 
 	dataval, dataok := indata[business_common.FLD_PAYMENT_ID]
@@ -154,6 +165,12 @@ func (p *paymentBaseService) Create(indata utils.Map) (utils.Map, error) {
 	indata[business_common.FLD_BUSINESS_ID] = p.businessId
 	indata[business_common.FLD_PAYMENT_ID] = paymentId
 
+	amount, _ := getMemberDataFloat(indata, FLD_PAYMENT_AMOUNT)
+	err := checkQuota(p.dbRegion.GetClient(), p.businessId, QUOTA_MAX_MONTHLY_PAYMENT_VOLUME, amount)
+	if err != nil {
+		return utils.Map{}, err
+	}
+
 	data, err := p.daoPayment.Create(indata)
 	if err != nil {
 		return utils.Map{}, err
@@ -168,6 +185,10 @@ func (p *paymentBaseService) Update(paymentId string, indata utils.Map) (utils.M
 
 	log.Println("BusinessPaymentService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return utils.Map{}, err
+	}
+
 	data, err := p.daoPayment.Update(paymentId, indata)
 
 	log.Println("PaymentService::Update - End")
@@ -179,6 +200,10 @@ func (p *paymentBaseService) Delete(paymentId string, delete_permanent bool) err
 
 	log.Println("PaymentService::Delete - Begin", paymentId)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := p.daoPayment.Delete(paymentId)
 		if err != nil {
@@ -187,7 +212,7 @@ func (p *paymentBaseService) Delete(paymentId string, delete_permanent bool) err
 		log.Printf("Delete %v", result)
 	} else {
 		indata := utils.Map{db_common.FLD_IS_DELETED: true}
-		data, err := p.Update(paymentId, indata)
+		data, err := p.daoPayment.Update(paymentId, indata)
 		if err != nil {
 			return err
 		}
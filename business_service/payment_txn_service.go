@@ -40,11 +40,14 @@ type PaymentTxnService interface {
 // PaymentTxnService - Business PaymentTxn Service structure
 type PaymentTxnBaseService struct {
 	db_utils.DatabaseService
-	dbRegion      db_utils.DatabaseService
-	daoPaymentTxn business_repository.PaymentTxnDao
-	daoBusiness   platform_repository.BusinessDao
-	child         PaymentTxnService
-	businessId    string
+	dbRegion       db_utils.DatabaseService
+	daoPaymentTxn  business_repository.PaymentTxnDao
+	daoBusiness    platform_repository.BusinessDao
+	child          PaymentTxnService
+	businessId     string
+	businessStatus string
+	// Time zone of the business, the transactions are stamped in it
+	location *time.Location
 }
 
 func init() {
@@ -79,7 +82,7 @@ func NewPaymentTxnService(props utils.Map) (PaymentTxnService, error) {
 	p.businessId = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -88,6 +91,17 @@ func NewPaymentTxnService(props utils.Map) (PaymentTxnService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
+	p.location, err = getBusinessLocation(p.dbRegion.GetClient(), businessId)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -141,6 +155,10 @@ func (p *PaymentTxnBaseService) Find(filter string) (utils.Map, error) {
 func (p *PaymentTxnBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("PaymentTxnService::Create - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return utils.Map{}, err
+	}
 	var PaymentTxnId string
 
 	dataval, dataok := indata[business_common.FLD_PAYMENT_TXN_ID]
@@ -150,7 +168,7 @@ func (p *PaymentTxnBaseService) Create(indata utils.Map) (utils.Map, error) {
 		PaymentTxnId = utils.GenerateUniqueId("paytxn")
 		log.Println("Unique PaymentTxn ID", PaymentTxnId)
 	}
-	dateTime := time.Now().Format(time.DateTime)
+	dateTime := time.Now().In(p.location).Format(time.DateTime)
 	//BusinessPaymentTxn
 	indata[business_common.FLD_DATE_TIME] = dateTime
 	indata[business_common.FLD_BUSINESS_ID] = p.businessId
@@ -171,6 +189,10 @@ func (p *PaymentTxnBaseService) Update(PaymentTxnId string, indata utils.Map) (u
 
 	log.Println("BusinessPaymentTxnService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return utils.Map{}, err
+	}
+
 	data, err := p.daoPaymentTxn.Update(PaymentTxnId, indata)
 
 	log.Println("PaymentTxnService::Update - End")
@@ -182,6 +204,10 @@ func (p *PaymentTxnBaseService) Delete(PaymentTxnId string, delete_permanent boo
 
 	log.Println("PaymentTxnService::Delete - Begin", PaymentTxnId)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessId); err != nil {
+		return err
+	}
+
 	if delete_permanent {
 		result, err := p.daoPaymentTxn.Delete(PaymentTxnId)
 		if err != nil {
@@ -190,7 +216,7 @@ func (p *PaymentTxnBaseService) Delete(PaymentTxnId string, delete_permanent boo
 		log.Printf("Delete %v", result)
 	} else {
 		indata := utils.Map{db_common.FLD_IS_DELETED: true}
-		data, err := p.Update(PaymentTxnId, indata)
+		data, err := p.daoPaymentTxn.Update(PaymentTxnId, indata)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,117 @@
+package business_service
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// permissionCatalog - Registered permissions keyed by "module.action"
+var permissionCatalog = struct {
+	sync.RWMutex
+	entries map[string]utils.Map
+}{entries: map[string]utils.Map{}}
+
+// Built-in permission modules of the business services, so roles are validated before
+// the application registers its own permissions
+var builtinPermissionModules = []string{"business", "user", "usertype", "role", "access", "access_review",
+	"invite", "group", "site", "territory", "contact", "payment", "payment_txn"}
+
+func init() {
+	for _, module := range builtinPermissionModules {
+		RegisterPermission(module, "view", "View "+module)
+		// Changing records implies viewing them
+		RegisterPermission(module, "create", "Create "+module, PermissionKey(module, "view"))
+		RegisterPermission(module, "update", "Update "+module, PermissionKey(module, "view"))
+		RegisterPermission(module, "delete", "Delete "+module, PermissionKey(module, "view"))
+	}
+}
+
+// PermissionKey - Build the permission key for the module and action
+func PermissionKey(module string, action string) string {
+	return module + PERMISSION_SEPARATOR + action
+}
+
+// RegisterPermission - Register a permission in the catalog.
+// Dependencies are the permission keys which are implied by this permission.
+func RegisterPermission(module string, action string, description string, dependencies ...string) {
+	permissionCatalog.Lock()
+	defer permissionCatalog.Unlock()
+
+	permissionCatalog.entries[PermissionKey(module, action)] = utils.Map{
+		FLD_PERMISSION:              PermissionKey(module, action),
+		FLD_PERMISSION_MODULE:       module,
+		FLD_PERMISSION_ACTION:       action,
+		FLD_PERMISSION_DESCRIPTION:  description,
+		FLD_PERMISSION_DEPENDENCIES: dependencies,
+	}
+}
+
+// listPermissionCatalog - Get all registered permissions in the List response format
+func listPermissionCatalog() utils.Map {
+	permissionCatalog.RLock()
+	defer permissionCatalog.RUnlock()
+
+	keys := make([]string, 0, len(permissionCatalog.entries))
+	for key := range permissionCatalog.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	listdata := []utils.Map{}
+	for _, key := range keys {
+		listdata = append(listdata, utils.CopyMap(permissionCatalog.entries[key]))
+	}
+
+	return listResponse(listdata)
+}
+
+// expandPermissions - Validate the permissions against the catalog and add the implied permissions.
+// Returns the expanded permissions and the unknown ones.
+func expandPermissions(permissions []string) ([]string, []string) {
+	permissionCatalog.RLock()
+	defer permissionCatalog.RUnlock()
+
+	modules := map[string]bool{}
+	for _, entry := range permissionCatalog.entries {
+		module, _ := utils.GetMemberDataStr(entry, FLD_PERMISSION_MODULE)
+		modules[module] = true
+	}
+
+	expanded := map[string]bool{}
+	unknown := []string{}
+	pending := append([]string{}, permissions...)
+
+	for len(pending) > 0 {
+		permission := pending[0]
+		pending = pending[1:]
+
+		if expanded[permission] {
+			continue
+		}
+
+		if permission == PERMISSION_ALL {
+			expanded[permission] = true
+			continue
+		}
+
+		// Wildcard of a registered module, e.g. "contact.*"
+		if module, ok := strings.CutSuffix(permission, PERMISSION_SEPARATOR+PERMISSION_ALL); ok && modules[module] {
+			expanded[permission] = true
+			continue
+		}
+
+		entry, ok := permissionCatalog.entries[permission]
+		if !ok {
+			unknown = append(unknown, permission)
+			continue
+		}
+
+		expanded[permission] = true
+		pending = append(pending, getMemberDataStrArray(entry, FLD_PERMISSION_DEPENDENCIES)...)
+	}
+
+	return sortedKeys(expanded), unknown
+}
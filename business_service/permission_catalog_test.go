@@ -0,0 +1,47 @@
+package business_service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandPermissions(t *testing.T) {
+	tests := []struct {
+		name         string
+		permissions  []string
+		wantExpanded []string
+		wantUnknown  []string
+	}{
+		{"without dependencies", []string{"contact.view"}, []string{"contact.view"}, []string{}},
+		{"implied view", []string{"contact.update"}, []string{"contact.update", "contact.view"}, []string{}},
+		{"duplicates", []string{"contact.delete", "contact.update", "contact.delete"},
+			[]string{"contact.delete", "contact.update", "contact.view"}, []string{}},
+		{"everything", []string{PERMISSION_ALL}, []string{PERMISSION_ALL}, []string{}},
+		{"module wildcard", []string{"site.*"}, []string{"site.*"}, []string{}},
+		{"unknown permission", []string{"contact.approve", "site.view"}, []string{"site.view"}, []string{"contact.approve"}},
+		{"unknown module wildcard", []string{"payroll.*"}, []string{}, []string{"payroll.*"}},
+		{"nothing", nil, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, unknown := expandPermissions(tt.permissions)
+			if !reflect.DeepEqual(expanded, tt.wantExpanded) {
+				t.Errorf("expanded = %v, want %v", expanded, tt.wantExpanded)
+			}
+			if !reflect.DeepEqual(unknown, tt.wantUnknown) {
+				t.Errorf("unknown = %v, want %v", unknown, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestExpandPermissionsRegistered(t *testing.T) {
+	RegisterPermission("test_report", "view", "View reports")
+	RegisterPermission("test_report", "export", "Export reports", PermissionKey("test_report", "view"), PermissionKey("contact", "view"))
+
+	expanded, unknown := expandPermissions([]string{"test_report.export"})
+	want := []string{"contact.view", "test_report.export", "test_report.view"}
+	if !reflect.DeepEqual(expanded, want) || len(unknown) != 0 {
+		t.Errorf("expandPermissions = %v %v, want %v", expanded, unknown, want)
+	}
+}
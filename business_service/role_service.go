@@ -3,6 +3,7 @@ package business_service
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-business-repository/business_repository"
@@ -21,6 +22,10 @@ type RoleService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(roleid string, indata utils.Map) (utils.Map, error)
 	Delete(roleid string, delete_permanent bool) error
+	DeleteWithOptions(roleid string, opts utils.Map) (utils.Map, error)
+
+	GetResolvedPermissions(roleid string) (utils.Map, error)
+	ListCatalog() (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -32,11 +37,16 @@ type RoleService interface {
 // RoleBaseService - Roles Service structure
 type roleBaseService struct {
 	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
-	daoRole     business_repository.RoleDao
-	daoBusiness platform_repository.BusinessDao
-	child       RoleService
-	businessID  string
+	dbRegion       db_utils.DatabaseService
+	daoRole        business_repository.RoleDao
+	daoAccess      business_repository.AccessDao
+	daoUserType    business_repository.UserTypeDao
+	daoBusiness    platform_repository.BusinessDao
+	child          RoleService
+	businessID     string
+	businessStatus string
+	// Shared with a service which verified the business is writable for the operation
+	shared bool
 }
 
 func init() {
@@ -71,7 +81,7 @@ func NewRoleService(props utils.Map) (RoleService, error) {
 	p.businessID = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -80,11 +90,27 @@ func NewRoleService(props utils.Map) (RoleService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
 }
 
+// newSharedRoleService - RoleService on the open databases of another service, so its changes
+// are part of that service's transactions. The databases stay with the caller, do not call EndService.
+// The caller verifies the business is writable before its operation, the shared service does not read it again.
+func newSharedRoleService(db db_utils.DatabaseService, dbRegion db_utils.DatabaseService, businessId string, businessStatus string) RoleService {
+	p := roleBaseService{DatabaseService: db, dbRegion: dbRegion, businessID: businessId, businessStatus: businessStatus, shared: true}
+	p.initializeService()
+	p.child = &p
+	return &p
+}
+
 // RoleBaseService - Close all the services
 func (p *roleBaseService) EndService() {
 	log.Printf("EndRoleService ")
@@ -95,9 +121,23 @@ func (p *roleBaseService) EndService() {
 func (p *roleBaseService) initializeService() {
 	log.Printf("RoleMongoService:: GetBusinessDao ")
 	p.daoRole = business_repository.NewRoleDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
 }
 
+// verifyWritable - Verify the business is writable, unless the service is shared with a caller which did
+func (p *roleBaseService) verifyWritable() error {
+	if p.shared {
+		return nil
+	}
+	return verifyBusinessWritable(p.daoBusiness, p.businessID)
+}
+
+func (p *roleBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "06"
+}
+
 // List - List All records
 func (p *roleBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
 
@@ -134,6 +174,10 @@ func (p *roleBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
+	if err := p.verifyWritable(); err != nil {
+		return nil, err
+	}
+
 	var roleId string
 
 	dataval, dataok := indata[business_common.FLD_ROLE_ID]
@@ -153,6 +197,16 @@ func (p *roleBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return nil, err
 	}
 
+	err = p.validateParentRoles(roleId, indata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validatePermissions(indata)
+	if err != nil {
+		return nil, err
+	}
+
 	insertResult, err := p.daoRole.Create(indata)
 	if err != nil {
 		return nil, err
@@ -166,6 +220,17 @@ func (p *roleBaseService) Update(roleid string, indata utils.Map) (utils.Map, er
 
 	log.Println("RoleService::Update - Begin")
 
+	if err := p.verifyWritable(); err != nil {
+		return nil, err
+	}
+
+	data, err := p.updateRole(roleid, indata)
+	log.Println("RoleService::Update - End ")
+	return data, err
+}
+
+// updateRole - Validate and update the role, the business is verified writable by the caller
+func (p *roleBaseService) updateRole(roleid string, indata utils.Map) (utils.Map, error) {
 	data, err := p.daoRole.GetDetails(roleid)
 	if err != nil {
 		return data, err
@@ -174,9 +239,17 @@ func (p *roleBaseService) Update(roleid string, indata utils.Map) (utils.Map, er
 	// Remove the fields which should not be updated in database
 	delete(indata, db_common.FLD_IS_AUTO_GENERATED)
 
-	data, err = p.daoRole.Update(roleid, indata)
-	log.Println("RoleService::Update - End ")
-	return data, err
+	err = p.validateParentRoles(roleid, indata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validatePermissions(indata)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.daoRole.Update(roleid, indata)
 }
 
 // Delete - Delete Service
@@ -184,6 +257,26 @@ func (p *roleBaseService) Delete(roleid string, delete_permanent bool) error {
 
 	log.Println("RoleService::Delete - Begin", roleid, delete_permanent)
 
+	if err := p.verifyWritable(); err != nil {
+		return err
+	}
+
+	err := p.deleteRole(roleid, delete_permanent)
+
+	log.Println("RoleService::Delete - End", err)
+	return err
+}
+
+// deleteRole - Delete the role unless it is still referred, the business is verified writable by the caller
+func (p *roleBaseService) deleteRole(roleid string, delete_permanent bool) error {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	err := verifyNoReferences(funcode+"01", "Role", p.references(), roleid)
+	if err != nil {
+		return err
+	}
+
 	daoRole := p.daoRole
 	if delete_permanent {
 		result, err := daoRole.Delete(roleid)
@@ -193,17 +286,223 @@ func (p *roleBaseService) Delete(roleid string, delete_permanent bool) error {
 		log.Printf("Delete %v", result)
 	} else {
 		indata := utils.Map{db_common.FLD_IS_DELETED: true}
-		data, err := p.Update(roleid, indata)
+		data, err := p.updateRole(roleid, indata)
 		if err != nil {
 			return err
 		}
 		log.Println("Update for Delete Flag", data)
 	}
+	return nil
+}
+
+// GetResolvedPermissions - Get the permissions of the role including the permissions of all its parent roles.
+// Parent roles which do not exist are reported apart from the inherited roles.
+func (p *roleBaseService) GetResolvedPermissions(roleid string) (utils.Map, error) {
+
+	log.Println("RoleService::GetResolvedPermissions - Begin", roleid)
+
+	permissions, roleIds, danglingIds, err := resolveRolePermissions(p.daoRole, roleid)
+	if err != nil {
+		return nil, err
+	}
+
+	inheritedIds := []string{}
+	for _, roleId := range roleIds[1:] {
+		if !containsString(danglingIds, roleId) {
+			inheritedIds = append(inheritedIds, roleId)
+		}
+	}
+
+	response := utils.Map{
+		business_common.FLD_ROLE_ID: roleid,
+		FLD_PERMISSIONS:             permissions,
+		FLD_INHERITED_ROLES:         inheritedIds,
+		FLD_DANGLING_ROLES:          danglingIds,
+	}
+
+	log.Println("RoleService::GetResolvedPermissions - End", response)
+	return response, nil
+}
+
+// ListCatalog - List all the permissions registered in the permission catalog
+func (p *roleBaseService) ListCatalog() (utils.Map, error) {
+	log.Println("RoleService::ListCatalog - Begin")
+
+	response := listPermissionCatalog()
+
+	log.Println("RoleService::ListCatalog - End")
+	return response, nil
+}
+
+// validatePermissions - Reject unknown permissions and add the permissions implied by the given ones
+func (p *roleBaseService) validatePermissions(indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	if _, ok := indata[FLD_ROLE_PERMISSIONS]; !ok {
+		return nil
+	}
+
+	permissions, unknown := expandPermissions(getMemberDataStrArray(indata, FLD_ROLE_PERMISSIONS))
+	if len(unknown) > 0 {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Unknown permissions",
+			ErrorDetail: "Permissions not found in catalog: " + strings.Join(unknown, ", ")}
+		return err
+	}
 
-	log.Printf("RoleService::Delete - End")
+	indata[FLD_ROLE_PERMISSIONS] = permissions
 	return nil
 }
 
+// validateParentRoles - Verify the parent roles exist and would not make the role inherit from itself
+func (p *roleBaseService) validateParentRoles(roleid string, indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	if _, ok := indata[FLD_ROLE_PARENT_IDS]; !ok {
+		return nil
+	}
+
+	parentIds := getMemberDataStrArray(indata, FLD_ROLE_PARENT_IDS)
+	for _, parentId := range parentIds {
+		if parentId == roleid {
+			err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid parent role", ErrorDetail: "Role cannot inherit from itself"}
+			return err
+		}
+
+		_, ancestorIds, _, err := resolveRolePermissions(p.daoRole, parentId)
+		if err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid parent role", ErrorDetail: "Parent role " + parentId + " is not exist"}
+			return err
+		}
+
+		for _, ancestorId := range ancestorIds {
+			if ancestorId == roleid {
+				err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Cyclic role inheritance", ErrorDetail: "Role " + parentId + " already inherits from " + roleid}
+				return err
+			}
+		}
+	}
+
+	// Store the normalised list
+	indata[FLD_ROLE_PARENT_IDS] = parentIds
+	return nil
+}
+
+// DeleteWithOptions - Delete the role after moving its grants, child roles and user type defaults
+// to the role given in reassign_to, or after removing them with cascade
+func (p *roleBaseService) DeleteWithOptions(roleid string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "07"
+
+	log.Println("RoleService::DeleteWithOptions - Begin", roleid, opts)
+
+	if err := p.verifyWritable(); err != nil {
+		return nil, err
+	}
+
+	toId, cascade, err := getDeleteOptions(funcode, roleid, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toId) > 0 {
+		if _, err := p.daoRole.GetDetails(toId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid reassign_to", ErrorDetail: "Given reassign_to role is not exist"}
+			return nil, err
+		}
+		// Child roles move to the new role, which must not inherit from the deleted one
+		_, inheritedIds, _, err := resolveRolePermissions(p.daoRole, toId)
+		if err != nil {
+			return nil, err
+		}
+		if containsString(inheritedIds, roleid) {
+			err := &utils.AppError{ErrorCode: funcode + "04", ErrorMsg: "Invalid reassign_to", ErrorDetail: "Role " + toId + " inherits from the role being deleted"}
+			return nil, err
+		}
+	}
+
+	deletePermanent, _ := utils.GetMemberDataBool(opts, FLD_DELETE_PERMANENT)
+
+	// Move or remove the references and delete the role all at once
+	p.dbRegion.BeginTransaction()
+
+	summary, err := handleReferences(p.references(), roleid, toId, cascade)
+	if err == nil {
+		err = p.deleteRole(roleid, deletePermanent)
+	}
+	if err != nil {
+		log.Println("DeleteWithOptions: Rollback ", roleid, err)
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
+
+	p.dbRegion.CommitTransaction()
+	summary[business_common.FLD_ROLE_ID] = roleid
+
+	log.Println("RoleService::DeleteWithOptions - End", summary)
+	return summary, nil
+}
+
+// references - Records which may refer to a role
+func (p *roleBaseService) references() []reference {
+	return []reference{
+		grantReference(p.daoAccess, business_common.FLD_ROLE_ID),
+		{
+			kind:    REFERENCE_KIND_ROLE,
+			field:   FLD_ROLE_PARENT_IDS,
+			idField: business_common.FLD_ROLE_ID,
+			multi:   true,
+			list: func(filter string) (utils.Map, error) {
+				return p.daoRole.List(filter, "", 0, 0)
+			},
+			update: func(dataRef utils.Map, changes utils.Map) error {
+				childId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_ROLE_ID)
+				_, err := p.daoRole.Update(childId, changes)
+				return err
+			},
+		},
+		userTypeDefaultsReference(p.daoUserType, FLD_DEFAULT_ROLE_IDS),
+	}
+}
+
+// resolveRolePermissions - Get the permissions of the role and all its parent roles.
+// Returns the permissions, the visited role ids starting with the given role, and the visited
+// parent role ids which are not found. A cycle check needs those too, the role may be created later.
+func resolveRolePermissions(daoRole business_repository.RoleDao, roleId string) ([]string, []string, []string, error) {
+
+	permissions := map[string]bool{}
+	visited := map[string]bool{roleId: true}
+	roleIds := []string{roleId}
+	danglingIds := []string{}
+
+	for idx := 0; idx < len(roleIds); idx++ {
+		dataRole, err := daoRole.GetDetails(roleIds[idx])
+		if err != nil {
+			if idx == 0 {
+				return nil, nil, nil, err
+			}
+			// Dangling parent reference, skip it
+			log.Println("resolveRolePermissions: Parent role not found ", roleIds[idx], err)
+			danglingIds = append(danglingIds, roleIds[idx])
+			continue
+		}
+
+		for _, permission := range getMemberDataStrArray(dataRole, FLD_ROLE_PERMISSIONS) {
+			permissions[permission] = true
+		}
+
+		for _, parentId := range getMemberDataStrArray(dataRole, FLD_ROLE_PARENT_IDS) {
+			if !visited[parentId] {
+				visited[parentId] = true
+				roleIds = append(roleIds, parentId)
+			}
+		}
+	}
+
+	return sortedKeys(permissions), roleIds, danglingIds, nil
+}
+
 func (p *roleBaseService) errorReturn(err error) (RoleService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -0,0 +1,61 @@
+package business_service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveRolePermissions(t *testing.T) {
+	tests := []struct {
+		name            string
+		roleId          string
+		wantPermissions []string
+		wantRoleIds     []string
+		wantDangling    []string
+	}{
+		{"without parents", "viewer", []string{"contact.view"}, []string{"viewer"}, []string{}},
+		{"inherited", "editor", []string{"contact.update", "contact.view"}, []string{"editor", "viewer"}, []string{}},
+		{"cycle", "cycle_a", []string{"contact.update", "contact.view", "site.update", "site.view"},
+			[]string{"cycle_a", "cycle_b", "editor", "viewer"}, []string{}},
+		{"own parent", "self", []string{"user.view"}, []string{"self"}, []string{}},
+		{"dangling parent", "orphan", []string{"payment.view"}, []string{"orphan", "deleted"}, []string{"deleted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permissions, roleIds, danglingIds, err := resolveRolePermissions(testRoles(), tt.roleId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(permissions, tt.wantPermissions) {
+				t.Errorf("permissions = %v, want %v", permissions, tt.wantPermissions)
+			}
+			if !reflect.DeepEqual(roleIds, tt.wantRoleIds) {
+				t.Errorf("role ids = %v, want %v", roleIds, tt.wantRoleIds)
+			}
+			if !reflect.DeepEqual(danglingIds, tt.wantDangling) {
+				t.Errorf("dangling role ids = %v, want %v", danglingIds, tt.wantDangling)
+			}
+		})
+	}
+}
+
+func TestResolveRolePermissionsMissingRole(t *testing.T) {
+	if _, _, _, err := resolveRolePermissions(testRoles(), "deleted"); err == nil {
+		t.Error("resolveRolePermissions succeeded for a missing role, want an error")
+	}
+}
+
+func TestGetResolvedPermissionsDanglingParent(t *testing.T) {
+	p := &roleBaseService{daoRole: testRoles(), businessID: "biz1"}
+
+	response, err := p.GetResolvedPermissions("orphan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inherited := response[FLD_INHERITED_ROLES]; !reflect.DeepEqual(inherited, []string{}) {
+		t.Errorf("inherited roles = %v, want none", inherited)
+	}
+	if dangling := response[FLD_DANGLING_ROLES]; !reflect.DeepEqual(dangling, []string{"deleted"}) {
+		t.Errorf("dangling roles = %v, want [deleted]", dangling)
+	}
+}
@@ -0,0 +1,406 @@
+package business_service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Site calendar fields, all times are in the time zone of the site
+const (
+	// IANA time zone, the business time zone when not set
+	FLD_SITE_TIMEZONE = "timezone"
+	// Opening intervals by day name, a site without opening hours is open around the clock
+	FLD_SITE_OPENING_HOURS = "opening_hours"
+	FLD_SITE_HOLIDAYS      = "holidays"
+	FLD_SITE_CLOSURES      = "closures"
+
+	// Opening interval "HH:MM", close may be "24:00"
+	FLD_OPENING_OPEN  = "open"
+	FLD_OPENING_CLOSE = "close"
+
+	// Holiday date "YYYY-MM-DD", every year on the same day when recurring
+	FLD_HOLIDAY_DATE      = "date"
+	FLD_HOLIDAY_NAME      = "name"
+	FLD_HOLIDAY_RECURRING = "recurring"
+
+	// Closure from and until, until is excluded. Stored RFC3339 with the offset of the site time zone,
+	// "YYYY-MM-DD HH:MM:SS" in the site time zone is accepted when given.
+	FLD_CLOSURE_FROM   = "from"
+	FLD_CLOSURE_UNTIL  = "until"
+	FLD_CLOSURE_REASON = "reason"
+)
+
+// NEXT_OPENING_SEARCH_DAYS - How far NextOpening looks ahead
+const NEXT_OPENING_SEARCH_DAYS = 400
+
+// weekdayNames - Day names of the opening hours, indexed by time.Weekday
+var weekdayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// siteCalendar - Opening hours, holidays and closures of a site, ready to query
+type siteCalendar struct {
+	location *time.Location
+	// Opening intervals in seconds from midnight, by weekday
+	hours     [7][][2]int
+	holidays  map[string]bool
+	recurring map[string]bool
+	closures  [][2]time.Time
+}
+
+// IsOpenAt - Whether the site is open at the given time
+func (p *siteBaseService) IsOpenAt(siteId string, at time.Time) (bool, error) {
+
+	log.Println("SiteService::IsOpenAt - Begin", siteId, at)
+
+	calendar, err := p.getSiteCalendar(siteId)
+	if err != nil {
+		return false, err
+	}
+
+	open := calendar.isOpen(at)
+
+	log.Println("SiteService::IsOpenAt - End", siteId, open)
+	return open, nil
+}
+
+// NextOpening - The first time from the given time on when the site is open, the given time when it is open
+func (p *siteBaseService) NextOpening(siteId string, from time.Time) (time.Time, error) {
+
+	funcode := p.getServiceModuleCode() + "04"
+
+	log.Println("SiteService::NextOpening - Begin", siteId, from)
+
+	calendar, err := p.getSiteCalendar(siteId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next, ok := calendar.nextOpening(from)
+	if !ok {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "No opening",
+			ErrorDetail: fmt.Sprintf("Site %s does not open within %d days", siteId, NEXT_OPENING_SEARCH_DAYS)}
+		return time.Time{}, err
+	}
+
+	log.Println("SiteService::NextOpening - End", siteId, next)
+	return next, nil
+}
+
+// OpenSitesAt - List the sites open at the given time, fails on a site with an invalid calendar
+func (p *siteBaseService) OpenSitesAt(at time.Time) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "05"
+
+	log.Println("SiteService::OpenSitesAt - Begin", at)
+
+	response, err := p.daoSite.List("", "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLocation, err := getBusinessLocation(p.dbRegion.GetClient(), p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	openSites := []utils.Map{}
+	for _, dataSite := range getListResult(response) {
+		calendar, err := newSiteCalendar(dataSite, defaultLocation)
+		if err != nil {
+			siteId, _ := utils.GetMemberDataStr(dataSite, business_common.FLD_APP_SITE_ID)
+			err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid site calendar",
+				ErrorDetail: fmt.Sprintf("Site %s: %v", siteId, err)}
+			return nil, err
+		}
+		if calendar.isOpen(at) {
+			openSites = append(openSites, dataSite)
+		}
+	}
+
+	log.Println("SiteService::OpenSitesAt - End", len(openSites))
+	return listResponse(openSites), nil
+}
+
+// getSiteCalendar - Get the site and its calendar
+func (p *siteBaseService) getSiteCalendar(siteId string) (*siteCalendar, error) {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	dataSite, err := p.daoSite.Get(siteId)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := getBusinessLocation(p.dbRegion.GetClient(), p.businessID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar, err := newSiteCalendar(dataSite, location)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid site calendar", ErrorDetail: err.Error()}
+		return nil, err
+	}
+	return calendar, nil
+}
+
+// validateSiteCalendar - Verify the calendar fields given for the site and store them in their normal form.
+// dataSite is the stored site on update, its time zone applies when the update does not change it.
+func (p *siteBaseService) validateSiteCalendar(dataSite utils.Map, indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	location, err := getBusinessLocation(p.dbRegion.GetClient(), p.businessID)
+	if err != nil {
+		return err
+	}
+
+	// Closures stored without offset are in the time zone they were given in, so a change of the
+	// time zone stores them again with the offset of that zone
+	_, changesZone := indata[FLD_SITE_TIMEZONE]
+	_, hasClosures := indata[FLD_SITE_CLOSURES]
+	if stored := getMemberDataMapArray(dataSite, FLD_SITE_CLOSURES); changesZone && !hasClosures && len(stored) > 0 {
+		storedCalendar, err := newSiteCalendar(dataSite, location)
+		if err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid site calendar", ErrorDetail: err.Error()}
+			return err
+		}
+		indata[FLD_SITE_CLOSURES] = storedCalendar.closureList(stored)
+	}
+
+	merged := utils.Map{}
+	for _, field := range []string{FLD_SITE_TIMEZONE, FLD_SITE_OPENING_HOURS, FLD_SITE_HOLIDAYS, FLD_SITE_CLOSURES} {
+		if value, ok := indata[field]; ok {
+			merged[field] = value
+		} else if value, ok := dataSite[field]; ok {
+			merged[field] = value
+		}
+	}
+
+	calendar, err := newSiteCalendar(merged, location)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid site calendar", ErrorDetail: err.Error()}
+		return err
+	}
+
+	if _, ok := indata[FLD_SITE_OPENING_HOURS]; ok {
+		indata[FLD_SITE_OPENING_HOURS] = calendar.openingHours()
+	}
+	if _, ok := indata[FLD_SITE_CLOSURES]; ok {
+		indata[FLD_SITE_CLOSURES] = calendar.closureList(getMemberDataMapArray(indata, FLD_SITE_CLOSURES))
+	}
+	return nil
+}
+
+// newSiteCalendar - Read the calendar fields of the site
+func newSiteCalendar(dataSite utils.Map, defaultLocation *time.Location) (*siteCalendar, error) {
+	calendar := &siteCalendar{
+		location:  defaultLocation,
+		holidays:  map[string]bool{},
+		recurring: map[string]bool{},
+	}
+
+	if timezone, _ := utils.GetMemberDataStr(dataSite, FLD_SITE_TIMEZONE); len(timezone) > 0 {
+		location, err := loadTimezone(FLD_SITE_TIMEZONE, timezone)
+		if err != nil {
+			return nil, err
+		}
+		calendar.location = location
+	}
+
+	openingHours, ok := getMemberDataMap(dataSite, FLD_SITE_OPENING_HOURS)
+	if !ok {
+		// Open around the clock
+		for day := range calendar.hours {
+			calendar.hours[day] = [][2]int{{0, 24 * 3600}}
+		}
+	}
+	for dayName := range openingHours {
+		day := indexOfString(weekdayNames, dayName)
+		if day < 0 {
+			return nil, fmt.Errorf("%s has invalid day %q", FLD_SITE_OPENING_HOURS, dayName)
+		}
+		for _, interval := range getMemberDataMapArray(openingHours, dayName) {
+			opens, err := parseClockTime(interval, FLD_OPENING_OPEN)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s: %v", FLD_SITE_OPENING_HOURS, dayName, err)
+			}
+			closes, err := parseClockTime(interval, FLD_OPENING_CLOSE)
+			if err != nil {
+				return nil, fmt.Errorf("%s of %s: %v", FLD_SITE_OPENING_HOURS, dayName, err)
+			}
+			if closes <= opens {
+				return nil, fmt.Errorf("%s of %s closes before it opens, split intervals over midnight", FLD_SITE_OPENING_HOURS, dayName)
+			}
+			calendar.hours[day] = append(calendar.hours[day], [2]int{opens, closes})
+		}
+		sort.Slice(calendar.hours[day], func(i, j int) bool { return calendar.hours[day][i][0] < calendar.hours[day][j][0] })
+	}
+
+	for _, holiday := range getMemberDataMapArray(dataSite, FLD_SITE_HOLIDAYS) {
+		date, _ := utils.GetMemberDataStr(holiday, FLD_HOLIDAY_DATE)
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("%s date %q is not YYYY-MM-DD", FLD_SITE_HOLIDAYS, date)
+		}
+		if recurring, _ := utils.GetMemberDataBool(holiday, FLD_HOLIDAY_RECURRING); recurring {
+			calendar.recurring[date[5:]] = true
+		} else {
+			calendar.holidays[date] = true
+		}
+	}
+
+	for _, closure := range getMemberDataMapArray(dataSite, FLD_SITE_CLOSURES) {
+		from, err := parseSiteTime(closure[FLD_CLOSURE_FROM], calendar.location)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", FLD_SITE_CLOSURES, FLD_CLOSURE_FROM, err)
+		}
+		until, err := parseSiteTime(closure[FLD_CLOSURE_UNTIL], calendar.location)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", FLD_SITE_CLOSURES, FLD_CLOSURE_UNTIL, err)
+		}
+		if !from.Before(until) {
+			return nil, fmt.Errorf("%s ends before it starts", FLD_SITE_CLOSURES)
+		}
+		calendar.closures = append(calendar.closures, [2]time.Time{from, until})
+	}
+
+	return calendar, nil
+}
+
+// isOpen - Whether the time is in an opening interval, not on a holiday and not in a closure
+func (c *siteCalendar) isOpen(at time.Time) bool {
+	local := at.In(c.location)
+	if c.isHoliday(local) {
+		return false
+	}
+	for _, closure := range c.closures {
+		if !at.Before(closure[0]) && at.Before(closure[1]) {
+			return false
+		}
+	}
+
+	seconds := local.Hour()*3600 + local.Minute()*60 + local.Second()
+	for _, interval := range c.hours[local.Weekday()] {
+		if seconds >= interval[0] && seconds < interval[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpening - The site opens either at an opening interval start or when a closure ends,
+// so the earliest of those from the given time on which is open is the next opening
+func (c *siteCalendar) nextOpening(from time.Time) (time.Time, bool) {
+	if c.isOpen(from) {
+		return from, true
+	}
+
+	limit := from.AddDate(0, 0, NEXT_OPENING_SEARCH_DAYS)
+	candidates := []time.Time{}
+	for _, closure := range c.closures {
+		if closure[1].After(from) && closure[1].Before(limit) {
+			candidates = append(candidates, closure[1])
+		}
+	}
+
+	local := from.In(c.location)
+	for offset := 0; offset <= NEXT_OPENING_SEARCH_DAYS; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, c.location)
+		for _, interval := range c.hours[day.Weekday()] {
+			// Wall clock time, also on the days the clocks change
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, interval[0], 0, c.location)
+			if start.After(from) {
+				candidates = append(candidates, start)
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	for _, candidate := range candidates {
+		if c.isOpen(candidate) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isHoliday - Whether the local date is a holiday
+func (c *siteCalendar) isHoliday(local time.Time) bool {
+	date := local.Format(time.DateOnly)
+	return c.holidays[date] || c.recurring[date[5:]]
+}
+
+// openingHours - Opening hours in stored form
+func (c *siteCalendar) openingHours() utils.Map {
+	openingHours := utils.Map{}
+	for day, intervals := range c.hours {
+		if len(intervals) == 0 {
+			continue
+		}
+		dayHours := []utils.Map{}
+		for _, interval := range intervals {
+			dayHours = append(dayHours, utils.Map{
+				FLD_OPENING_OPEN:  formatClockTime(interval[0]),
+				FLD_OPENING_CLOSE: formatClockTime(interval[1]),
+			})
+		}
+		openingHours[weekdayNames[day]] = dayHours
+	}
+	return openingHours
+}
+
+// closureList - Closures in stored form, RFC3339 in the time zone of the site
+func (c *siteCalendar) closureList(closures []utils.Map) []utils.Map {
+	result := []utils.Map{}
+	for idx, closure := range closures {
+		data := utils.CopyMap(closure)
+		data[FLD_CLOSURE_FROM] = c.closures[idx][0].In(c.location).Format(time.RFC3339)
+		data[FLD_CLOSURE_UNTIL] = c.closures[idx][1].In(c.location).Format(time.RFC3339)
+		result = append(result, data)
+	}
+	return result
+}
+
+// parseClockTime - Seconds from midnight of the "HH:MM" field
+func parseClockTime(data utils.Map, field string) (int, error) {
+	value, _ := utils.GetMemberDataStr(data, field)
+	hourStr, minuteStr, ok := strings.Cut(value, ":")
+	hour, errHour := strconv.Atoi(hourStr)
+	minute, errMinute := strconv.Atoi(minuteStr)
+	if !ok || len(minuteStr) != 2 || errHour != nil || errMinute != nil ||
+		hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("%s %q is not HH:MM", field, value)
+	}
+	return (hour*60 + minute) * 60, nil
+}
+
+// formatClockTime - "HH:MM" of the seconds from midnight
+func formatClockTime(seconds int) string {
+	return fmt.Sprintf("%02d:%02d", seconds/3600, seconds%3600/60)
+}
+
+// parseSiteTime - Parse a time given as time.Time, RFC3339 string or "YYYY-MM-DD HH:MM:SS" string of the site time zone
+func parseSiteTime(value any, location *time.Location) (time.Time, error) {
+	if dataVal, ok := value.(string); ok {
+		if parsed, err := time.ParseInLocation(time.DateTime, dataVal, location); err == nil {
+			return parsed, nil
+		}
+	}
+	return parseDateTime(value)
+}
+
+// indexOfString - Position of the value in the list, -1 when missing
+func indexOfString(list []string, value string) int {
+	for idx, item := range list {
+		if item == value {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,179 @@
+package business_service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testSite - Site open on working days from 09:00 to 17:00 in Berlin, with a holiday and a closure
+func testSite() utils.Map {
+	weekday := []utils.Map{{FLD_OPENING_OPEN: "09:00", FLD_OPENING_CLOSE: "17:00"}}
+	return utils.Map{
+		FLD_SITE_TIMEZONE: "Europe/Berlin",
+		FLD_SITE_OPENING_HOURS: utils.Map{
+			"monday": weekday, "tuesday": weekday, "wednesday": weekday, "thursday": weekday, "friday": weekday,
+			"sunday": []utils.Map{{FLD_OPENING_OPEN: "02:30", FLD_OPENING_CLOSE: "04:00"}},
+		},
+		FLD_SITE_HOLIDAYS: []utils.Map{
+			{FLD_HOLIDAY_DATE: "2026-10-14", FLD_HOLIDAY_NAME: "Closed"},
+			{FLD_HOLIDAY_DATE: "2020-12-25", FLD_HOLIDAY_NAME: "Christmas", FLD_HOLIDAY_RECURRING: true},
+		},
+		FLD_SITE_CLOSURES: []utils.Map{
+			{FLD_CLOSURE_FROM: "2026-10-13 12:00:00", FLD_CLOSURE_UNTIL: "2026-10-13 14:00:00", FLD_CLOSURE_REASON: "Inventory"},
+		},
+	}
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestSiteCalendarIsOpen(t *testing.T) {
+	calendar, err := newSiteCalendar(testSite(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		{"before opening", "2026-10-12T08:30:00+02:00", false},
+		{"at opening", "2026-10-12T09:00:00+02:00", true},
+		{"given in UTC", "2026-10-12T14:59:59Z", true},
+		{"at closing", "2026-10-12T17:00:00+02:00", false},
+		{"saturday", "2026-10-17T10:00:00+02:00", false},
+		{"holiday", "2026-10-14T10:00:00+02:00", false},
+		{"recurring holiday", "2026-12-25T10:00:00+01:00", false},
+		{"in closure", "2026-10-13T13:00:00+02:00", false},
+		{"closure end", "2026-10-13T14:00:00+02:00", true},
+		{"skipped hour is open at 03:30", "2026-03-29T01:30:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.isOpen(mustParseTime(t, tt.at)); got != tt.want {
+				t.Errorf("isOpen(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSiteCalendarNextOpening(t *testing.T) {
+	calendar, err := newSiteCalendar(testSite(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		from string
+		want string
+	}{
+		{"open now", "2026-10-12T10:00:00+02:00", "2026-10-12T10:00:00+02:00"},
+		{"later today", "2026-10-12T07:00:00+02:00", "2026-10-12T09:00:00+02:00"},
+		{"end of closure", "2026-10-13T13:00:00+02:00", "2026-10-13T14:00:00+02:00"},
+		{"after holiday", "2026-10-13T18:00:00+02:00", "2026-10-15T09:00:00+02:00"},
+		{"over saturday", "2026-10-16T18:00:00+02:00", "2026-10-18T02:30:00+02:00"},
+		{"after sunday", "2026-10-18T04:00:00+02:00", "2026-10-19T09:00:00+02:00"},
+		// 02:30 does not exist when the clocks go forward, the wall clock time moves to 03:30
+		{"clocks forward", "2026-03-28T18:00:00+01:00", "2026-03-29T03:30:00+02:00"},
+		// Opens at 09:00 of winter time after the clocks go back
+		{"clocks back", "2026-10-25T05:00:00+01:00", "2026-10-26T09:00:00+01:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := calendar.nextOpening(mustParseTime(t, tt.from))
+			if want := mustParseTime(t, tt.want); !ok || !got.Equal(want) {
+				t.Errorf("nextOpening(%s) = %s %v, want %s", tt.from, got, ok, want)
+			}
+		})
+	}
+}
+
+func TestSiteCalendarNextOpeningNever(t *testing.T) {
+	calendar, err := newSiteCalendar(utils.Map{FLD_SITE_OPENING_HOURS: utils.Map{}}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := calendar.nextOpening(mustParseTime(t, "2026-10-12T10:00:00Z")); ok {
+		t.Errorf("nextOpening = %s, want none", got)
+	}
+}
+
+func TestSiteCalendarDefaults(t *testing.T) {
+	newYork, _ := loadTimezone(FLD_SITE_TIMEZONE, "America/New_York")
+	calendar, err := newSiteCalendar(utils.Map{}, newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calendar.location != newYork {
+		t.Errorf("location = %s, want the business time zone", calendar.location)
+	}
+	if !calendar.isOpen(mustParseTime(t, "2026-10-17T03:00:00Z")) {
+		t.Error("site without opening hours is not open around the clock")
+	}
+}
+
+func TestSiteCalendarInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		site utils.Map
+	}{
+		{"unknown time zone", utils.Map{FLD_SITE_TIMEZONE: "Mars/Olympus"}},
+		{"server time zone", utils.Map{FLD_SITE_TIMEZONE: "Local"}},
+		{"unknown day", utils.Map{FLD_SITE_OPENING_HOURS: utils.Map{"funday": []utils.Map{}}}},
+		{"invalid clock time", utils.Map{FLD_SITE_OPENING_HOURS: utils.Map{
+			"monday": []utils.Map{{FLD_OPENING_OPEN: "9:5", FLD_OPENING_CLOSE: "17:00"}}}}},
+		{"after 24:00", utils.Map{FLD_SITE_OPENING_HOURS: utils.Map{
+			"monday": []utils.Map{{FLD_OPENING_OPEN: "09:00", FLD_OPENING_CLOSE: "24:01"}}}}},
+		{"over midnight", utils.Map{FLD_SITE_OPENING_HOURS: utils.Map{
+			"monday": []utils.Map{{FLD_OPENING_OPEN: "22:00", FLD_OPENING_CLOSE: "02:00"}}}}},
+		{"invalid holiday", utils.Map{FLD_SITE_HOLIDAYS: []utils.Map{{FLD_HOLIDAY_DATE: "25.12.2026"}}}},
+		{"closure ends before it starts", utils.Map{FLD_SITE_CLOSURES: []utils.Map{
+			{FLD_CLOSURE_FROM: "2026-10-13 14:00:00", FLD_CLOSURE_UNTIL: "2026-10-13 12:00:00"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSiteCalendar(tt.site, time.UTC); err == nil {
+				t.Error("newSiteCalendar succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestSiteCalendarClosuresKeepTheirTime(t *testing.T) {
+	site := testSite()
+	calendar, err := newSiteCalendar(site, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closures := calendar.closureList(getMemberDataMapArray(site, FLD_SITE_CLOSURES))
+	if from := closures[0][FLD_CLOSURE_FROM]; from != "2026-10-13T12:00:00+02:00" {
+		t.Errorf("stored from = %v, want RFC3339 with the site offset", from)
+	}
+	if reason := closures[0][FLD_CLOSURE_REASON]; reason != "Inventory" {
+		t.Errorf("stored reason = %v, want it kept", reason)
+	}
+
+	// Stored closures are the same times after the site moves to another time zone
+	site[FLD_SITE_TIMEZONE] = "America/New_York"
+	site[FLD_SITE_CLOSURES] = closures
+	moved, err := newSiteCalendar(site, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := range calendar.closures {
+		if !moved.closures[idx][0].Equal(calendar.closures[idx][0]) || !moved.closures[idx][1].Equal(calendar.closures[idx][1]) {
+			t.Errorf("closure %d moved from %v to %v", idx, calendar.closures[idx], moved.closures[idx])
+		}
+	}
+}
@@ -3,6 +3,7 @@ package business_service
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-business-repository/business_repository"
@@ -20,6 +21,12 @@ type SiteService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(siteid string, indata utils.Map) (utils.Map, error)
 	Delete(siteid string) error
+	DeleteWithOptions(siteid string, opts utils.Map) (utils.Map, error)
+
+	// Opening hours, holidays and closures, in the time zone of the site
+	IsOpenAt(siteid string, at time.Time) (bool, error)
+	NextOpening(siteid string, from time.Time) (time.Time, error)
+	OpenSitesAt(at time.Time) (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,11 +38,14 @@ type SiteService interface {
 // SiteBaseService - Sites Service structure
 type siteBaseService struct {
 	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
-	daoSite     business_repository.SiteDao
-	daoBusiness platform_repository.BusinessDao
-	child       SiteService
-	businessID  string
+	dbRegion       db_utils.DatabaseService
+	daoSite        business_repository.SiteDao
+	daoAccess      business_repository.AccessDao
+	daoUserType    business_repository.UserTypeDao
+	daoBusiness    platform_repository.BusinessDao
+	child          SiteService
+	businessID     string
+	businessStatus string
 }
 
 func init() {
@@ -70,7 +80,7 @@ func NewSiteService(props utils.Map) (SiteService, error) {
 	p.businessID = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -79,6 +89,12 @@ func NewSiteService(props utils.Map) (SiteService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -94,9 +110,15 @@ func (p *siteBaseService) EndService() {
 func (p *siteBaseService) initializeService() {
 	log.Printf("SiteService:: GetBusinessDao ")
 	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
 }
 
+func (p *siteBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "12"
+}
+
 // List - List All records
 func (p *siteBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
 
@@ -133,6 +155,10 @@ func (p *siteBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	dataval, dataok := indata[business_common.FLD_APP_SITE_ID]
 	if !dataok {
 		uid := utils.GenerateUniqueId("site")
@@ -149,6 +175,16 @@ func (p *siteBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return indata, err
 	}
 
+	err = p.validateSiteCalendar(utils.Map{}, indata)
+	if err != nil {
+		return indata, err
+	}
+
+	err = checkQuota(p.dbRegion.GetClient(), p.businessID, QUOTA_MAX_SITES, 1)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoSite.Create(indata)
 	if err != nil {
 		return indata, err
@@ -162,11 +198,20 @@ func (p *siteBaseService) Update(site_id string, indata utils.Map) (utils.Map, e
 
 	log.Println("SiteService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	data, err := p.daoSite.Get(site_id)
 	if err != nil {
 		return data, err
 	}
 
+	err = p.validateSiteCalendar(data, indata)
+	if err != nil {
+		return nil, err
+	}
+
 	data, err = p.daoSite.Update(site_id, indata)
 	log.Println("SiteService::Update - End ")
 	return data, err
@@ -177,16 +222,88 @@ func (p *siteBaseService) Delete(site_id string) error {
 
 	log.Println("SiteService::Delete - Begin", site_id)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	err := p.deleteSite(site_id)
+
+	log.Println("SiteService::Delete - End", err)
+	return err
+}
+
+// deleteSite - Delete the site unless it is still referred, the business is verified writable by the caller
+func (p *siteBaseService) deleteSite(site_id string) error {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	err := verifyNoReferences(funcode+"01", "Site", p.references(), site_id)
+	if err != nil {
+		return err
+	}
+
 	daoSite := p.daoSite
 	result, err := daoSite.Delete(site_id)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("SiteService::Delete - End %v", result)
+	log.Printf("Delete %v", result)
 	return nil
 }
 
+// DeleteWithOptions - Delete the site after moving its grants and user type defaults to the site
+// given in reassign_to, or after revoking and removing them with cascade
+func (p *siteBaseService) DeleteWithOptions(site_id string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("SiteService::DeleteWithOptions - Begin", site_id, opts)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	toId, cascade, err := getDeleteOptions(funcode, site_id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toId) > 0 {
+		if _, err := p.daoSite.Get(toId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid reassign_to", ErrorDetail: "Given reassign_to site is not exist"}
+			return nil, err
+		}
+	}
+
+	// Move or remove the references and delete the site all at once
+	p.dbRegion.BeginTransaction()
+
+	summary, err := handleReferences(p.references(), site_id, toId, cascade)
+	if err == nil {
+		err = p.deleteSite(site_id)
+	}
+	if err != nil {
+		log.Println("DeleteWithOptions: Rollback ", site_id, err)
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
+
+	p.dbRegion.CommitTransaction()
+	summary[business_common.FLD_APP_SITE_ID] = site_id
+
+	log.Println("SiteService::DeleteWithOptions - End", summary)
+	return summary, nil
+}
+
+// references - Records which may refer to a site
+func (p *siteBaseService) references() []reference {
+	return []reference{
+		grantReference(p.daoAccess, business_common.FLD_APP_SITE_ID),
+		userTypeDefaultsReference(p.daoUserType, FLD_DEFAULT_SITE_IDS),
+	}
+}
+
 func (p *siteBaseService) errorReturn(err error) (SiteService, error) {
 	// Close the Database Connection
 	p.EndService()
@@ -20,6 +20,7 @@ type TerritoryService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(territory_id string, indata utils.Map) (utils.Map, error)
 	Delete(territory_id string) error
+	DeleteWithOptions(territory_id string, opts utils.Map) (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -31,11 +32,13 @@ type TerritoryService interface {
 // TerritoryBaseService - Territorys Service structure
 type territoryBaseService struct {
 	db_utils.DatabaseService
-	dbRegion     db_utils.DatabaseService
-	daoTerritory business_repository.TerritoryDao
-	daoBusiness  platform_repository.BusinessDao
-	child        TerritoryService
-	businessID   string
+	dbRegion       db_utils.DatabaseService
+	daoTerritory   business_repository.TerritoryDao
+	daoSite        business_repository.SiteDao
+	daoBusiness    platform_repository.BusinessDao
+	child          TerritoryService
+	businessID     string
+	businessStatus string
 }
 
 func init() {
@@ -71,7 +74,7 @@ func NewTerritoryService(props utils.Map) (TerritoryService, error) {
 	p.businessID = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -80,6 +83,12 @@ func NewTerritoryService(props utils.Map) (TerritoryService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -95,9 +104,14 @@ func (p *territoryBaseService) EndService() {
 func (p *territoryBaseService) initializeService() {
 	log.Printf("TerritoryService:: GetBusinessDao ")
 	p.daoTerritory = business_repository.NewTerritoryDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
 }
 
+func (p *territoryBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "13"
+}
+
 // List - List All records
 func (p *territoryBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
 
@@ -134,6 +148,10 @@ func (p *territoryBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	dataval, dataok := indata[business_common.FLD_APP_TERRITORY_ID]
 	if !dataok {
 		uid := utils.GenerateUniqueId("territory")
@@ -150,6 +168,11 @@ func (p *territoryBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return indata, err
 	}
 
+	err = checkQuota(p.dbRegion.GetClient(), p.businessID, QUOTA_MAX_TERRITORIES, 1)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoTerritory.Create(indata)
 	if err != nil {
 		return indata, err
@@ -163,6 +186,10 @@ func (p *territoryBaseService) Update(territory_id string, indata utils.Map) (ut
 
 	log.Println("TerritoryService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	data, err := p.daoTerritory.Get(territory_id)
 	if err != nil {
 		return data, err
@@ -178,16 +205,87 @@ func (p *territoryBaseService) Delete(territory_id string) error {
 
 	log.Println("TerritoryService::Delete - Begin", territory_id)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	err := p.deleteTerritory(territory_id)
+
+	log.Println("TerritoryService::Delete - End", err)
+	return err
+}
+
+// deleteTerritory - Delete the territory unless it is still referred, the business is verified writable by the caller
+func (p *territoryBaseService) deleteTerritory(territory_id string) error {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	err := verifyNoReferences(funcode+"01", "Territory", p.references(), territory_id)
+	if err != nil {
+		return err
+	}
+
 	daoTerritory := p.daoTerritory
 	result, err := daoTerritory.Delete(territory_id)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("TerritoryService::Delete - End %v", result)
+	log.Printf("Delete %v", result)
 	return nil
 }
 
+// DeleteWithOptions - Delete the territory after moving its sites to the territory given in reassign_to,
+// or after clearing the territory of its sites with cascade
+func (p *territoryBaseService) DeleteWithOptions(territory_id string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("TerritoryService::DeleteWithOptions - Begin", territory_id, opts)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	toId, cascade, err := getDeleteOptions(funcode, territory_id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toId) > 0 {
+		if _, err := p.daoTerritory.Get(toId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid reassign_to", ErrorDetail: "Given reassign_to territory is not exist"}
+			return nil, err
+		}
+	}
+
+	// Move or clear the references and delete the territory all at once
+	p.dbRegion.BeginTransaction()
+
+	summary, err := handleReferences(p.references(), territory_id, toId, cascade)
+	if err == nil {
+		err = p.deleteTerritory(territory_id)
+	}
+	if err != nil {
+		log.Println("DeleteWithOptions: Rollback ", territory_id, err)
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
+
+	p.dbRegion.CommitTransaction()
+	summary[business_common.FLD_APP_TERRITORY_ID] = territory_id
+
+	log.Println("TerritoryService::DeleteWithOptions - End", summary)
+	return summary, nil
+}
+
+// references - Records which may refer to a territory
+func (p *territoryBaseService) references() []reference {
+	return []reference{
+		siteReference(p.daoSite, business_common.FLD_APP_TERRITORY_ID, false),
+	}
+}
+
 func (p *territoryBaseService) errorReturn(err error) (TerritoryService, error) {
 	// Close the Database Connection
 	p.EndService()
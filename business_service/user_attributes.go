@@ -0,0 +1,200 @@
+package business_service
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Attribute schema fields
+const (
+	// UserType field holding the list of attribute definitions
+	FLD_ATTRIBUTE_SCHEMA = "attribute_schema"
+	// User field holding the attribute values
+	FLD_ATTRIBUTES = "attributes"
+
+	FLD_ATTRIBUTE_NAME     = "name"
+	FLD_ATTRIBUTE_TYPE     = "type"
+	FLD_ATTRIBUTE_REQUIRED = "required"
+	FLD_ATTRIBUTE_ENUM     = "enum"
+	FLD_ATTRIBUTE_DEFAULT  = "default"
+)
+
+// Attribute types
+const (
+	ATTRIBUTE_TYPE_STRING  = "string"
+	ATTRIBUTE_TYPE_NUMBER  = "number"
+	ATTRIBUTE_TYPE_INTEGER = "integer"
+	ATTRIBUTE_TYPE_BOOLEAN = "boolean"
+	// Date given as "YYYY-MM-DD"
+	ATTRIBUTE_TYPE_DATE = "date"
+)
+
+// normaliseAttributeSchema - Verify the attribute definitions of a user type and return them in stored form
+func normaliseAttributeSchema(schema []utils.Map) ([]utils.Map, error) {
+	names := map[string]bool{}
+	result := []utils.Map{}
+
+	for _, attr := range schema {
+		name, _ := utils.GetMemberDataStr(attr, FLD_ATTRIBUTE_NAME)
+		if len(name) == 0 {
+			return nil, fmt.Errorf("attribute name is required")
+		}
+		if names[name] {
+			return nil, fmt.Errorf("attribute %s is defined more than once", name)
+		}
+		names[name] = true
+
+		attrType, _ := utils.GetMemberDataStr(attr, FLD_ATTRIBUTE_TYPE)
+		switch attrType {
+		case ATTRIBUTE_TYPE_STRING, ATTRIBUTE_TYPE_NUMBER, ATTRIBUTE_TYPE_INTEGER, ATTRIBUTE_TYPE_BOOLEAN, ATTRIBUTE_TYPE_DATE:
+		default:
+			return nil, fmt.Errorf("attribute %s has invalid type %q", name, attrType)
+		}
+
+		required, _ := utils.GetMemberDataBool(attr, FLD_ATTRIBUTE_REQUIRED)
+		definition := utils.Map{
+			FLD_ATTRIBUTE_NAME:     name,
+			FLD_ATTRIBUTE_TYPE:     attrType,
+			FLD_ATTRIBUTE_REQUIRED: required,
+		}
+
+		if enumVal, ok := attr[FLD_ATTRIBUTE_ENUM]; ok && enumVal != nil {
+			refVal := reflect.ValueOf(enumVal)
+			if refVal.Kind() != reflect.Slice && refVal.Kind() != reflect.Array {
+				return nil, fmt.Errorf("attribute %s enum should be a list", name)
+			}
+			enumValues := []any{}
+			for idx := 0; idx < refVal.Len(); idx++ {
+				value, err := checkAttributeValue(attrType, refVal.Index(idx).Interface())
+				if err != nil {
+					return nil, fmt.Errorf("attribute %s enum value: %v", name, err)
+				}
+				enumValues = append(enumValues, value)
+			}
+			if len(enumValues) > 0 {
+				definition[FLD_ATTRIBUTE_ENUM] = enumValues
+			}
+		}
+
+		if defVal, ok := attr[FLD_ATTRIBUTE_DEFAULT]; ok && defVal != nil {
+			value, err := checkAttribute(definition, defVal)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s default: %v", name, err)
+			}
+			definition[FLD_ATTRIBUTE_DEFAULT] = value
+		}
+
+		result = append(result, definition)
+	}
+	return result, nil
+}
+
+// applyAttributeSchema - Validate the attributes against the schema and fill in the defaults.
+// Without a schema the attributes are kept as they are.
+func applyAttributeSchema(schema []utils.Map, attributes utils.Map) (utils.Map, error) {
+	if len(schema) == 0 {
+		return attributes, nil
+	}
+
+	result := utils.Map{}
+	defined := map[string]bool{}
+
+	for _, attr := range schema {
+		name, _ := utils.GetMemberDataStr(attr, FLD_ATTRIBUTE_NAME)
+		defined[name] = true
+
+		value, ok := attributes[name]
+		if !ok || value == nil {
+			value, ok = attr[FLD_ATTRIBUTE_DEFAULT]
+		}
+		if !ok || value == nil {
+			if required, _ := utils.GetMemberDataBool(attr, FLD_ATTRIBUTE_REQUIRED); required {
+				return nil, fmt.Errorf("attribute %s is required", name)
+			}
+			continue
+		}
+
+		value, err := checkAttribute(attr, value)
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s: %v", name, err)
+		}
+		result[name] = value
+	}
+
+	for name := range attributes {
+		if !defined[name] {
+			return nil, fmt.Errorf("attribute %s is not defined in the schema", name)
+		}
+	}
+	return result, nil
+}
+
+// checkAttribute - Check the value against the type and enum values of the attribute definition
+func checkAttribute(attr utils.Map, value any) (any, error) {
+	attrType, _ := utils.GetMemberDataStr(attr, FLD_ATTRIBUTE_TYPE)
+	value, err := checkAttributeValue(attrType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	enumVal, ok := attr[FLD_ATTRIBUTE_ENUM]
+	if !ok || enumVal == nil {
+		return value, nil
+	}
+	refVal := reflect.ValueOf(enumVal)
+	if refVal.Kind() != reflect.Slice && refVal.Kind() != reflect.Array {
+		return value, nil
+	}
+	for idx := 0; idx < refVal.Len(); idx++ {
+		enumValue, err := checkAttributeValue(attrType, refVal.Index(idx).Interface())
+		if err == nil && enumValue == value {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("value %v is not one of the allowed values", value)
+}
+
+// checkAttributeValue - Check the value has the given type and return it in stored form
+func checkAttributeValue(attrType string, value any) (any, error) {
+	refVal := reflect.ValueOf(value)
+
+	switch attrType {
+	case ATTRIBUTE_TYPE_STRING:
+		if strVal, ok := value.(string); ok {
+			return strVal, nil
+		}
+	case ATTRIBUTE_TYPE_BOOLEAN:
+		if boolVal, ok := value.(bool); ok {
+			return boolVal, nil
+		}
+	case ATTRIBUTE_TYPE_NUMBER, ATTRIBUTE_TYPE_INTEGER:
+		var numVal float64
+		switch {
+		case refVal.CanInt():
+			numVal = float64(refVal.Int())
+		case refVal.CanUint():
+			numVal = float64(refVal.Uint())
+		case refVal.CanFloat():
+			numVal = refVal.Float()
+		default:
+			return nil, fmt.Errorf("value %v is not a %s", value, attrType)
+		}
+		if attrType == ATTRIBUTE_TYPE_INTEGER {
+			if numVal != float64(int64(numVal)) {
+				return nil, fmt.Errorf("value %v is not an integer", value)
+			}
+			return int64(numVal), nil
+		}
+		return numVal, nil
+	case ATTRIBUTE_TYPE_DATE:
+		if strVal, ok := value.(string); ok {
+			if _, err := time.Parse(time.DateOnly, strVal); err == nil {
+				return strVal, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("value %v is not a %s", value, attrType)
+}
@@ -0,0 +1,51 @@
+package business_service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestApplyAttributeSchema(t *testing.T) {
+	schema := []utils.Map{
+		{FLD_ATTRIBUTE_NAME: "employee_no", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_STRING, FLD_ATTRIBUTE_REQUIRED: true},
+		{FLD_ATTRIBUTE_NAME: "grade", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_INTEGER, FLD_ATTRIBUTE_DEFAULT: 1, FLD_ATTRIBUTE_ENUM: []any{1, 2, 3}},
+		{FLD_ATTRIBUTE_NAME: "rate", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_NUMBER},
+		{FLD_ATTRIBUTE_NAME: "remote", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_BOOLEAN},
+		{FLD_ATTRIBUTE_NAME: "joined", FLD_ATTRIBUTE_TYPE: ATTRIBUTE_TYPE_DATE},
+	}
+
+	tests := []struct {
+		name       string
+		schema     []utils.Map
+		attributes utils.Map
+		want       utils.Map
+		wantErr    bool
+	}{
+		{"without schema", nil, utils.Map{"any": 1}, utils.Map{"any": 1}, false},
+		{"defaults", schema, utils.Map{"employee_no": "E1"}, utils.Map{"employee_no": "E1", "grade": int64(1)}, false},
+		{"null is the default", schema, utils.Map{"employee_no": "E1", "grade": nil}, utils.Map{"employee_no": "E1", "grade": int64(1)}, false},
+		{"all types", schema,
+			utils.Map{"employee_no": "E1", "grade": 3.0, "rate": 12, "remote": true, "joined": "2026-10-12"},
+			utils.Map{"employee_no": "E1", "grade": int64(3), "rate": 12.0, "remote": true, "joined": "2026-10-12"}, false},
+		{"required missing", schema, utils.Map{}, nil, true},
+		{"not in enum", schema, utils.Map{"employee_no": "E1", "grade": 4}, nil, true},
+		{"not an integer", schema, utils.Map{"employee_no": "E1", "grade": 1.5}, nil, true},
+		{"not a number", schema, utils.Map{"employee_no": "E1", "rate": "12"}, nil, true},
+		{"not a boolean", schema, utils.Map{"employee_no": "E1", "remote": "yes"}, nil, true},
+		{"not a date", schema, utils.Map{"employee_no": "E1", "joined": "12.10.2026"}, nil, true},
+		{"not defined", schema, utils.Map{"employee_no": "E1", "nickname": "Sam"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyAttributeSchema(tt.schema, tt.attributes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyAttributeSchema error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyAttributeSchema = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
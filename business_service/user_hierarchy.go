@@ -0,0 +1,156 @@
+package business_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-dbutils/db_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// GetDirectReports - List the users whose manager is the given user
+func (p *userBaseService) GetDirectReports(userId string) (utils.Map, error) {
+	log.Println("UserService::GetDirectReports - Begin", userId)
+
+	filter := buildFilter(utils.Map{FLD_MANAGER_ID: userId})
+	response, err := p.List(filter, "", 0, 0)
+
+	log.Println("UserService::GetDirectReports - End", err)
+	return response, err
+}
+
+// GetReportingTree - List all the users reporting to the given user directly or indirectly
+func (p *userBaseService) GetReportingTree(userId string) (utils.Map, error) {
+	log.Println("UserService::GetReportingTree - Begin", userId)
+
+	dataUsers, err := getReportingTree(p.daoUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	p.enrichUserInfo(dataUsers)
+
+	log.Println("UserService::GetReportingTree - End", len(dataUsers))
+	return listResponse(dataUsers), nil
+}
+
+// GetChainOfCommand - List the managers of the user, starting with the direct manager
+func (p *userBaseService) GetChainOfCommand(userId string) (utils.Map, error) {
+	log.Println("UserService::GetChainOfCommand - Begin", userId)
+
+	dataUser, err := p.daoUser.Get(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	dataManagers := []utils.Map{}
+	visited := map[string]bool{userId: true}
+	for {
+		managerId, _ := utils.GetMemberDataStr(dataUser, FLD_MANAGER_ID)
+		if len(managerId) == 0 || visited[managerId] {
+			break
+		}
+		visited[managerId] = true
+
+		dataUser, err = p.daoUser.Get(managerId)
+		if err != nil {
+			log.Println("GetChainOfCommand: Manager not found ", managerId, err)
+			break
+		}
+		dataManagers = append(dataManagers, dataUser)
+	}
+	p.enrichUserInfo(dataManagers)
+
+	log.Println("UserService::GetChainOfCommand - End", len(dataManagers))
+	return listResponse(dataManagers), nil
+}
+
+// validateManager - Verify the manager exists and the user is not in the manager's chain of command
+func (p *userBaseService) validateManager(userId string, indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "05"
+
+	managerId, _ := utils.GetMemberDataStr(indata, FLD_MANAGER_ID)
+	if len(managerId) == 0 {
+		return nil
+	}
+
+	if managerId == userId {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid manager", ErrorDetail: "User cannot be their own manager"}
+		return err
+	}
+
+	visited := map[string]bool{}
+	for currentId := managerId; len(currentId) > 0 && !visited[currentId]; {
+		visited[currentId] = true
+
+		dataManager, err := p.daoUser.Get(currentId)
+		if err != nil {
+			if currentId == managerId {
+				err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid manager", ErrorDetail: "Given manager_id is not exist"}
+				return err
+			}
+			break
+		}
+
+		currentId, _ = utils.GetMemberDataStr(dataManager, FLD_MANAGER_ID)
+		if currentId == userId {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Cyclic reporting line", ErrorDetail: "Manager " + managerId + " already reports to the user"}
+			return err
+		}
+	}
+	return nil
+}
+
+// getReportingTree - Get all the users reporting to the user directly or indirectly, level by level
+func getReportingTree(daoUser business_repository.UserDao, userId string) ([]utils.Map, error) {
+	dataUsers := []utils.Map{}
+	visited := map[string]bool{userId: true}
+	managerIds := []string{userId}
+
+	for len(managerIds) > 0 {
+		filter := buildFilter(utils.Map{FLD_MANAGER_ID: utils.Map{"$in": managerIds}})
+		response, err := daoUser.List(filter, "", 0, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		managerIds = []string{}
+		for _, dataUser := range getListResult(response) {
+			reportId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USER_ID)
+			if !visited[reportId] {
+				visited[reportId] = true
+				managerIds = append(managerIds, reportId)
+				dataUsers = append(dataUsers, dataUser)
+			}
+		}
+	}
+	return dataUsers, nil
+}
+
+// getReportingTreeIds - Get the ids of all the users reporting to the user directly or indirectly
+func getReportingTreeIds(daoUser business_repository.UserDao, userId string) ([]string, error) {
+	dataUsers, err := getReportingTree(daoUser, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	reportIds := []string{}
+	for _, dataUser := range dataUsers {
+		reportId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USER_ID)
+		reportIds = append(reportIds, reportId)
+	}
+	return reportIds, nil
+}
+
+// listResponse - Build the List response for the given records
+func listResponse(listdata []utils.Map) utils.Map {
+	return utils.Map{
+		db_common.LIST_SUMMARY: utils.Map{
+			db_common.LIST_TOTALSIZE:    len(listdata),
+			db_common.LIST_FILTEREDSIZE: len(listdata),
+			db_common.LIST_RESULTSIZE:   len(listdata),
+		},
+		db_common.LIST_RESULT: listdata,
+	}
+}
@@ -0,0 +1,112 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testOrgUsers - ceo <- vp <- mgr <- dev1, dev2
+func testOrgUsers() *fakeUserDao {
+	users := map[string]utils.Map{}
+	for userId, managerId := range map[string]string{"ceo": "", "vp": "ceo", "mgr": "vp", "dev1": "mgr", "dev2": "mgr"} {
+		users[userId] = utils.Map{business_common.FLD_USER_ID: userId, FLD_MANAGER_ID: managerId}
+	}
+	return &fakeUserDao{users: users}
+}
+
+// userIds - Ids of the listed users
+func userIds(response utils.Map) []string {
+	ids := []string{}
+	for _, dataUser := range getListResult(response) {
+		ids = append(ids, dataUser[business_common.FLD_USER_ID].(string))
+	}
+	return ids
+}
+
+func TestValidateManager(t *testing.T) {
+	p := &userBaseService{daoUser: testOrgUsers()}
+
+	tests := []struct {
+		name      string
+		userId    string
+		managerId string
+		wantErr   bool
+	}{
+		{"no manager", "vp", "", false},
+		{"new manager", "dev1", "vp", false},
+		{"own manager", "dev1", "dev1", true},
+		{"missing manager", "dev1", "nobody", true},
+		{"manager reports to the user", "vp", "dev1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.validateManager(tt.userId, utils.Map{FLD_MANAGER_ID: tt.managerId})
+			var appErr *utils.AppError
+			if tt.wantErr != errors.As(err, &appErr) {
+				t.Errorf("validateManager(%s, %s) = %v, want error %v", tt.userId, tt.managerId, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetReportingTree(t *testing.T) {
+	p := &userBaseService{daoUser: testOrgUsers(), daoAppUser: &fakeAppUserDao{}}
+
+	response, err := p.GetReportingTree("vp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := userIds(response)
+	sort.Strings(ids)
+	if want := []string{"dev1", "dev2", "mgr"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("reporting tree = %v, want %v", ids, want)
+	}
+}
+
+func TestGetChainOfCommand(t *testing.T) {
+	p := &userBaseService{daoUser: testOrgUsers(), daoAppUser: &fakeAppUserDao{}}
+
+	response, err := p.GetChainOfCommand("dev1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, want := userIds(response), []string{"mgr", "vp", "ceo"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("chain of command = %v, want %v", ids, want)
+	}
+}
+
+func TestCheckPermissionOnUserReports(t *testing.T) {
+	p := &accessBaseService{
+		daoUser:  testOrgUsers(),
+		daoRole:  testRoles(),
+		daoGroup: &fakeCollectionDao{},
+		daoAccess: &fakeAccessDao{grants: []utils.Map{
+			{business_common.FLD_USER_ID: "mgr", business_common.FLD_ROLE_ID: "editor", FLD_GRANT_SCOPE: GRANT_SCOPE_REPORTS},
+		}},
+		businessID: "biz1",
+	}
+
+	tests := []struct {
+		targetId string
+		want     bool
+	}{
+		{"dev1", true},
+		{"vp", false},
+	}
+	for _, tt := range tests {
+		allowed, err := p.CheckPermissionOnUser("mgr", tt.targetId, "", "contact.update")
+		if err != nil || allowed != tt.want {
+			t.Errorf("CheckPermissionOnUser(mgr, %s) = %v %v, want %v", tt.targetId, allowed, err, tt.want)
+		}
+	}
+
+	// Reports scoped grants are not the manager's own permissions
+	if allowed, err := p.CheckPermission("mgr", "", "contact.update"); err != nil || allowed {
+		t.Errorf("CheckPermission(mgr) = %v %v, want denied", allowed, err)
+	}
+}
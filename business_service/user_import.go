@@ -0,0 +1,274 @@
+package business_service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Import formats
+const (
+	IMPORT_FORMAT_CSV   = "csv"
+	IMPORT_FORMAT_JSONL = "jsonl"
+)
+
+// Import options and result fields
+const (
+	FLD_IMPORT_DRY_RUN = "dry_run"
+	FLD_IMPORT_ROW     = "row"
+	FLD_IMPORT_STATUS  = "status"
+	FLD_IMPORT_ERROR   = "error"
+	FLD_IMPORT_TOTAL   = "total"
+	FLD_IMPORT_CREATED = "created"
+	FLD_IMPORT_FAILED  = "failed"
+	FLD_IMPORT_RESULTS = "results"
+)
+
+// Import row status values
+const (
+	IMPORT_STATUS_CREATED      = "created"
+	IMPORT_STATUS_WOULD_CREATE = "would_create"
+	IMPORT_STATUS_FAILED       = "failed"
+)
+
+// ImportUsers - Import business users from CSV (with header row) or JSON Lines.
+// Each row is linked to an existing AppUser by user_id or email_id. The options
+// usertype_id and role_id are used for the rows which do not carry their own.
+// With dry_run nothing is written and the result tells what would happen.
+func (p *userBaseService) ImportUsers(reader io.Reader, format string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("UserService::ImportUsers - Begin", format, opts)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	var rows []utils.Map
+	var err error
+
+	switch strings.ToLower(format) {
+	case IMPORT_FORMAT_CSV:
+		rows, err = readCsvRows(reader)
+	case IMPORT_FORMAT_JSONL:
+		rows, err = readJsonLinesRows(reader)
+	default:
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid format",
+			ErrorDetail: fmt.Sprintf("Format should be %s or %s", IMPORT_FORMAT_CSV, IMPORT_FORMAT_JSONL)}
+		return nil, err
+	}
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid import data", ErrorDetail: err.Error()}
+		return nil, err
+	}
+
+	dryRun, _ := utils.GetMemberDataBool(opts, FLD_IMPORT_DRY_RUN)
+	defUserTypeId, _ := utils.GetMemberDataStr(opts, business_common.FLD_USERTYPE_ID)
+	defRoleId, _ := utils.GetMemberDataStr(opts, business_common.FLD_ROLE_ID)
+
+	results := []utils.Map{}
+	seenUsers := map[string]bool{}
+	created, failed := 0, 0
+
+	for idx, row := range rows {
+		result := utils.Map{FLD_IMPORT_ROW: idx + 1}
+
+		userId, err := p.importUser(row, defUserTypeId, defRoleId, seenUsers, dryRun)
+		result[business_common.FLD_USER_ID] = userId
+		if err != nil {
+			result[FLD_IMPORT_STATUS] = IMPORT_STATUS_FAILED
+			result[FLD_IMPORT_ERROR] = err.Error()
+			failed++
+		} else if dryRun {
+			result[FLD_IMPORT_STATUS] = IMPORT_STATUS_WOULD_CREATE
+			created++
+		} else {
+			result[FLD_IMPORT_STATUS] = IMPORT_STATUS_CREATED
+			created++
+		}
+		results = append(results, result)
+	}
+
+	response := utils.Map{
+		FLD_IMPORT_DRY_RUN: dryRun,
+		FLD_IMPORT_TOTAL:   len(rows),
+		FLD_IMPORT_CREATED: created,
+		FLD_IMPORT_FAILED:  failed,
+		FLD_IMPORT_RESULTS: results,
+	}
+
+	log.Println("UserService::ImportUsers - End", len(rows), created, failed)
+	return response, nil
+}
+
+// importUser - Validate the row and create the business user with its role grant
+func (p *userBaseService) importUser(row utils.Map, defUserTypeId string, defRoleId string, seenUsers map[string]bool, dryRun bool) (string, error) {
+
+	// Link the row to an existing AppUser
+	userId, _ := utils.GetMemberDataStr(row, business_common.FLD_USER_ID)
+	if len(userId) > 0 {
+		if _, err := p.daoAppUser.Get(userId); err != nil {
+			return userId, fmt.Errorf("app user %s not found", userId)
+		}
+	} else if emailId, _ := utils.GetMemberDataStr(row, platform_common.FLD_APP_USER_EMAILID); len(emailId) > 0 {
+		dataAppUser, err := p.daoAppUser.Find(buildFilter(utils.Map{platform_common.FLD_APP_USER_EMAILID: emailId}))
+		if err != nil {
+			return "", fmt.Errorf("app user with email %s not found", emailId)
+		}
+		userId, _ = utils.GetMemberDataStr(dataAppUser, platform_common.FLD_APP_USER_ID)
+	} else {
+		return "", fmt.Errorf("%s or %s is required", business_common.FLD_USER_ID, platform_common.FLD_APP_USER_EMAILID)
+	}
+
+	if seenUsers[userId] {
+		return userId, fmt.Errorf("user %s is repeated in the import", userId)
+	}
+	seenUsers[userId] = true
+
+	if _, err := p.daoUser.Get(userId); err == nil {
+		return userId, fmt.Errorf("user %s already exists in the business", userId)
+	}
+
+	userTypeId, _ := utils.GetMemberDataStr(row, business_common.FLD_USERTYPE_ID)
+	if len(userTypeId) == 0 {
+		userTypeId = defUserTypeId
+	}
+	if len(userTypeId) > 0 {
+		if _, err := p.daoUserType.Get(userTypeId); err != nil {
+			return userId, fmt.Errorf("user type %s not found", userTypeId)
+		}
+	}
+
+	roleId, _ := utils.GetMemberDataStr(row, business_common.FLD_ROLE_ID)
+	if len(roleId) == 0 {
+		roleId = defRoleId
+	}
+	if len(roleId) > 0 {
+		if _, err := p.daoRole.GetDetails(roleId); err != nil {
+			return userId, fmt.Errorf("role %s not found", roleId)
+		}
+	}
+
+	siteId, _ := utils.GetMemberDataStr(row, business_common.FLD_APP_SITE_ID)
+	if len(siteId) > 0 {
+		if _, err := p.daoSite.Get(siteId); err != nil {
+			return userId, fmt.Errorf("site %s not found", siteId)
+		}
+	}
+
+	if dryRun {
+		return userId, nil
+	}
+
+	// The role and site go into the grant, not into the user
+	dataUser := utils.CopyMap(row)
+	delete(dataUser, platform_common.FLD_APP_USER_EMAILID)
+	delete(dataUser, business_common.FLD_ROLE_ID)
+	delete(dataUser, business_common.FLD_APP_SITE_ID)
+	dataUser[business_common.FLD_USER_ID] = userId
+	if len(userTypeId) > 0 {
+		dataUser[business_common.FLD_USERTYPE_ID] = userTypeId
+	}
+
+	var dataGrant utils.Map
+	if len(roleId) > 0 {
+		dataGrant = utils.Map{
+			business_common.FLD_USER_ID: userId,
+			business_common.FLD_ROLE_ID: roleId,
+		}
+		if len(siteId) > 0 {
+			dataGrant[business_common.FLD_APP_SITE_ID] = siteId
+		}
+	}
+
+	// A row is imported with its grant or not at all
+	p.dbRegion.BeginTransaction()
+
+	err := p.createImportedUser(dataUser, dataGrant)
+	if err != nil {
+		p.dbRegion.RollbackTransaction()
+		return userId, err
+	}
+
+	p.dbRegion.CommitTransaction()
+	return userId, nil
+}
+
+// createImportedUser - Create the business user and give the role grant through AccessService
+func (p *userBaseService) createImportedUser(dataUser utils.Map, dataGrant utils.Map) error {
+	_, err := p.createUser(dataUser)
+	if err != nil {
+		return err
+	}
+
+	if dataGrant != nil {
+		accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+		if _, err := accessService.GrantPermission(dataGrant); err != nil {
+			return fmt.Errorf("role grant failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// readCsvRows - Read the CSV rows, the first row holds the field names
+func readCsvRows(reader io.Reader) ([]utils.Map, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.TrimLeadingSpace = true
+
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []utils.Map{}, nil
+	}
+
+	header := records[0]
+	rows := []utils.Map{}
+	for _, record := range records[1:] {
+		row := utils.Map{}
+		for idx, value := range record {
+			value = strings.TrimSpace(value)
+			if idx < len(header) && len(value) > 0 {
+				row[strings.TrimSpace(header[idx])] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readJsonLinesRows - Read one JSON object per line, blank lines are ignored
+func readJsonLinesRows(reader io.Reader) ([]utils.Map, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	rows := []utils.Map{}
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		row := utils.Map{}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,100 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testUserService - UserService of a business with user1 and the AppUsers user1 to user3
+func testUserService() *userBaseService {
+	return &userBaseService{
+		daoUser: &fakeUserDao{users: map[string]utils.Map{
+			"user1": {business_common.FLD_USER_ID: "user1"},
+		}},
+		daoAppUser: &fakeAppUserDao{appUsers: map[string]utils.Map{
+			"user1": {platform_common.FLD_APP_USER_ID: "user1", platform_common.FLD_APP_USER_EMAILID: "one@example.com"},
+			"user2": {platform_common.FLD_APP_USER_ID: "user2", platform_common.FLD_APP_USER_EMAILID: "two@example.com"},
+			"user3": {platform_common.FLD_APP_USER_ID: "user3", platform_common.FLD_APP_USER_EMAILID: "three@example.com"},
+		}},
+		daoUserType: &fakeUserTypeDao{userTypes: map[string]utils.Map{"stftyp_1": {business_common.FLD_USERTYPE_ID: "stftyp_1"}}},
+		daoRole:     testRoles(),
+		daoSite:     &fakeSiteDao{sites: map[string]utils.Map{}},
+		daoBusiness: testBusiness("biz1", BUSINESS_STATUS_ACTIVE),
+		businessID:  "biz1",
+	}
+}
+
+func TestReadCsvRows(t *testing.T) {
+	rows, err := readCsvRows(strings.NewReader("user_id, role_id\nuser2, viewer\n\n user3 ,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []utils.Map{
+		{"user_id": "user2", "role_id": "viewer"},
+		{"user_id": "user3"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("readCsvRows = %v, want %v", rows, want)
+	}
+}
+
+func TestReadJsonLinesRows(t *testing.T) {
+	rows, err := readJsonLinesRows(strings.NewReader("{\"user_id\": \"user2\"}\n\n{\"email_id\": \"three@example.com\"}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["user_id"] != "user2" || rows[1]["email_id"] != "three@example.com" {
+		t.Errorf("readJsonLinesRows = %v, want the 2 rows", rows)
+	}
+
+	if _, err := readJsonLinesRows(strings.NewReader("{\"user_id\": \"user2\"}\nnot json\n")); err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("readJsonLinesRows = %v, want the error of line 2", err)
+	}
+}
+
+func TestImportUsersDryRun(t *testing.T) {
+	p := testUserService()
+	data := strings.Join([]string{
+		`{"user_id": "user2", "role_id": "viewer"}`,
+		`{"email_id": "three@example.com", "usertype_id": "stftyp_1"}`,
+		`{"user_id": "user1"}`,
+		`{"user_id": "user2"}`,
+		`{"user_id": "user9"}`,
+		`{"email_id": "three@example.com", "role_id": "missing"}`,
+		`{"first_name": "Nobody"}`,
+	}, "\n")
+
+	response, err := p.ImportUsers(strings.NewReader(data), IMPORT_FORMAT_JSONL, utils.Map{FLD_IMPORT_DRY_RUN: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := []string{}
+	for _, result := range response[FLD_IMPORT_RESULTS].([]utils.Map) {
+		statuses = append(statuses, result[FLD_IMPORT_STATUS].(string))
+	}
+	want := []string{IMPORT_STATUS_WOULD_CREATE, IMPORT_STATUS_WOULD_CREATE,
+		IMPORT_STATUS_FAILED, IMPORT_STATUS_FAILED, IMPORT_STATUS_FAILED, IMPORT_STATUS_FAILED, IMPORT_STATUS_FAILED}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if response[FLD_IMPORT_CREATED] != 2 || response[FLD_IMPORT_FAILED] != 5 {
+		t.Errorf("created %v and failed %v, want 2 and 5", response[FLD_IMPORT_CREATED], response[FLD_IMPORT_FAILED])
+	}
+	if users := p.daoUser.(*fakeUserDao).users; len(users) != 1 {
+		t.Errorf("dry run created users %v", users)
+	}
+}
+
+func TestImportUsersInvalidFormat(t *testing.T) {
+	var appErr *utils.AppError
+	if _, err := testUserService().ImportUsers(strings.NewReader(""), "xml", nil); !errors.As(err, &appErr) {
+		t.Errorf("ImportUsers = %v, want the invalid format error", err)
+	}
+}
@@ -0,0 +1,527 @@
+package business_service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-platform-repository/platform_repository"
+	"github.com/zapscloud/golib-platform-service/platform_service"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// User invite fields
+const (
+	FLD_INVITE_ID         = "invite_id"
+	FLD_INVITE_STATUS     = "invite_status"
+	FLD_INVITE_GRANTS     = "grants"
+	FLD_INVITE_NONCE      = "invite_nonce"
+	FLD_INVITE_EXPIRES_AT = "expires_at"
+	FLD_INVITE_TTL_HOURS  = "expires_in_hours"
+	FLD_INVITE_TOKEN      = "invite_token"
+	FLD_INVITE_SENT_AT    = "sent_at"
+	FLD_INVITE_ACCEPTED   = "accepted_at"
+
+	// Props field holding the secret used to sign the invite tokens
+	FLD_INVITE_SECRET = "invite_secret"
+)
+
+// User invite status values
+const (
+	INVITE_STATUS_PENDING   = "pending"
+	INVITE_STATUS_ACCEPTED  = "accepted"
+	INVITE_STATUS_CANCELLED = "cancelled"
+
+	// Default validity of an invite token
+	INVITE_DEFAULT_TTL_HOURS = 7 * 24
+)
+
+// UserInviteService - User Invitation Service structure
+type UserInviteService interface {
+	// List - List All invites
+	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	// Get - Get the invite
+	Get(inviteId string) (utils.Map, error)
+	// Create - Create an invite and issue its token
+	Create(indata utils.Map) (utils.Map, error)
+	// Accept - Accept the invite with its token for the given AppUser
+	Accept(token string, userId string) (utils.Map, error)
+	// Resend - Issue a new token for a pending invite, the previous token stops working
+	Resend(inviteId string) (utils.Map, error)
+	// Cancel - Cancel a pending invite
+	Cancel(inviteId string) error
+
+	BeginTransaction()
+	CommitTransaction()
+	RollbackTransaction()
+
+	EndService()
+}
+
+// userInviteBaseService - User Invitation Service structure
+type userInviteBaseService struct {
+	db_utils.DatabaseService
+	dbRegion       db_utils.DatabaseService
+	daoInvite      collectionDao
+	daoUser        business_repository.UserDao
+	daoUserType    business_repository.UserTypeDao
+	daoBusiness    platform_repository.BusinessDao
+	daoAppUser     platform_repository.AppUserDao
+	child          UserInviteService
+	businessID     string
+	businessStatus string
+	secret         string
+}
+
+func init() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags | log.Lmicroseconds)
+}
+
+func NewUserInviteService(props utils.Map) (UserInviteService, error) {
+	funcode := business_common.GetServiceModuleCode() + "M" + "01"
+	log.Printf("UserInviteService::Start ")
+
+	// Verify whether the business id data passed
+	businessId, err := utils.GetMemberDataStr(props, business_common.FLD_BUSINESS_ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify whether the secret to sign the tokens passed
+	secret, err := utils.GetMemberDataStr(props, FLD_INVITE_SECRET)
+	if err != nil {
+		return nil, err
+	}
+
+	p := userInviteBaseService{}
+	// Open Database Service
+	err = p.OpenDatabaseService(props)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open RegionDB Service
+	p.dbRegion, err = platform_service.OpenRegionDatabaseService(props)
+	if err != nil {
+		p.CloseDatabaseService()
+		return nil, err
+	}
+
+	// Assign the BusinessId
+	p.businessID = businessId
+	p.secret = secret
+	p.initializeService()
+
+	dataBusiness, err := p.daoBusiness.Get(businessId)
+	if err != nil {
+		err := &utils.AppError{
+			ErrorCode:   funcode + "01",
+			ErrorMsg:    "Invalid business_id",
+			ErrorDetail: "Given business_id is not exist"}
+		return p.errorReturn(err)
+	}
+
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
+	p.child = &p
+
+	return &p, err
+}
+
+// EndService - Close all the services
+func (p *userInviteBaseService) EndService() {
+	log.Printf("EndUserInviteService ")
+	p.CloseDatabaseService()
+	p.dbRegion.CloseDatabaseService()
+}
+
+func (p *userInviteBaseService) initializeService() {
+	log.Printf("UserInviteService:: initializeService ")
+	p.daoInvite = newUserInviteDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
+	p.daoAppUser = platform_repository.NewAppUserDao(p.GetClient())
+}
+
+func (p *userInviteBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "09"
+}
+
+// List - List All records
+func (p *userInviteBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+
+	log.Println("UserInviteService::FindAll - Begin")
+
+	response, err := p.daoInvite.List(filter, sort, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Never expose the token secrets
+	for _, dataInvite := range getListResult(response) {
+		delete(dataInvite, FLD_INVITE_NONCE)
+	}
+
+	log.Println("UserInviteService::FindAll - End ")
+	return response, nil
+}
+
+// Get - Find By Code
+func (p *userInviteBaseService) Get(inviteId string) (utils.Map, error) {
+	log.Printf("UserInviteService::Get::  Begin %v", inviteId)
+
+	data, err := p.daoInvite.Get(inviteId)
+	if err == nil {
+		delete(data, FLD_INVITE_NONCE)
+	}
+	log.Println("UserInviteService::Get:: End ", err)
+	return data, err
+}
+
+// Create - Create an invite and issue its token
+func (p *userInviteBaseService) Create(indata utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	log.Println("UserInviteService::Create - Begin")
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	emailId, err := utils.GetMemberDataStr(indata, platform_common.FLD_APP_USER_EMAILID)
+	if err != nil || len(emailId) == 0 {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Missing email", ErrorDetail: "Email id is required for the invite"}
+		return nil, err
+	}
+
+	if userTypeId, err := utils.GetMemberDataStr(indata, business_common.FLD_USERTYPE_ID); err == nil {
+		if _, err := p.daoUserType.Get(userTypeId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid usertype_id", ErrorDetail: "Given usertype_id is not exist"}
+			return nil, err
+		}
+	}
+
+	// Only one pending invite per email
+	filter := buildFilter(utils.Map{platform_common.FLD_APP_USER_EMAILID: emailId, FLD_INVITE_STATUS: INVITE_STATUS_PENDING})
+	if _, err := p.daoInvite.Find(filter); err == nil {
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Existing invite", ErrorDetail: "A pending invite already exist for the email"}
+		return nil, err
+	}
+
+	// Kept with the invite, so a resent token is valid as long as the first one
+	ttlHours := getInviteTtlHours(indata)
+	indata[FLD_INVITE_TTL_HOURS] = ttlHours
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	inviteId := utils.GenerateUniqueId("invt")
+	expiresAt := time.Now().Add(time.Duration(ttlHours) * time.Hour)
+
+	indata[FLD_INVITE_ID] = inviteId
+	indata[business_common.FLD_BUSINESS_ID] = p.businessID
+	indata[FLD_INVITE_STATUS] = INVITE_STATUS_PENDING
+	indata[FLD_INVITE_NONCE] = nonce
+	indata[FLD_INVITE_EXPIRES_AT] = formatDateTime(expiresAt)
+	indata[FLD_INVITE_SENT_AT] = formatDateTime(time.Now())
+	indata[FLD_INVITE_GRANTS] = getMemberDataMapArray(indata, FLD_INVITE_GRANTS)
+
+	data, err := p.daoInvite.Create(indata)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(data, FLD_INVITE_NONCE)
+	data[FLD_INVITE_TOKEN] = p.signToken(inviteId, nonce, expiresAt)
+
+	log.Println("UserInviteService::Create - End ", inviteId)
+	return data, nil
+}
+
+// Accept - Accept the invite with its token, creates the business user and applies the grants
+func (p *userInviteBaseService) Accept(token string, userId string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	log.Println("UserInviteService::Accept - Begin", userId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	inviteId, nonce, expiresAt, err := p.parseToken(token)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid token", ErrorDetail: err.Error()}
+		return nil, err
+	}
+
+	if time.Now().After(expiresAt) {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Token expired", ErrorDetail: "Invite token is expired"}
+		return nil, err
+	}
+
+	dataInvite, err := p.getPendingInvite(inviteId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Single use, a resent or accepted invite has a different nonce
+	if storedNonce, _ := utils.GetMemberDataStr(dataInvite, FLD_INVITE_NONCE); !hmac.Equal([]byte(storedNonce), []byte(nonce)) {
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid token", ErrorDetail: "Invite token is no longer valid"}
+		return nil, err
+	}
+
+	dataAppUser, err := p.daoAppUser.Get(userId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "04", ErrorMsg: "UserId not found ", ErrorDetail: "Given user_id is not exist"}
+		return nil, err
+	}
+
+	emailId, _ := utils.GetMemberDataStr(dataInvite, platform_common.FLD_APP_USER_EMAILID)
+	if userEmailId, _ := utils.GetMemberDataStr(dataAppUser, platform_common.FLD_APP_USER_EMAILID); !strings.EqualFold(userEmailId, emailId) {
+		err := &utils.AppError{ErrorCode: funcode + "05", ErrorMsg: "Email mismatch", ErrorDetail: "Invite was sent to a different email"}
+		return nil, err
+	}
+
+	if _, err := p.daoUser.Get(userId); err == nil {
+		err := &utils.AppError{ErrorCode: funcode + "06", ErrorMsg: "Existing user", ErrorDetail: "User already exist in the business"}
+		return nil, err
+	}
+
+	err = checkQuota(p.dbRegion.GetClient(), p.businessID, QUOTA_MAX_USERS, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// The user, the grants and the used invite are written together
+	p.dbRegion.BeginTransaction()
+
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+	dataUser, err := p.acceptInvite(accessService, dataInvite, userId)
+	if err != nil {
+		log.Println("UserInviteService::Accept - Rollback ", inviteId, err)
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
+
+	p.dbRegion.CommitTransaction()
+
+	log.Println("UserInviteService::Accept - End ", inviteId)
+	return dataUser, nil
+}
+
+func (p *userInviteBaseService) acceptInvite(accessService AccessService, dataInvite utils.Map, userId string) (utils.Map, error) {
+
+	inviteId, _ := utils.GetMemberDataStr(dataInvite, FLD_INVITE_ID)
+
+	dataUser := utils.Map{
+		business_common.FLD_USER_ID:     userId,
+		business_common.FLD_BUSINESS_ID: p.businessID,
+		FLD_USER_STATUS:                 USER_STATUS_ACTIVE,
+		FLD_INVITE_ID:                   inviteId,
+	}
+	if userTypeId, err := utils.GetMemberDataStr(dataInvite, business_common.FLD_USERTYPE_ID); err == nil {
+		dataUser[business_common.FLD_USERTYPE_ID] = userTypeId
+	}
+
+	dataUser, err := p.daoUser.Create(dataUser)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []utils.Map{}
+	for _, grant := range getMemberDataMapArray(dataInvite, FLD_INVITE_GRANTS) {
+		dataGrant := utils.CopyMap(grant)
+		dataGrant[business_common.FLD_USER_ID] = userId
+
+		dataGrant, err := accessService.GrantPermission(dataGrant)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, dataGrant)
+	}
+
+	// Apply the default grants of the user type
+	if userTypeId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USERTYPE_ID); len(userTypeId) > 0 {
+		_, err := syncUserTypeGrants(accessService, p.daoUserType, userId, userTypeId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = p.daoInvite.Update(inviteId, utils.Map{
+		FLD_INVITE_STATUS:           INVITE_STATUS_ACCEPTED,
+		FLD_INVITE_NONCE:            "",
+		FLD_INVITE_ACCEPTED:         formatDateTime(time.Now()),
+		business_common.FLD_USER_ID: userId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dataUser[FLD_INVITE_GRANTS] = grants
+	return dataUser, nil
+}
+
+// Resend - Issue a new token for a pending invite, the previous token stops working
+func (p *userInviteBaseService) Resend(inviteId string) (utils.Map, error) {
+
+	log.Println("UserInviteService::Resend - Begin", inviteId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataInvite, err := p.getPendingInvite(inviteId)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(time.Duration(getInviteTtlHours(dataInvite)) * time.Hour)
+
+	data, err := p.daoInvite.Update(inviteId, utils.Map{
+		FLD_INVITE_NONCE:      nonce,
+		FLD_INVITE_EXPIRES_AT: formatDateTime(expiresAt),
+		FLD_INVITE_SENT_AT:    formatDateTime(time.Now()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	delete(data, FLD_INVITE_NONCE)
+	data[FLD_INVITE_ID] = inviteId
+	data[FLD_INVITE_TOKEN] = p.signToken(inviteId, nonce, expiresAt)
+
+	log.Println("UserInviteService::Resend - End ", inviteId)
+	return data, nil
+}
+
+// Cancel - Cancel a pending invite
+func (p *userInviteBaseService) Cancel(inviteId string) error {
+
+	log.Println("UserInviteService::Cancel - Begin", inviteId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	_, err := p.getPendingInvite(inviteId)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.daoInvite.Update(inviteId, utils.Map{
+		FLD_INVITE_STATUS: INVITE_STATUS_CANCELLED,
+		FLD_INVITE_NONCE:  "",
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("UserInviteService::Cancel - End ", inviteId)
+	return nil
+}
+
+// getPendingInvite - Get the invite, only pending invites can be changed
+func (p *userInviteBaseService) getPendingInvite(inviteId string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	dataInvite, err := p.daoInvite.Get(inviteId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid invite_id", ErrorDetail: "Given invite_id is not exist"}
+		return nil, err
+	}
+
+	if status, _ := utils.GetMemberDataStr(dataInvite, FLD_INVITE_STATUS); status != INVITE_STATUS_PENDING {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invite not pending", ErrorDetail: "Invite is already " + status}
+		return nil, err
+	}
+
+	return dataInvite, nil
+}
+
+// getInviteTtlHours - Validity of the invite tokens in hours, the default when not given
+func getInviteTtlHours(dataInvite utils.Map) int {
+	ttlHours, err := utils.GetMemberDataInt(dataInvite, FLD_INVITE_TTL_HOURS, true)
+	if err != nil || ttlHours <= 0 {
+		return INVITE_DEFAULT_TTL_HOURS
+	}
+	return ttlHours
+}
+
+// generateNonce - Random nonce of a token from the system's secure random source
+func generateNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// signToken - Build the token "<payload>.<signature>" where payload holds invite id, nonce and expiry
+func (p *userInviteBaseService) signToken(inviteId string, nonce string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(inviteId + ":" + nonce + ":" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return payload + "." + p.signature(payload)
+}
+
+// parseToken - Verify the token signature and get its invite id, nonce and expiry
+func (p *userInviteBaseService) parseToken(token string) (string, string, time.Time, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(p.signature(payload))) {
+		return "", "", time.Time{}, fmt.Errorf("invite token signature is invalid")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("invite token is malformed")
+	}
+
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 3 {
+		return "", "", time.Time{}, fmt.Errorf("invite token is malformed")
+	}
+
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("invite token is malformed")
+	}
+
+	return parts[0], parts[1], time.Unix(expiry, 0), nil
+}
+
+func (p *userInviteBaseService) signature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write([]byte(p.businessID + ":" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *userInviteBaseService) errorReturn(err error) (UserInviteService, error) {
+	// Close the Database Connection
+	p.EndService()
+	return nil, err
+}
@@ -0,0 +1,138 @@
+package business_service
+
+import (
+	"log"
+	"time"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// User lifecycle fields
+const (
+	FLD_USER_STATUS       = "user_status"
+	FLD_STATUS_REASON     = "status_reason"
+	FLD_STATUS_CHANGED_AT = "status_changed_at"
+	FLD_STATUS_HISTORY    = "status_history"
+	FLD_STATUS_FROM       = "from_status"
+	FLD_STATUS_TO         = "to_status"
+)
+
+// User lifecycle states
+const (
+	USER_STATUS_INVITED     = "invited"
+	USER_STATUS_ACTIVE      = "active"
+	USER_STATUS_SUSPENDED   = "suspended"
+	USER_STATUS_DEACTIVATED = "deactivated"
+)
+
+// userStatusTransitions - Allowed target states for each state
+var userStatusTransitions = map[string][]string{
+	USER_STATUS_INVITED:     {USER_STATUS_ACTIVE, USER_STATUS_DEACTIVATED},
+	USER_STATUS_ACTIVE:      {USER_STATUS_SUSPENDED, USER_STATUS_DEACTIVATED},
+	USER_STATUS_SUSPENDED:   {USER_STATUS_ACTIVE, USER_STATUS_DEACTIVATED},
+	USER_STATUS_DEACTIVATED: {USER_STATUS_ACTIVE},
+}
+
+// getUserStatus - Get the lifecycle state of the user, users created before the lifecycle are active
+func getUserStatus(dataUser utils.Map) string {
+	status, _ := utils.GetMemberDataStr(dataUser, FLD_USER_STATUS)
+	if len(status) == 0 {
+		return USER_STATUS_ACTIVE
+	}
+	return status
+}
+
+// userStatusFilter - Restrict the given filter to the users in the given state
+func userStatusFilter(status string, filter string) string {
+	condition := utils.Map{FLD_USER_STATUS: status}
+	if status == USER_STATUS_ACTIVE {
+		condition = utils.Map{"$or": []utils.Map{{FLD_USER_STATUS: nil}, {FLD_USER_STATUS: status}}}
+	}
+	return combineFilters(buildFilter(condition), filter)
+}
+
+// Suspend - Temporarily lock the user, the configuration of the user is kept
+func (p *userBaseService) Suspend(userId string, reason string) (utils.Map, error) {
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	return p.changeUserStatus(userId, USER_STATUS_SUSPENDED, reason)
+}
+
+// Reactivate - Make a suspended or deactivated user active again
+func (p *userBaseService) Reactivate(userId string, reason string) (utils.Map, error) {
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	return p.changeUserStatus(userId, USER_STATUS_ACTIVE, reason)
+}
+
+// Deactivate - Deactivate the user
+func (p *userBaseService) Deactivate(userId string, reason string) (utils.Map, error) {
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	return p.changeUserStatus(userId, USER_STATUS_DEACTIVATED, reason)
+}
+
+// ListByStatus - List the users in the given lifecycle state
+func (p *userBaseService) ListByStatus(status string, filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return p.List(userStatusFilter(status, filter), sort, skip, limit)
+}
+
+// changeUserStatus - Move the user to the given state if the transition is allowed
+func (p *userBaseService) changeUserStatus(userId string, toStatus string, reason string) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	log.Println("UserService::changeUserStatus - Begin", userId, toStatus, reason)
+
+	dataUser, err := p.daoUser.Get(userId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "UserId not found ", ErrorDetail: "Given user_id is not exist"}
+		return nil, err
+	}
+
+	fromStatus := getUserStatus(dataUser)
+	allowed := false
+	for _, status := range userStatusTransitions[fromStatus] {
+		if status == toStatus {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid status change",
+			ErrorDetail: "User cannot change from " + fromStatus + " to " + toStatus}
+		return nil, err
+	}
+
+	changedAt := formatDateTime(time.Now())
+	history := getMemberDataMapArray(dataUser, FLD_STATUS_HISTORY)
+	history = append(history, utils.Map{
+		FLD_STATUS_FROM:       fromStatus,
+		FLD_STATUS_TO:         toStatus,
+		FLD_STATUS_REASON:     reason,
+		FLD_STATUS_CHANGED_AT: changedAt,
+	})
+
+	indata := utils.Map{
+		FLD_USER_STATUS:       toStatus,
+		FLD_STATUS_REASON:     reason,
+		FLD_STATUS_CHANGED_AT: changedAt,
+		FLD_STATUS_HISTORY:    history,
+	}
+
+	data, err := p.daoUser.Update(userId, indata)
+	if err != nil {
+		return nil, err
+	}
+
+	data[business_common.FLD_USER_ID] = userId
+	log.Println("UserService::changeUserStatus - End", fromStatus, toStatus)
+	return data, nil
+}
@@ -0,0 +1,99 @@
+package business_service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestChangeUserStatus(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{"", USER_STATUS_SUSPENDED, true},
+		{USER_STATUS_INVITED, USER_STATUS_ACTIVE, true},
+		{USER_STATUS_INVITED, USER_STATUS_SUSPENDED, false},
+		{USER_STATUS_ACTIVE, USER_STATUS_SUSPENDED, true},
+		{USER_STATUS_ACTIVE, USER_STATUS_ACTIVE, false},
+		{USER_STATUS_SUSPENDED, USER_STATUS_ACTIVE, true},
+		{USER_STATUS_DEACTIVATED, USER_STATUS_SUSPENDED, false},
+		{USER_STATUS_DEACTIVATED, USER_STATUS_ACTIVE, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			p := testUserService()
+			daoUser := p.daoUser.(*fakeUserDao)
+			daoUser.users["user1"][FLD_USER_STATUS] = tt.from
+
+			_, err := p.changeUserStatus("user1", tt.to, "test")
+			if !tt.allowed {
+				var appErr *utils.AppError
+				if !errors.As(err, &appErr) {
+					t.Errorf("changeUserStatus = %v, want the invalid status change error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dataUser := daoUser.users["user1"]
+			history := getMemberDataMapArray(dataUser, FLD_STATUS_HISTORY)
+			if dataUser[FLD_USER_STATUS] != tt.to || len(history) != 1 || history[0][FLD_STATUS_REASON] != "test" {
+				t.Errorf("user = %v, want %s with the change in its history", dataUser, tt.to)
+			}
+		})
+	}
+}
+
+func TestSuspendUnknownUser(t *testing.T) {
+	var appErr *utils.AppError
+	if _, err := testUserService().Suspend("user9", "test"); !errors.As(err, &appErr) {
+		t.Errorf("Suspend = %v, want the user not found error", err)
+	}
+}
+
+func TestUserStatusFilter(t *testing.T) {
+	tests := []struct {
+		status string
+		filter string
+		want   string
+	}{
+		{USER_STATUS_SUSPENDED, "", `{"user_status":"suspended"}`},
+		{USER_STATUS_ACTIVE, "", `{"$or":[{"user_status":null},{"user_status":"active"}]}`},
+		{USER_STATUS_SUSPENDED, `{"usertype_id":"stftyp_1"}`, `{"$and":[{"user_status":"suspended"},{"usertype_id":"stftyp_1"}]}`},
+	}
+	for _, tt := range tests {
+		if got := userStatusFilter(tt.status, tt.filter); got != tt.want {
+			t.Errorf("userStatusFilter(%s, %s) = %s, want %s", tt.status, tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestSuspendedUserHasNoPermissions(t *testing.T) {
+	daoUser := &fakeUserDao{users: map[string]utils.Map{
+		"user1": {business_common.FLD_USER_ID: "user1", FLD_USER_STATUS: USER_STATUS_SUSPENDED},
+	}}
+	p := &accessBaseService{
+		daoUser:    daoUser,
+		daoRole:    testRoles(),
+		daoGroup:   &fakeCollectionDao{},
+		daoAccess:  &fakeAccessDao{grants: []utils.Map{{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer"}}},
+		businessID: "biz1",
+	}
+
+	allowed, err := p.CheckPermission("user1", "", "contact.view")
+	if err != nil || allowed {
+		t.Errorf("CheckPermission of a suspended user = %v %v, want denied", allowed, err)
+	}
+
+	daoUser.users["user1"][FLD_USER_STATUS] = USER_STATUS_ACTIVE
+	allowed, err = p.CheckPermission("user1", "", "contact.view")
+	if err != nil || !allowed {
+		t.Errorf("CheckPermission of the reactivated user = %v %v, want allowed", allowed, err)
+	}
+}
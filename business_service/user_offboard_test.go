@@ -0,0 +1,50 @@
+package business_service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestUserReferencesDetach(t *testing.T) {
+	daoSite := &fakeSiteDao{sites: map[string]utils.Map{
+		"site_1": {business_common.FLD_APP_SITE_ID: "site_1", FLD_USER_IDS: []string{"user1", "user2"}},
+		"site_2": {business_common.FLD_APP_SITE_ID: "site_2", FLD_MANAGER_ID: "user1", FLD_USER_IDS: []string{"user1"}},
+		"site_3": {business_common.FLD_APP_SITE_ID: "site_3", FLD_MANAGER_ID: "user2", FLD_USER_IDS: []string{"user2"}},
+	}}
+	daoTerritory := &fakeTerritoryDao{territories: map[string]utils.Map{
+		"territory_1": {business_common.FLD_APP_TERRITORY_ID: "territory_1", FLD_MANAGER_ID: "user1"},
+		"territory_2": {business_common.FLD_APP_TERRITORY_ID: "territory_2", FLD_USER_IDS: []string{"user2"}},
+	}}
+	p := &userBaseService{daoSite: daoSite, daoTerritory: daoTerritory, businessID: "biz1"}
+
+	detached, err := resolveReferences(p.userReferences(), "user1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sites := referredIds(detached, REFERENCE_KIND_SITE)
+	sort.Strings(sites)
+	if want := []string{"site_1", "site_2"}; !reflect.DeepEqual(sites, want) {
+		t.Errorf("detached sites = %v, want %v", sites, want)
+	}
+	if territories := referredIds(detached, REFERENCE_KIND_TERRITORY); !reflect.DeepEqual(territories, []string{"territory_1"}) {
+		t.Errorf("detached territories = %v, want [territory_1]", territories)
+	}
+
+	if userIds := daoSite.sites["site_1"][FLD_USER_IDS]; !reflect.DeepEqual(userIds, []string{"user2"}) {
+		t.Errorf("site_1 users = %v, want [user2]", userIds)
+	}
+	if dataSite := daoSite.sites["site_2"]; dataSite[FLD_MANAGER_ID] != "" || len(getMemberDataStrArray(dataSite, FLD_USER_IDS)) > 0 {
+		t.Errorf("site_2 = %v, want no manager and no users", dataSite)
+	}
+	if dataSite := daoSite.sites["site_3"]; dataSite[FLD_MANAGER_ID] != "user2" {
+		t.Errorf("site_3 = %v, want it unchanged", dataSite)
+	}
+	if dataTerritory := daoTerritory.territories["territory_1"]; dataTerritory[FLD_MANAGER_ID] != "" {
+		t.Errorf("territory_1 = %v, want no manager", dataTerritory)
+	}
+}
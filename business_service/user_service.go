@@ -2,12 +2,14 @@ package business_service
 
 import (
 	"fmt"
+	"io"
 	"log"
 
 	"github.com/zapscloud/golib-business-repository/business_common"
 	"github.com/zapscloud/golib-business-repository/business_repository"
 	"github.com/zapscloud/golib-dbutils/db_common"
 	"github.com/zapscloud/golib-dbutils/db_utils"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
 	"github.com/zapscloud/golib-platform-repository/platform_repository"
 	"github.com/zapscloud/golib-platform-service/platform_service"
 	"github.com/zapscloud/golib-utils/utils"
@@ -16,12 +18,31 @@ import (
 // UserService - Users Service structure
 type UserService interface {
 	List(filter string, sort string, skip int64, limit int64) (utils.Map, error)
+	// ListWithOptions - List with skip_user_info to leave out the AppUser details when only the business users are needed
+	ListWithOptions(filter string, sort string, skip int64, limit int64, opts utils.Map) (utils.Map, error)
 	Get(userId string) (utils.Map, error)
 	Find(filter string) (utils.Map, error)
 	Create(dataUser utils.Map) (utils.Map, error)
 	Update(userId string, indata utils.Map) (utils.Map, error)
 	Delete(userId string, delete_permanent bool) error
 
+	OffboardUser(userId string, options utils.Map) (utils.Map, error)
+
+	// SyncDefaultGrants - Re-apply the default grants of the user's type
+	SyncDefaultGrants(userId string) (utils.Map, error)
+	ImportUsers(reader io.Reader, format string, opts utils.Map) (utils.Map, error)
+
+	// Lifecycle of the business user
+	Suspend(userId string, reason string) (utils.Map, error)
+	Reactivate(userId string, reason string) (utils.Map, error)
+	Deactivate(userId string, reason string) (utils.Map, error)
+	ListByStatus(status string, filter string, sort string, skip int64, limit int64) (utils.Map, error)
+
+	// Reporting lines of the business user
+	GetDirectReports(userId string) (utils.Map, error)
+	GetReportingTree(userId string) (utils.Map, error)
+	GetChainOfCommand(userId string) (utils.Map, error)
+
 	BeginTransaction()
 	CommitTransaction()
 	RollbackTransaction()
@@ -32,12 +53,19 @@ type UserService interface {
 // userBaseService - Users Service structure
 type userBaseService struct {
 	db_utils.DatabaseService
-	dbRegion    db_utils.DatabaseService
-	daoUser     business_repository.UserDao
-	daoBusiness platform_repository.BusinessDao
-	daoAppUser  platform_repository.AppUserDao
-	child       UserService
-	businessID  string
+	dbRegion       db_utils.DatabaseService
+	daoUser        business_repository.UserDao
+	daoAccess      business_repository.AccessDao
+	daoRole        business_repository.RoleDao
+	daoUserType    business_repository.UserTypeDao
+	daoSite        business_repository.SiteDao
+	daoTerritory   business_repository.TerritoryDao
+	daoGroup       collectionDao
+	daoBusiness    platform_repository.BusinessDao
+	daoAppUser     platform_repository.AppUserDao
+	child          UserService
+	businessID     string
+	businessStatus string
 }
 
 func init() {
@@ -72,7 +100,7 @@ func NewUserService(props utils.Map) (UserService, error) {
 	p.businessID = businessId
 	p.initializeService()
 
-	_, err = p.daoBusiness.Get(businessId)
+	dataBusiness, err := p.daoBusiness.Get(businessId)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -81,6 +109,12 @@ func NewUserService(props utils.Map) (UserService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, err
@@ -96,12 +130,27 @@ func (p *userBaseService) EndService() {
 func (p *userBaseService) initializeService() {
 	log.Printf("UserService:: initializeService ")
 	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoAccess = business_repository.NewAccessDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoRole = business_repository.NewRoleDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoTerritory = business_repository.NewTerritoryDao(p.dbRegion.GetClient(), p.businessID)
+	p.daoGroup = newGroupDao(p.dbRegion.GetClient(), p.businessID)
 	p.daoBusiness = platform_repository.NewBusinessDao(p.GetClient())
 	p.daoAppUser = platform_repository.NewAppUserDao(p.GetClient())
 }
 
+func (p *userBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "08"
+}
+
 // List - List All records
 func (p *userBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
+	return p.ListWithOptions(filter, sort, skip, limit, nil)
+}
+
+// ListWithOptions - List All records, with skip_user_info the AppUser details are not added
+func (p *userBaseService) ListWithOptions(filter string, sort string, skip int64, limit int64, opts utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::FindAll - Begin")
 
@@ -111,21 +160,9 @@ func (p *userBaseService) List(filter string, sort string, skip int64, limit int
 		return nil, err
 	}
 
-	// Enumerate User List
-	if dataVal, dataOk := response[db_common.LIST_RESULT]; dataOk {
-		for _, value := range dataVal.([]utils.Map) {
-			// Get UserId
-			userId, _ := utils.GetMemberDataStr(value, business_common.FLD_USER_ID)
-
-			// Get UserDetails
-			userInfo, err := p.daoAppUser.Get(userId)
-			if err == nil {
-				// Add UserInfo
-				value[business_common.FLD_USER_INFO] = userInfo
-			} else {
-				value[business_common.FLD_USER_INFO] = utils.Map{}
-			}
-		}
+	// Add UserInfo to all the users of the page at once
+	if skipUserInfo, _ := utils.GetMemberDataBool(opts, FLD_SKIP_USER_INFO); !skipUserInfo {
+		p.enrichUserInfo(getListResult(response))
 	}
 
 	log.Println("UserService::FindAll - End ")
@@ -138,13 +175,7 @@ func (p *userBaseService) Get(userId string) (utils.Map, error) {
 
 	data, err := p.daoUser.Get(userId)
 	if err == nil {
-		userInfo, err := p.daoAppUser.Get(userId)
-		if err == nil {
-			// Add UserInfo
-			data[business_common.FLD_USER_INFO] = userInfo
-		} else {
-			data[business_common.FLD_USER_INFO] = utils.Map{}
-		}
+		p.enrichUserInfo([]utils.Map{data})
 	}
 	log.Println("UserService::FindByCode:: End ", err)
 	return data, err
@@ -155,19 +186,48 @@ func (p *userBaseService) Find(filter string) (utils.Map, error) {
 
 	data, err := p.daoUser.Find(filter)
 	if err == nil {
-		// Get UserId
-		userId, _ := utils.GetMemberDataStr(data, business_common.FLD_USER_ID)
+		p.enrichUserInfo([]utils.Map{data})
+	}
+	log.Println("UserService::FindByCode:: End ", data, err)
+	return data, err
+}
+
+// enrichUserInfo - Add the AppUser details to the users, fetching all of them in one query
+func (p *userBaseService) enrichUserInfo(dataUsers []utils.Map) {
+	if len(dataUsers) == 0 {
+		return
+	}
 
-		userInfo, err := p.daoAppUser.Get(userId)
-		if err == nil {
-			// Add UserInfo
-			data[business_common.FLD_USER_INFO] = userInfo
+	userIds := []string{}
+	for _, dataUser := range dataUsers {
+		if userId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USER_ID); len(userId) > 0 {
+			userIds = append(userIds, userId)
+		}
+	}
+
+	userInfos := map[string]utils.Map{}
+	if len(userIds) > 0 {
+		filter := buildFilter(utils.Map{platform_common.FLD_APP_USER_ID: utils.Map{"$in": userIds}})
+		response, err := p.daoAppUser.List(filter, "", 0, 0)
+		if err != nil {
+			log.Println("enrichUserInfo: AppUser List Error ", err)
 		} else {
-			data[business_common.FLD_USER_INFO] = utils.Map{}
+			for _, userInfo := range getListResult(response) {
+				userId, _ := utils.GetMemberDataStr(userInfo, platform_common.FLD_APP_USER_ID)
+				userInfos[userId] = userInfo
+			}
+		}
+	}
+
+	for _, dataUser := range dataUsers {
+		userId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USER_ID)
+		if userInfo, found := userInfos[userId]; found {
+			// Add UserInfo, each user gets its own copy
+			dataUser[business_common.FLD_USER_INFO] = utils.CopyMap(userInfo)
+		} else {
+			dataUser[business_common.FLD_USER_INFO] = utils.Map{}
 		}
 	}
-	log.Println("UserService::FindByCode:: End ", data, err)
-	return data, err
 }
 
 // Create - Create Service
@@ -175,16 +235,68 @@ func (p *userBaseService) Create(datauser utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Insert - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	res, err := p.createUser(datauser)
+
+	log.Println("UserService::Insert - End ")
+	return res, err
+}
+
+// createUser - Validate and create the user with its default grants, the business is verified writable by the caller
+func (p *userBaseService) createUser(datauser utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "04"
+
 	// Assign BusinessId
 	datauser[business_common.FLD_BUSINESS_ID] = p.businessID
 
+	// New users are active unless they are still invited
+	switch status, _ := utils.GetMemberDataStr(datauser, FLD_USER_STATUS); status {
+	case "":
+		datauser[FLD_USER_STATUS] = USER_STATUS_ACTIVE
+	case USER_STATUS_ACTIVE, USER_STATUS_INVITED:
+	default:
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid user status", ErrorDetail: "New user can only be active or invited"}
+		return nil, err
+	}
+
+	err := checkQuota(p.dbRegion.GetClient(), p.businessID, QUOTA_MAX_USERS, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	userId, _ := utils.GetMemberDataStr(datauser, business_common.FLD_USER_ID)
+	err = p.validateManager(userId, datauser)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validateAttributes(utils.Map{}, datauser)
+	if err != nil {
+		return nil, err
+	}
+
 	res, err := p.daoUser.Create(datauser)
 	if err != nil {
 		log.Println("Business user create Error  ", err)
+		return nil, err
 	}
 	log.Println("Business user create  ", res)
 
-	log.Println("UserService::Insert - End ")
+	// Apply the default grants of the user type
+	if userTypeId, _ := utils.GetMemberDataStr(datauser, business_common.FLD_USERTYPE_ID); len(userTypeId) > 0 {
+		_, err := p.syncDefaultGrants(userId, userTypeId)
+		if err != nil {
+			// Undo the creation
+			log.Println("Business user default grants Error  ", err)
+			p.syncDefaultGrants(userId, "")
+			p.daoUser.Delete(userId)
+			return nil, err
+		}
+	}
 	return res, nil
 }
 
@@ -193,6 +305,18 @@ func (p *userBaseService) Update(userId string, indata utils.Map) (utils.Map, er
 
 	log.Println("UserService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	data, err := p.updateUser(userId, indata)
+
+	log.Println("UserService::Update - End ")
+	return data, err
+}
+
+// updateUser - Validate and update the user and re-sync its default grants, the business is verified writable by the caller
+func (p *userBaseService) updateUser(userId string, indata utils.Map) (utils.Map, error) {
 	data, err := p.daoUser.Get(userId)
 	if err != nil {
 		return data, err
@@ -202,9 +326,65 @@ func (p *userBaseService) Update(userId string, indata utils.Map) (utils.Map, er
 	delete(indata, business_common.FLD_BUSINESS_ID)
 	delete(indata, business_common.FLD_USER_ID)
 
+	// Lifecycle is changed only through Suspend, Reactivate and Deactivate
+	delete(indata, FLD_USER_STATUS)
+	delete(indata, FLD_STATUS_HISTORY)
+
+	err = p.validateManager(userId, indata)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.validateAttributes(data, indata)
+	if err != nil {
+		return nil, err
+	}
+
+	oldUserTypeId, _ := utils.GetMemberDataStr(data, business_common.FLD_USERTYPE_ID)
+
 	data, err = p.daoUser.Update(userId, indata)
-	log.Println("UserService::Update - End ")
-	return data, err
+	if err != nil {
+		return data, err
+	}
+
+	// Re-sync the default grants when the user type changed, a cleared type revokes them
+	if value, ok := indata[business_common.FLD_USERTYPE_ID]; ok {
+		if userTypeId, _ := value.(string); userTypeId != oldUserTypeId {
+			_, err := p.syncDefaultGrants(userId, userTypeId)
+			if err != nil {
+				return data, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// SyncDefaultGrants - Re-apply the default grants of the user's type, e.g. after the defaults of the type changed
+func (p *userBaseService) SyncDefaultGrants(userId string) (utils.Map, error) {
+
+	log.Println("UserService::SyncDefaultGrants - Begin", userId)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	dataUser, err := p.daoUser.Get(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	userTypeId, _ := utils.GetMemberDataStr(dataUser, business_common.FLD_USERTYPE_ID)
+	summary, err := p.syncDefaultGrants(userId, userTypeId)
+
+	log.Println("UserService::SyncDefaultGrants - End", err)
+	return summary, err
+}
+
+// syncDefaultGrants - Sync the auto-grants of the user with the defaults of the user type through AccessService,
+// which works on the databases of this service so it is part of any transaction in progress
+func (p *userBaseService) syncDefaultGrants(userId string, userTypeId string) (utils.Map, error) {
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+	return syncUserTypeGrants(accessService, p.daoUserType, userId, userTypeId)
 }
 
 // Delete - Delete Service
@@ -212,6 +392,18 @@ func (p *userBaseService) Delete(userId string, deletePermanent bool) error {
 
 	log.Println("UserService::Delete - Begin", userId)
 
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	err := p.deleteUser(userId, deletePermanent)
+
+	log.Println("UserService::Delete - End", err)
+	return err
+}
+
+// deleteUser - Delete the user, the business is verified writable by the caller
+func (p *userBaseService) deleteUser(userId string, deletePermanent bool) error {
 	if deletePermanent {
 		result, err := p.daoUser.Delete(userId)
 		if err != nil {
@@ -221,14 +413,181 @@ func (p *userBaseService) Delete(userId string, deletePermanent bool) error {
 	} else {
 		indata := utils.Map{db_common.FLD_IS_DELETED: true}
 
-		data, err := p.Update(userId, indata)
+		data, err := p.updateUser(userId, indata)
 		if err != nil {
 			return err
 		}
 		log.Println("Update for Delete Flag", data)
 	}
+	return nil
+}
+
+// OffboardUser - Revoke all grants of the user, detach the user from sites, territories and groups,
+// remove the user from the business and delete the business user
+func (p *userBaseService) OffboardUser(userId string, options utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	log.Println("UserService::OffboardUser - Begin", userId, options)
+
+	if err := verifyBusinessWritable(p.daoBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.daoUser.Get(userId); err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "UserId not found ", ErrorDetail: "Given user_id is not exist"}
+		return nil, err
+	}
+
+	deletePermanent, _ := utils.GetMemberDataBool(options, FLD_DELETE_PERMANENT)
+
+	p.dbRegion.BeginTransaction()
+	p.BeginTransaction()
+
+	summary, err := p.offboardUser(userId, deletePermanent)
+	if err != nil {
+		log.Println("OffboardUser: Rollback ", userId, err)
+		p.dbRegion.RollbackTransaction()
+		p.RollbackTransaction()
+		return nil, err
+	}
 
-	log.Printf("UserService::Delete - End")
+	p.dbRegion.CommitTransaction()
+	p.CommitTransaction()
+
+	log.Println("UserService::OffboardUser - End", summary)
+	return summary, nil
+}
+
+func (p *userBaseService) offboardUser(userId string, deletePermanent bool) (utils.Map, error) {
+
+	// Revoke all the grants, including the expired ones
+	filter := buildFilter(utils.Map{business_common.FLD_USER_ID: userId})
+	response, err := p.daoAccess.List("", filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+
+	revokedGrants := []string{}
+	for _, dataGrant := range getListResult(response) {
+		accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+		err := accessService.RevokePermission(accessId)
+		if err != nil {
+			return nil, err
+		}
+		revokedGrants = append(revokedGrants, accessId)
+	}
+
+	// Detach from Sites and Territories
+	detached, err := resolveReferences(p.userReferences(), userId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove from Groups
+	filter = buildFilter(utils.Map{FLD_GROUP_MEMBER_IDS: userId})
+	response, err = p.daoGroup.List(filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	detachedGroups := []string{}
+	for _, dataGroup := range getListResult(response) {
+		groupId, _ := utils.GetMemberDataStr(dataGroup, FLD_GROUP_ID)
+		memberIds := removeString(getMemberDataStrArray(dataGroup, FLD_GROUP_MEMBER_IDS), userId)
+		_, err := p.daoGroup.Update(groupId, utils.Map{FLD_GROUP_MEMBER_IDS: memberIds})
+		if err != nil {
+			return nil, err
+		}
+		detachedGroups = append(detachedGroups, groupId)
+	}
+
+	// Remove the user from the platform business
+	removedFromBusiness := false
+	accessId := utils.GetMD5Hash(p.businessID + "_" + userId)
+	if _, err := p.daoBusiness.GetAccessDetails(accessId); err == nil {
+		_, err := p.daoBusiness.RemoveUser(accessId)
+		if err != nil {
+			return nil, err
+		}
+		removedFromBusiness = true
+	}
+
+	// Delete the business user
+	err = p.deleteUser(userId, deletePermanent)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := utils.Map{
+		business_common.FLD_USER_ID: userId,
+		FLD_DELETE_PERMANENT:        deletePermanent,
+		FLD_REVOKED_GRANTS:          revokedGrants,
+		FLD_DETACHED_SITES:          referredIds(detached, REFERENCE_KIND_SITE),
+		FLD_DETACHED_TERRITORIES:    referredIds(detached, REFERENCE_KIND_TERRITORY),
+		FLD_DETACHED_GROUPS:         detachedGroups,
+		FLD_REMOVED_FROM_BUSINESS:   removedFromBusiness,
+	}
+	return summary, nil
+}
+
+// userReferences - Sites and territories the user is assigned to or manages
+func (p *userBaseService) userReferences() []reference {
+	return []reference{
+		siteReference(p.daoSite, FLD_USER_IDS, true),
+		siteReference(p.daoSite, FLD_MANAGER_ID, false),
+		territoryReference(p.daoTerritory, FLD_USER_IDS, true),
+		territoryReference(p.daoTerritory, FLD_MANAGER_ID, false),
+	}
+}
+
+// validateAttributes - Validate the attributes against the schema of the user type and fill in the defaults.
+// On update the attributes are checked when they or the user type change, given attributes replace the stored ones.
+func (p *userBaseService) validateAttributes(dataUser utils.Map, indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "06"
+
+	_, okAttributes := indata[FLD_ATTRIBUTES]
+	_, okUserType := indata[business_common.FLD_USERTYPE_ID]
+	if len(dataUser) > 0 && !okAttributes && !okUserType {
+		return nil
+	}
+
+	userTypeId, err := utils.GetMemberDataStr(indata, business_common.FLD_USERTYPE_ID)
+	if err != nil {
+		userTypeId, _ = utils.GetMemberDataStr(dataUser, business_common.FLD_USERTYPE_ID)
+	}
+	if len(userTypeId) == 0 {
+		return nil
+	}
+
+	dataUserType, err := p.daoUserType.Get(userTypeId)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid usertype_id", ErrorDetail: "Given usertype_id is not exist"}
+		return err
+	}
+
+	attributes, ok := getMemberDataMap(indata, FLD_ATTRIBUTES)
+	if !ok && okAttributes && indata[FLD_ATTRIBUTES] != nil {
+		err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid attributes", ErrorDetail: "Attributes should be an object"}
+		return err
+	} else if !ok && !okAttributes {
+		attributes, ok = getMemberDataMap(dataUser, FLD_ATTRIBUTES)
+	}
+	if !ok {
+		attributes = utils.Map{}
+	}
+
+	attributes, err = applyAttributeSchema(getMemberDataMapArray(dataUserType, FLD_ATTRIBUTE_SCHEMA), attributes)
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "Invalid attributes", ErrorDetail: err.Error()}
+		return err
+	}
+	if len(attributes) > 0 || okAttributes {
+		indata[FLD_ATTRIBUTES] = attributes
+	}
 	return nil
 }
 
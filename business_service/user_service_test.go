@@ -0,0 +1,66 @@
+package business_service
+
+import (
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-platform-repository/platform_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+func TestListEnrichesUserInfoInOneQuery(t *testing.T) {
+	p := testUserService()
+	daoUser := p.daoUser.(*fakeUserDao)
+	daoUser.users["user2"] = utils.Map{business_common.FLD_USER_ID: "user2"}
+	daoUser.users["user9"] = utils.Map{business_common.FLD_USER_ID: "user9"}
+	daoAppUser := p.daoAppUser.(*fakeAppUserDao)
+
+	response, err := p.List("", "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daoAppUser.lists != 1 {
+		t.Errorf("AppUsers listed %d times, want once for the page", daoAppUser.lists)
+	}
+	for _, dataUser := range getListResult(response) {
+		userInfo, _ := getMemberDataMap(dataUser, business_common.FLD_USER_INFO)
+		userId := dataUser[business_common.FLD_USER_ID]
+		if userId == "user9" {
+			if len(userInfo) > 0 {
+				t.Errorf("user9 has user info %v without an AppUser", userInfo)
+			}
+		} else if userInfo[platform_common.FLD_APP_USER_ID] != userId {
+			t.Errorf("user %v has user info %v", userId, userInfo)
+		}
+	}
+}
+
+func TestListWithOptionsSkipUserInfo(t *testing.T) {
+	p := testUserService()
+	daoAppUser := p.daoAppUser.(*fakeAppUserDao)
+
+	response, err := p.ListWithOptions("", "", 0, 0, utils.Map{FLD_SKIP_USER_INFO: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daoAppUser.lists != 0 {
+		t.Errorf("AppUsers listed %d times, want none", daoAppUser.lists)
+	}
+	for _, dataUser := range getListResult(response) {
+		if _, ok := dataUser[business_common.FLD_USER_INFO]; ok {
+			t.Errorf("user %v enriched with skip_user_info", dataUser)
+		}
+	}
+}
+
+func TestEnrichUserInfoCopies(t *testing.T) {
+	p := testUserService()
+	dataUsers := []utils.Map{{business_common.FLD_USER_ID: "user1"}, {business_common.FLD_USER_ID: "user1"}}
+
+	p.enrichUserInfo(dataUsers)
+	userInfo, _ := getMemberDataMap(dataUsers[0], business_common.FLD_USER_INFO)
+	userInfo["changed"] = true
+	if other, _ := getMemberDataMap(dataUsers[1], business_common.FLD_USER_INFO); other["changed"] == true {
+		t.Error("users share their user info")
+	}
+}
@@ -21,6 +21,7 @@ type UserTypeService interface {
 	Create(indata utils.Map) (utils.Map, error)
 	Update(userTypeId string, indata utils.Map) (utils.Map, error)
 	Delete(userTypeId string, delete_permanent bool) error
+	DeleteWithOptions(userTypeId string, opts utils.Map) (utils.Map, error)
 
 	BeginTransaction()
 	CommitTransaction()
@@ -34,9 +35,13 @@ type userTypeBaseService struct {
 	db_utils.DatabaseService
 	dbRegion            db_utils.DatabaseService
 	daoUserType         business_repository.UserTypeDao
+	daoRole             business_repository.RoleDao
+	daoSite             business_repository.SiteDao
+	daoUser             business_repository.UserDao
 	daoPlatformBusiness platform_repository.BusinessDao
 	child               UserTypeService
 	businessID          string
+	businessStatus      string
 }
 
 func init() {
@@ -74,9 +79,12 @@ func NewUserTypeService(props utils.Map) (UserTypeService, error) {
 
 	// Instantiate other services
 	p.daoUserType = business_repository.NewUserTypeDao(p.dbRegion.GetClient(), businessId)
+	p.daoRole = business_repository.NewRoleDao(p.dbRegion.GetClient(), businessId)
+	p.daoSite = business_repository.NewSiteDao(p.dbRegion.GetClient(), businessId)
+	p.daoUser = business_repository.NewUserDao(p.dbRegion.GetClient(), businessId)
 	p.daoPlatformBusiness = platform_repository.NewBusinessDao(p.GetClient())
 
-	_, err = p.daoPlatformBusiness.Get(p.businessID)
+	dataBusiness, err := p.daoPlatformBusiness.Get(p.businessID)
 	if err != nil {
 		err := &utils.AppError{
 			ErrorCode:   funcode + "01",
@@ -85,6 +93,12 @@ func NewUserTypeService(props utils.Map) (UserTypeService, error) {
 		return p.errorReturn(err)
 	}
 
+	p.businessStatus = getBusinessStatus(dataBusiness)
+	err = verifyBusinessActive(businessId, p.businessStatus)
+	if err != nil {
+		return p.errorReturn(err)
+	}
+
 	p.child = &p
 
 	return &p, nil
@@ -95,6 +109,10 @@ func (p *userTypeBaseService) EndService() {
 	p.dbRegion.CloseDatabaseService()
 }
 
+func (p *userTypeBaseService) getServiceModuleCode() string {
+	return business_common.GetServiceModuleCode() + "11"
+}
+
 // List - List All records
 func (p *userTypeBaseService) List(filter string, sort string, skip int64, limit int64) (utils.Map, error) {
 
@@ -131,6 +149,10 @@ func (p *userTypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 
 	log.Println("UserService::Create - Begin")
 
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
 	dataval, dataok := indata[business_common.FLD_USERTYPE_ID]
 	if !dataok {
 		uid := utils.GenerateUniqueId("stftyp")
@@ -147,6 +169,16 @@ func (p *userTypeBaseService) Create(indata utils.Map) (utils.Map, error) {
 		return indata, err
 	}
 
+	err = p.validateAttributeSchema(indata)
+	if err != nil {
+		return indata, err
+	}
+
+	err = p.validateDefaultGrants(indata)
+	if err != nil {
+		return indata, err
+	}
+
 	insertResult, err := p.daoUserType.Create(indata)
 	if err != nil {
 		return indata, err
@@ -160,14 +192,33 @@ func (p *userTypeBaseService) Update(userTypeId string, indata utils.Map) (utils
 
 	log.Println("AccountService::Update - Begin")
 
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	data, err := p.updateUserType(userTypeId, indata)
+	log.Println("AccountService::Update - End ")
+	return data, err
+}
+
+// updateUserType - Validate and update the user type, the business is verified writable by the caller
+func (p *userTypeBaseService) updateUserType(userTypeId string, indata utils.Map) (utils.Map, error) {
 	data, err := p.daoUserType.Get(userTypeId)
 	if err != nil {
 		return data, err
 	}
 
-	data, err = p.daoUserType.Update(userTypeId, indata)
-	log.Println("AccountService::Update - End ")
-	return data, err
+	err = p.validateAttributeSchema(indata)
+	if err != nil {
+		return indata, err
+	}
+
+	err = p.validateDefaultGrants(indata)
+	if err != nil {
+		return indata, err
+	}
+
+	return p.daoUserType.Update(userTypeId, indata)
 }
 
 // Delete - Delete Service
@@ -175,6 +226,26 @@ func (p *userTypeBaseService) Delete(userTypeId string, delete_permanent bool) e
 
 	log.Println("AccountService::Delete - Begin", userTypeId)
 
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return err
+	}
+
+	err := p.deleteUserType(userTypeId, delete_permanent)
+
+	log.Println("UserTypeService::Delete - End", err)
+	return err
+}
+
+// deleteUserType - Delete the user type unless it is still referred, the business is verified writable by the caller
+func (p *userTypeBaseService) deleteUserType(userTypeId string, delete_permanent bool) error {
+
+	funcode := p.getServiceModuleCode() + "03"
+
+	err := verifyNoReferences(funcode+"01", "User type", p.references(nil), userTypeId)
+	if err != nil {
+		return err
+	}
+
 	daoUserType := p.daoUserType
 	if delete_permanent {
 		result, err := daoUserType.Delete(userTypeId)
@@ -184,14 +255,132 @@ func (p *userTypeBaseService) Delete(userTypeId string, delete_permanent bool) e
 		log.Printf("Delete %v", result)
 	} else {
 		indata := utils.Map{db_common.FLD_IS_DELETED: true}
-		data, err := p.Update(userTypeId, indata)
+		data, err := p.updateUserType(userTypeId, indata)
 		if err != nil {
 			return err
 		}
 		log.Println("Update for Delete Flag", data)
 	}
+	return nil
+}
+
+// DeleteWithOptions - Delete the user type after moving its users to the type given in reassign_to,
+// or after clearing the type of its users with cascade. The default grants of the users are re-synced.
+func (p *userTypeBaseService) DeleteWithOptions(userTypeId string, opts utils.Map) (utils.Map, error) {
+
+	funcode := p.getServiceModuleCode() + "04"
+
+	log.Println("UserTypeService::DeleteWithOptions - Begin", userTypeId, opts)
+
+	if err := verifyBusinessWritable(p.daoPlatformBusiness, p.businessID); err != nil {
+		return nil, err
+	}
+
+	toId, cascade, err := getDeleteOptions(funcode, userTypeId, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toId) > 0 {
+		if _, err := p.daoUserType.Get(toId); err != nil {
+			err := &utils.AppError{ErrorCode: funcode + "03", ErrorMsg: "Invalid reassign_to", ErrorDetail: "Given reassign_to user type is not exist"}
+			return nil, err
+		}
+	}
+
+	deletePermanent, _ := utils.GetMemberDataBool(opts, FLD_DELETE_PERMANENT)
+	accessService := newSharedAccessService(p.DatabaseService, p.dbRegion, p.businessID, p.businessStatus)
+
+	// Move or clear the references, re-sync the grants and delete the user type all at once
+	p.dbRegion.BeginTransaction()
+
+	summary, err := handleReferences(p.references(accessService), userTypeId, toId, cascade)
+	if err == nil {
+		err = p.deleteUserType(userTypeId, deletePermanent)
+	}
+	if err != nil {
+		log.Println("DeleteWithOptions: Rollback ", userTypeId, err)
+		p.dbRegion.RollbackTransaction()
+		return nil, err
+	}
 
-	log.Printf("UserTypeService::Delete - End")
+	p.dbRegion.CommitTransaction()
+	summary[business_common.FLD_USERTYPE_ID] = userTypeId
+
+	log.Println("UserTypeService::DeleteWithOptions - End", summary)
+	return summary, nil
+}
+
+// references - Records which may refer to a user type, the accessService is needed only to change them
+func (p *userTypeBaseService) references(accessService AccessService) []reference {
+	return []reference{
+		{
+			kind:    REFERENCE_KIND_USER,
+			field:   business_common.FLD_USERTYPE_ID,
+			idField: business_common.FLD_USER_ID,
+			list: func(filter string) (utils.Map, error) {
+				return p.daoUser.List(filter, "", 0, 0)
+			},
+			update: func(dataRef utils.Map, changes utils.Map) error {
+				userId, _ := utils.GetMemberDataStr(dataRef, business_common.FLD_USER_ID)
+				_, err := p.daoUser.Update(userId, changes)
+				if err != nil {
+					return err
+				}
+				userTypeId, _ := utils.GetMemberDataStr(changes, business_common.FLD_USERTYPE_ID)
+				_, err = syncUserTypeGrants(accessService, p.daoUserType, userId, userTypeId)
+				return err
+			},
+		},
+	}
+}
+
+// validateAttributeSchema - Verify the attribute schema if given and store it in normalised form.
+// Existing users are validated against the new schema only when they are next created or updated.
+func (p *userTypeBaseService) validateAttributeSchema(indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "01"
+
+	if _, ok := indata[FLD_ATTRIBUTE_SCHEMA]; !ok {
+		return nil
+	}
+
+	schema, err := normaliseAttributeSchema(getMemberDataMapArray(indata, FLD_ATTRIBUTE_SCHEMA))
+	if err != nil {
+		err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "Invalid attribute schema", ErrorDetail: err.Error()}
+		return err
+	}
+	indata[FLD_ATTRIBUTE_SCHEMA] = schema
+	return nil
+}
+
+// validateDefaultGrants - Verify the default roles and sites given for the users of the type.
+// Users pick up changed defaults with UserService.SyncDefaultGrants.
+func (p *userTypeBaseService) validateDefaultGrants(indata utils.Map) error {
+
+	funcode := p.getServiceModuleCode() + "02"
+
+	if _, ok := indata[FLD_DEFAULT_ROLE_IDS]; ok {
+		roleIds := getMemberDataStrArray(indata, FLD_DEFAULT_ROLE_IDS)
+		for _, roleId := range roleIds {
+			if _, err := p.daoRole.GetDetails(roleId); err != nil {
+				err := &utils.AppError{ErrorCode: funcode + "01", ErrorMsg: "RoleId not found ", ErrorDetail: "Default role " + roleId + " is not exist"}
+				return err
+			}
+		}
+		indata[FLD_DEFAULT_ROLE_IDS] = roleIds
+	}
+
+	if _, ok := indata[FLD_DEFAULT_SITE_IDS]; ok {
+		siteIds := getMemberDataStrArray(indata, FLD_DEFAULT_SITE_IDS)
+		for _, siteId := range siteIds {
+			if _, err := p.daoSite.Get(siteId); err != nil {
+				err := &utils.AppError{ErrorCode: funcode + "02", ErrorMsg: "SiteId not found ", ErrorDetail: "Default site " + siteId + " is not exist"}
+				return err
+			}
+		}
+		indata[FLD_DEFAULT_SITE_IDS] = siteIds
+	}
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package business_service
+
+import (
+	"log"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-business-repository/business_repository"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// Default grants of a user type
+const (
+	FLD_DEFAULT_ROLE_IDS = "default_role_ids"
+	FLD_DEFAULT_SITE_IDS = "default_site_ids"
+
+	// Grant field telling where the grant came from
+	FLD_GRANT_SOURCE = "grant_source"
+	FLD_GRANTED      = "granted"
+	FLD_REVOKED      = "revoked"
+)
+
+// Grant sources
+const (
+	// Granted through AccessService.GrantPermission
+	GRANT_SOURCE_MANUAL = ""
+	// Granted automatically from the defaults of the user's type
+	GRANT_SOURCE_USERTYPE = "usertype"
+)
+
+// syncUserTypeGrants - Apply the default grants of the user type to the user and revoke the
+// auto-grants which no longer apply. With empty userTypeId all the auto-grants are revoked.
+// Manual grants of the user are never touched.
+func syncUserTypeGrants(accessService AccessService, daoUserType business_repository.UserTypeDao, userId string, userTypeId string) (utils.Map, error) {
+
+	log.Println("syncUserTypeGrants - Begin", userId, userTypeId)
+
+	// The wanted grants keyed by access id
+	wanted := map[string]utils.Map{}
+	if len(userTypeId) > 0 {
+		dataUserType, err := daoUserType.Get(userTypeId)
+		if err != nil {
+			return nil, err
+		}
+
+		siteIds := getMemberDataStrArray(dataUserType, FLD_DEFAULT_SITE_IDS)
+		if len(siteIds) == 0 {
+			// Business-wide grant
+			siteIds = []string{""}
+		}
+		for _, roleId := range getMemberDataStrArray(dataUserType, FLD_DEFAULT_ROLE_IDS) {
+			for _, siteId := range siteIds {
+				dataGrant := utils.Map{
+					business_common.FLD_USER_ID:     userId,
+					business_common.FLD_ROLE_ID:     roleId,
+					business_common.FLD_USERTYPE_ID: userTypeId,
+					FLD_GRANT_SOURCE:                GRANT_SOURCE_USERTYPE,
+				}
+				if len(siteId) > 0 {
+					dataGrant[business_common.FLD_APP_SITE_ID] = siteId
+				}
+				wanted[generateAutoAccessId(userId, siteId, roleId)] = dataGrant
+			}
+		}
+	}
+
+	filter := buildFilter(utils.Map{business_common.FLD_USER_ID: userId, FLD_GRANT_SOURCE: GRANT_SOURCE_USERTYPE})
+	response, err := accessService.List("", filter, "", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked := []string{}
+	for _, dataGrant := range getListResult(response) {
+		accessId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_APP_ACCESS_ID)
+		grantUserTypeId, _ := utils.GetMemberDataStr(dataGrant, business_common.FLD_USERTYPE_ID)
+		if _, ok := wanted[accessId]; ok && grantUserTypeId == userTypeId {
+			// Already granted
+			delete(wanted, accessId)
+			continue
+		}
+
+		err := accessService.RevokePermission(accessId)
+		if err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, accessId)
+	}
+
+	granted := []string{}
+	for _, accessId := range sortedKeys(mapKeySet(wanted)) {
+		_, err := accessService.GrantPermission(wanted[accessId])
+		if err != nil {
+			return nil, err
+		}
+		granted = append(granted, accessId)
+	}
+
+	summary := utils.Map{
+		business_common.FLD_USER_ID:     userId,
+		business_common.FLD_USERTYPE_ID: userTypeId,
+		FLD_GRANTED:                     granted,
+		FLD_REVOKED:                     revoked,
+	}
+
+	log.Println("syncUserTypeGrants - End", summary)
+	return summary, nil
+}
+
+// generateAutoAccessId - Generate the access id of an auto-grant, keyed by the role as well,
+// so that the defaults never replace a manual grant or each other
+func generateAutoAccessId(userId string, siteId string, roleId string) string {
+	return generateAccessId(userId, siteId, GRANT_SOURCE_USERTYPE+PERMISSION_SEPARATOR+roleId)
+}
+
+// mapKeySet - Get the keys of the map as a set
+func mapKeySet(data map[string]utils.Map) map[string]bool {
+	keys := map[string]bool{}
+	for key := range data {
+		keys[key] = true
+	}
+	return keys
+}
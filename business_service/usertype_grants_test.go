@@ -0,0 +1,131 @@
+package business_service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zapscloud/golib-business-repository/business_common"
+	"github.com/zapscloud/golib-utils/utils"
+)
+
+// testUserTypeGrants - Access service of user1 with a manual editor grant, and the user types
+// stftyp_1 giving viewer and editor business-wide and stftyp_2 giving viewer on site_1
+func testUserTypeGrants() (*accessBaseService, *fakeUserTypeDao) {
+	p := &accessBaseService{
+		daoUser: &fakeUserDao{users: map[string]utils.Map{"user1": {business_common.FLD_USER_ID: "user1"}}},
+		daoSite: &fakeSiteDao{sites: map[string]utils.Map{"site_1": {business_common.FLD_APP_SITE_ID: "site_1"}}},
+		daoRole: testRoles(),
+		daoAccess: &fakeAccessDao{filtered: true, grants: []utils.Map{{
+			business_common.FLD_APP_ACCESS_ID: generateAccessId("user1", "", GRANT_SCOPE_SELF),
+			business_common.FLD_USER_ID:       "user1",
+			business_common.FLD_ROLE_ID:       "editor",
+		}}},
+		businessID: "biz1",
+		shared:     true,
+	}
+	daoUserType := &fakeUserTypeDao{userTypes: map[string]utils.Map{
+		"stftyp_1": {business_common.FLD_USERTYPE_ID: "stftyp_1", FLD_DEFAULT_ROLE_IDS: []string{"viewer", "editor"}},
+		"stftyp_2": {business_common.FLD_USERTYPE_ID: "stftyp_2", FLD_DEFAULT_ROLE_IDS: []string{"viewer"},
+			FLD_DEFAULT_SITE_IDS: []string{"site_1"}},
+	}}
+	return p, daoUserType
+}
+
+func TestSyncUserTypeGrants(t *testing.T) {
+	p, daoUserType := testUserTypeGrants()
+	daoAccess := p.daoAccess.(*fakeAccessDao)
+	manualId := generateAccessId("user1", "", GRANT_SCOPE_SELF)
+	typeOneIds := []string{generateAutoAccessId("user1", "", "editor"), generateAutoAccessId("user1", "", "viewer")}
+
+	summary, err := syncUserTypeGrants(p, daoUserType, "user1", "stftyp_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := summary[FLD_GRANTED]; !reflect.DeepEqual(got, typeOneIds) {
+		t.Errorf("granted = %v, want %v", got, typeOneIds)
+	}
+	for _, accessId := range typeOneIds {
+		dataGrant, err := daoAccess.Get(accessId)
+		if err != nil || dataGrant[FLD_GRANT_SOURCE] != GRANT_SOURCE_USERTYPE || dataGrant[business_common.FLD_USERTYPE_ID] != "stftyp_1" {
+			t.Errorf("grant %s = %v %v, want an auto-grant of stftyp_1", accessId, dataGrant, err)
+		}
+	}
+	if dataGrant, _ := daoAccess.Get(manualId); dataGrant[business_common.FLD_ROLE_ID] != "editor" {
+		t.Errorf("manual grant = %v, want it kept", dataGrant)
+	}
+
+	// Nothing changes while the type stays the same
+	summary, err = syncUserTypeGrants(p, daoUserType, "user1", "stftyp_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary[FLD_GRANTED].([]string)) > 0 || len(summary[FLD_REVOKED].([]string)) > 0 {
+		t.Errorf("second sync = %v, want nothing granted or revoked", summary)
+	}
+
+	// The grants of the previous type are replaced
+	summary, err = syncUserTypeGrants(p, daoUserType, "user1", "stftyp_2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := summary[FLD_GRANTED], []string{generateAutoAccessId("user1", "site_1", "viewer")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("granted = %v, want %v", got, want)
+	}
+	got := summary[FLD_REVOKED].([]string)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, typeOneIds) {
+		t.Errorf("revoked = %v, want %v", got, typeOneIds)
+	}
+	if containsString(daoAccess.revoked, manualId) {
+		t.Error("manual grant revoked on a type change")
+	}
+}
+
+func TestSyncUserTypeGrantsWithoutType(t *testing.T) {
+	p, daoUserType := testUserTypeGrants()
+	daoAccess := p.daoAccess.(*fakeAccessDao)
+
+	if _, err := syncUserTypeGrants(p, daoUserType, "user1", "stftyp_2"); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := syncUserTypeGrants(p, daoUserType, "user1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{generateAutoAccessId("user1", "site_1", "viewer")}
+	if got := summary[FLD_REVOKED]; !reflect.DeepEqual(got, want) || !reflect.DeepEqual(daoAccess.revoked, want) {
+		t.Errorf("revoked = %v in the Dao %v, want only the auto-grant %v", got, daoAccess.revoked, want)
+	}
+}
+
+func TestGrantPermissionSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		grant   utils.Map
+		wantErr bool
+	}{
+		{"manual", utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer"}, false},
+		{"user type", utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer",
+			FLD_GRANT_SOURCE: GRANT_SOURCE_USERTYPE}, false},
+		{"user type with scope", utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer",
+			FLD_GRANT_SOURCE: GRANT_SOURCE_USERTYPE, FLD_GRANT_SCOPE: GRANT_SCOPE_REPORTS}, true},
+		{"unknown source", utils.Map{business_common.FLD_USER_ID: "user1", business_common.FLD_ROLE_ID: "viewer",
+			FLD_GRANT_SOURCE: "import"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := testUserTypeGrants()
+
+			_, err := p.GrantPermission(tt.grant)
+			var appErr *utils.AppError
+			if tt.wantErr && (!errors.As(err, &appErr) || appErr.ErrorCode != p.getServiceModuleCode()+"0109") {
+				t.Errorf("GrantPermission = %v, want the grant source error", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("GrantPermission = %v, want nil", err)
+			}
+		})
+	}
+}
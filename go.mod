@@ -8,7 +8,7 @@ require (
 	github.com/zapscloud/golib-platform-repository v0.0.0-20240217081220-186f9ee25fec
 	github.com/zapscloud/golib-platform-service v0.0.0-20231104052444-07da4e75a984
 	github.com/zapscloud/golib-utils v1.0.1-0.20231226111345-99b9295b391e
-
+	go.mongodb.org/mongo-driver v1.12.1
 )
 
 require (
@@ -24,7 +24,6 @@ require (
 	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a // indirect
 	github.com/zapscloud/golib v1.0.4 // indirect
 	github.com/zapscloud/golib-hr-repository v0.0.0-20240311093121-83f6cd77a65d // indirect
-	go.mongodb.org/mongo-driver v1.12.1 // indirect
 	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/text v0.8.0 // indirect